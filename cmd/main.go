@@ -11,6 +11,7 @@ package main
 
 import (
 	"log"
+	_ "time/tzdata" // TIMEZONE works in images without the system timezone database
 
 	"go.uber.org/zap"
 
@@ -0,0 +1,48 @@
+// Command oidc-stub runs a local OpenID provider to try single sign-on without a real IdP:
+//
+//	go run ./cmd/oidc-stub -addr localhost:9000 -email alice@example.loc -groups shortlink-admins
+//
+// and start the service with OIDC_ISSUER=http://localhost:9000 OIDC_CLIENT_ID=shortlink OIDC_CLIENT_SECRET=secret.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ptsypyshev/shortlink/internal/oidc"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:9000", "listen address")
+	issuer := flag.String("issuer", "", "issuer URL (default http://<addr>)")
+	clientID := flag.String("client-id", "shortlink", "client id")
+	clientSecret := flag.String("client-secret", "secret", "client secret")
+	subject := flag.String("sub", "stub-user-1", "subject of the signed in user")
+	username := flag.String("username", "alice", "preferred username")
+	email := flag.String("email", "alice@example.loc", "email")
+	unverified := flag.Bool("unverified", false, "issue email_verified=false")
+	groups := flag.String("groups", "", "comma separated groups")
+	flag.Parse()
+
+	if *issuer == "" {
+		*issuer = "http://" + *addr
+	}
+	user := oidc.StubUser{
+		Subject:       *subject,
+		Username:      *username,
+		Email:         *email,
+		EmailVerified: !*unverified,
+		GivenName:     *username,
+	}
+	if *groups != "" {
+		user.Groups = strings.Split(*groups, ",")
+	}
+	idp, err := oidc.NewStubIdP(*issuer, *clientID, *clientSecret, user)
+	if err != nil {
+		log.Fatalf("cannot create stub IdP: %s", err)
+	}
+	log.Printf("stub OpenID provider %s for client %q", *issuer, *clientID)
+	log.Fatal(http.ListenAndServe(*addr, idp))
+}
@@ -2,32 +2,65 @@ package app
 
 import (
 	"context"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v4/pgxpool"
 
+	"github.com/ptsypyshev/shortlink/internal/auth"
 	"github.com/ptsypyshev/shortlink/internal/db/pgdb"
+	"github.com/ptsypyshev/shortlink/internal/health"
+	"github.com/ptsypyshev/shortlink/internal/mailer"
+	"github.com/ptsypyshev/shortlink/internal/metadata"
 	"github.com/ptsypyshev/shortlink/internal/models"
+	"github.com/ptsypyshev/shortlink/internal/oidc"
+	"github.com/ptsypyshev/shortlink/internal/ratelimit"
 	"github.com/ptsypyshev/shortlink/internal/repositories/objrepo"
+	"github.com/ptsypyshev/shortlink/internal/sessionstore"
+	"github.com/ptsypyshev/shortlink/internal/targeting"
+	"github.com/ptsypyshev/shortlink/internal/webhook"
 
 	//nice "github.com/ekyoung/gin-nice-recovery"
 	"github.com/gin-contrib/sessions"
-	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
+const sessionCleanupInterval = time.Hour
+
 type App struct {
-	ctx        context.Context
-	router     *gin.Engine
-	pool       *pgxpool.Pool
-	users      objrepo.Users
-	links      objrepo.Links
-	shortlinks objrepo.ShortLinks
-	logger     *zap.Logger
+	ctx         context.Context
+	config      Config
+	router      *gin.Engine
+	pool        *pgxpool.Pool
+	users       objrepo.Users
+	links       objrepo.Links
+	shortlinks  objrepo.ShortLinks
+	tags        objrepo.Tags
+	collections objrepo.Collections
+	webhooks    objrepo.Webhooks
+	workspaces  objrepo.Workspaces
+	audit       objrepo.Audit
+	metadata    *metadata.Worker
+	dispatcher  *webhook.Dispatcher
+	signer      *auth.Signer
+	mailer      mailer.Mailer
+	resetIPs    *ratelimit.Limiter
+	resetUsers  *ratelimit.Limiter
+	mfaAttempts *ratelimit.Limiter
+	// Attempts to unlock protected links per client address and link
+	unlockAttempts *ratelimit.Limiter
+	oidc           *oidc.Provider
+	sessions       *sessionstore.Store
+	geo            targeting.GeoResolver
+	location       *time.Location
+	logger         *zap.Logger
 	//tracer   opentracing.Tracer
 }
 
@@ -35,15 +68,21 @@ type App struct {
 
 func (a *App) Init() error {
 	a.ctx = context.Background()
+	a.config = ConfigFromEnv()
 	logger, err := zap.NewDevelopment()
 	if err != nil {
 		log.Fatalf("cannot init Logger: %s", err)
 	}
 	defer func() { _ = logger.Sync() }()
 
+	a.location, err = a.config.Location()
+	if err != nil {
+		log.Fatalf("cannot load timezone: %s", err)
+	}
+
 	connectionString := pgdb.MakeConnectionStringFromEnv()
 
-	pool, err := pgdb.InitDB(a.ctx, connectionString, logger)
+	pool, err := pgdb.InitDB(a.ctx, connectionString, a.config.Timezone, logger)
 	if err != nil {
 		log.Fatalf("cannot init DB: %s", err)
 	}
@@ -65,15 +104,118 @@ func (a *App) Init() error {
 	NGDB := pgdb.NGDBNew(pool)
 	ShortLinksDB := pgdb.DBNew[*models.ShortLink](pool)
 
-	users := objrepo.UsersNew(UsersDB, NGDB, logger)
-	links := objrepo.LinksNew(LinksDB, NGDB, logger)
-	shortlinks := objrepo.ShortLinksNew(ShortLinksDB, logger)
+	secretKey := []byte(a.config.SecretKey)
+	if len(secretKey) == 0 {
+		logger.Warn(fmt.Sprintf(`%s is not set, a random key is used: issued tokens are invalidated on restart`, EnvVarSecretKey))
+		secretKey = make([]byte, 32)
+		if _, err := rand.Read(secretKey); err != nil {
+			log.Fatalf("cannot generate secret key: %s", err)
+		}
+	}
+	a.signer = auth.NewSigner(secretKey)
+
+	a.mailer, err = a.config.NewMailer()
+	if err != nil {
+		log.Fatalf("cannot init mailer: %s", err)
+	}
+	a.resetIPs = ratelimit.New(a.config.PasswordResetPerIP, time.Hour)
+	a.resetUsers = ratelimit.New(a.config.PasswordResetPerAccount, time.Hour)
+	a.mfaAttempts = ratelimit.New(a.config.MFAAttempts, a.config.MFARecentWindow)
+	a.unlockAttempts = ratelimit.New(a.config.LinkPasswordAttempts, a.config.LinkPasswordWindow)
+
+	hasher, err := auth.NewPasswordHasher(a.config.PasswordHasher)
+	if err != nil {
+		log.Fatalf("cannot init password hasher: %s", err)
+	}
+
+	users := objrepo.UsersNew(UsersDB, NGDB, hasher, a.config.PasswordPolicy, logger)
+	links := objrepo.LinksNew(LinksDB, NGDB, hasher, logger)
+	tokenGenerators, err := a.config.NewTokenGenerators()
+	if err != nil {
+		log.Fatalf("cannot init token generators: %s", err)
+	}
+	shortlinks := objrepo.ShortLinksNew(ShortLinksDB, NGDB, tokenGenerators, logger)
+	tags := objrepo.TagsNew(NGDB, logger)
+	collections := objrepo.CollectionsNew(NGDB, logger)
+	webhooks := objrepo.WebhooksNew(NGDB, logger)
+	workspaces := objrepo.WorkspacesNew(NGDB, NGDB, logger)
+	auditLog := objrepo.AuditNew(NGDB, logger)
 
 	a.logger = logger
 	a.pool = pool
 	a.users = *users
 	a.links = *links
 	a.shortlinks = *shortlinks
+	a.tags = *tags
+	a.collections = *collections
+	a.webhooks = *webhooks
+	a.workspaces = *workspaces
+	a.audit = *auditLog
+
+	a.sessions = sessionstore.New(NGDB, UserKey, a.config.SessionAbsoluteTimeout, sessions.Options{
+		Path:     "/",
+		MaxAge:   int(a.config.SessionAbsoluteTimeout.Seconds()),
+		Secure:   strings.HasPrefix(a.config.PublicBaseURL, "https://"),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	a.sessions.StartCleanup(a.ctx, sessionCleanupInterval, func(err error) {
+		logger.Error(fmt.Sprintf(`cannot delete expired sessions: %s`, err))
+	})
+	a.startTrashPurge()
+
+	if a.config.OIDCEnabled() {
+		a.oidc = oidc.NewProvider(oidc.Config{
+			IssuerURL:    a.config.OIDCIssuer,
+			ClientID:     a.config.OIDCClientID,
+			ClientSecret: a.config.OIDCClientSecret,
+			RedirectURL:  a.config.OIDCRedirectURL,
+			Scopes:       a.config.OIDCScopes,
+		}, nil)
+	} else if !a.config.LocalLoginEnabled {
+		log.Fatalf("%s=false requires single sign-on to be configured with %s and %s",
+			EnvVarLocalLoginEnabled, EnvVarOIDCIssuer, EnvVarOIDCClientID)
+	}
+
+	if a.config.GeoIPDB != "" {
+		geo, err := targeting.OpenMaxMind(a.config.GeoIPDB)
+		if err != nil {
+			log.Fatalf("cannot open GeoIP database: %s", err)
+		}
+		a.geo = geo
+	}
+
+	if a.config.MetadataEnabled {
+		fetcher := metadata.NewHTTPFetcher(a.config.MetadataTimeout, a.config.MetadataMaxSize)
+		// robots.txt and the page itself are fetched within one job
+		a.metadata = metadata.WorkerNew(fetcher, a.links, logger, 2*a.config.MetadataTimeout)
+		a.metadata.Start(a.ctx, a.config.MetadataWorkers)
+	}
+
+	if a.config.HealthEnabled {
+		checker := health.CheckerNew(health.NewHTTPProber(a.config.HealthTimeout), a.links, logger, health.Options{
+			Interval:     a.config.HealthInterval,
+			Batch:        a.config.HealthBatch,
+			Workers:      a.config.HealthWorkers,
+			HostInterval: a.config.HealthHostInterval,
+			Timeout:      a.config.HealthTimeout,
+			Failures:     a.config.HealthFailures,
+		})
+		checker.Start(a.ctx)
+	}
+
+	if a.config.WebhooksEnabled {
+		a.dispatcher = webhook.DispatcherNew(webhook.NewHTTPSender(a.config.WebhookTimeout), a.webhooks, logger,
+			webhook.Options{
+				Workers:     a.config.WebhookWorkers,
+				Timeout:     a.config.WebhookTimeout,
+				MaxAttempts: a.config.WebhookMaxAttempts,
+				Backoff:     a.config.WebhookBackoff,
+				MaxBackoff:  a.config.WebhookMaxBackoff,
+				Retention:   a.config.WebhookLogRetention,
+			})
+		a.dispatcher.Start(a.ctx)
+	}
 	return nil
 }
 
@@ -82,48 +224,132 @@ func (a *App) Serve() error {
 	a.router = gin.New()
 	a.router.Static("/static", "./web/static")
 	a.router.LoadHTMLGlob("web/templates/*")
-	a.router.Use(sessions.Sessions("session", cookie.NewStore([]byte("secret"))))
+	// The session middleware keeps the request, the client address must be set before it
+	a.router.Use(a.ClientIP)
+	a.router.Use(sessions.Sessions(SessionCookie, a.sessions))
+	a.router.Use(a.CSRFProtect)
 	a.router.NoRoute(a.HandlerNoRoute)
+	a.routes()
 
-	//Routes
+	return a.router.Run()
+}
+
+// routes registers handlers on the router, middleware handling sessions must be already added.
+func (a *App) routes() {
 	public := a.router.Group("/")
 	{
 		public.GET("/", a.HandlerIndex)
 		public.GET("/:token", a.HandlerShortLink)
+		public.GET("/:token/*path", a.HandlerShortLink)
+		public.POST("/:token", a.HandlerShortLink)
+		public.POST("/:token/*path", a.HandlerShortLink)
 		public.GET("/api/", a.HandlerAPIHelp)
+		public.GET("/api/csrf", a.GetCSRFToken)
 		public.GET("/login", a.HandlerLoginPage)
-		public.POST("/login", a.HandlerLogin)
+		public.GET("/login/2fa", a.HandlerLogin2FAPage)
+		public.POST("/login/2fa", a.HandlerLogin2FA)
 		public.POST("/api/links/", a.CreateLink)
+		public.GET("/api/domains/", a.GetDomains)
+	}
+
+	if a.oidc != nil {
+		public.GET("/login/oidc", a.HandlerOIDCLogin)
+		public.GET(oidcCallbackPath, a.HandlerOIDCCallback)
+	}
 
-		//public.PUT("/api/users/", a.UpdateUser)
-		public.GET("/api/users/:id", a.GetUser)
-		public.GET("/api/users/", a.GetUsers)
-		public.POST("/api/users/", a.CreateUser)
-		public.PUT("/api/users/", a.UpdateUser)
-		public.DELETE("/api/users/:id", a.DeleteUser)
+	local := a.router.Group("/")
+	local.Use(a.LocalLoginRequired)
+	{
+		local.POST("/login", a.HandlerLogin)
+		local.GET("/register", a.HandlerRegisterPage)
+		local.POST("/register", a.HandlerRegister)
+		local.GET("/verify", a.HandlerVerifyEmail)
+		local.POST("/api/register/", a.RegisterUser)
+		local.POST("/api/register/resend", a.ResendVerification)
+		local.GET("/forgot", a.HandlerForgotPasswordPage)
+		local.POST("/forgot", a.HandlerForgotPassword)
+		local.GET("/reset", a.HandlerResetPasswordPage)
+		local.POST("/reset", a.HandlerResetPassword)
+		local.POST("/api/password/forgot", a.ForgotPassword)
+		local.POST("/api/password/reset", a.ResetPassword)
 	}
 
 	private := a.router.Group("/")
-	private.Use(AuthRequired)
+	private.Use(a.AuthRequired)
 	{
-		private.GET("/dbinit/", a.HandlerInitSchema)
-		private.GET("/demodb/", a.HandlerAddDemoData)
+		private.POST("/dbinit/", a.AdminRequired, a.HandlerInitSchema)
+		private.POST("/demodb/", a.AdminRequired, a.HandlerAddDemoData)
 		private.GET("/dashboard/", a.HandlerDashboard)
 		private.GET("/users/", a.HandlerUsersManagement)
-		private.GET("/logout/", a.HandlerLogout)
+		private.GET("/security/", a.HandlerSecurity)
+		private.POST("/logout/", a.HandlerLogout)
 
-		//private.GET("/api/users/:id", a.GetUser)
-		//private.GET("/api/users/", a.GetUsers)
-		//private.POST("/api/users/", a.CreateUser)
-		//private.PUT("/api/users/", a.UpdateUser)
-		//private.DELETE("/api/users/:id", a.DeleteUser)
+		private.GET("/api/users/:id", a.GetUser)
+		private.GET("/api/users/", a.AdminRequired, a.GetUsers)
+		private.POST("/api/users/", a.AdminRequired, a.CreateUser)
+		private.PUT("/api/users/", a.AdminRequired, a.UpdateUser)
+		private.DELETE("/api/users/:id", a.AdminRequired, a.DeleteUser)
 
 		private.GET("/api/users/:id/links", a.SearchLinks)
+		private.POST("/api/users/:id/links/transfer", a.AdminRequired, a.TransferLinks)
+		private.GET("/api/users/:id/trash", a.GetTrash)
+		private.GET("/api/trash/users", a.AdminRequired, a.GetDeletedUsers)
+		private.POST("/api/users/:id/restore", a.AdminRequired, a.RestoreUser)
 
 		private.GET("/api/links/:id", a.GetLink)
 		private.PUT("/api/links/", a.UpdateLink)
 		private.DELETE("/api/links/:id", a.DeleteLink)
-	}
+		private.POST("/api/links/:id/restore", a.RestoreLink)
+		private.GET("/api/links/:id/tokens", a.GetLinkTokens)
+		private.POST("/api/links/:id/tokens", a.AddLinkToken)
+		private.PUT("/api/links/:id/tokens/:token_id", a.UpdateLinkToken)
+		private.DELETE("/api/links/:id/tokens/:token_id", a.RetireLinkToken)
+		private.POST("/api/links/:id/targeting/test", a.TestLinkTargeting)
 
-	return a.router.Run()
+		private.GET("/api/tags/", a.GetTags)
+		private.POST("/api/tags/", a.CreateTag)
+		private.PUT("/api/tags/", a.UpdateTag)
+		private.DELETE("/api/tags/:id", a.DeleteTag)
+
+		private.GET("/api/collections/", a.GetCollections)
+		private.GET("/api/collections/:id", a.GetCollection)
+		private.POST("/api/collections/", a.CreateCollection)
+		private.PUT("/api/collections/", a.UpdateCollection)
+		private.DELETE("/api/collections/:id", a.DeleteCollection)
+		private.POST("/api/collections/:id/links/:link_id", a.AddCollectionLink)
+		private.DELETE("/api/collections/:id/links/:link_id", a.RemoveCollectionLink)
+
+		private.GET("/api/webhooks/", a.GetWebhooks)
+		private.GET("/api/webhooks/:id", a.GetWebhook)
+		private.POST("/api/webhooks/", a.CreateWebhook)
+		private.PUT("/api/webhooks/", a.UpdateWebhook)
+		private.DELETE("/api/webhooks/:id", a.DeleteWebhook)
+		private.GET("/api/webhooks/:id/deliveries", a.GetWebhookDeliveries)
+		private.POST("/api/webhooks/:id/test", a.TestWebhook)
+
+		private.GET("/api/workspaces/", a.GetWorkspaces)
+		private.POST("/api/workspaces/", a.CreateWorkspace)
+		private.PUT("/api/workspaces/", a.UpdateWorkspace)
+		private.DELETE("/api/workspaces/:id", a.DeleteWorkspace)
+		private.GET("/api/workspaces/:id/links", a.GetWorkspaceLinks)
+		private.GET("/api/workspaces/:id/members", a.GetWorkspaceMembers)
+		private.PUT("/api/workspaces/:id/members", a.SetWorkspaceMember)
+		private.DELETE("/api/workspaces/:id/members/:user_id", a.RemoveWorkspaceMember)
+
+		private.GET("/api/sessions/", a.GetSessions)
+		private.DELETE("/api/sessions/", a.RevokeOtherSessions)
+		private.DELETE("/api/sessions/:id", a.RevokeSession)
+		private.GET("/api/users/:id/sessions", a.AdminRequired, a.GetUserSessions)
+		private.DELETE("/api/users/:id/sessions", a.AdminRequired, a.RevokeUserSessions)
+
+		private.GET("/api/2fa/", a.Get2FA)
+		private.POST("/api/2fa/setup", a.Setup2FA)
+		private.POST("/api/2fa/enable", a.Enable2FA)
+		private.POST("/api/2fa/verify", a.Verify2FA)
+		private.POST("/api/2fa/disable", a.Recent2FARequired, a.Disable2FA)
+		private.POST("/api/2fa/recovery-codes", a.Recent2FARequired, a.RegenerateRecoveryCodes)
+		private.DELETE("/api/users/:id/2fa", a.AdminRequired, a.Reset2FA)
+
+		private.GET("/api/audit", a.AdminRequired, a.GetAuditLog)
+	}
 }
@@ -0,0 +1,502 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ptsypyshev/shortlink/internal/auth"
+	"github.com/ptsypyshev/shortlink/internal/health"
+	"github.com/ptsypyshev/shortlink/internal/mailer"
+	"github.com/ptsypyshev/shortlink/internal/metadata"
+	"github.com/ptsypyshev/shortlink/internal/models"
+	"github.com/ptsypyshev/shortlink/internal/repositories/objrepo"
+	"github.com/ptsypyshev/shortlink/internal/webhook"
+)
+
+const (
+	EnvVarSecretKey     = "SECRET_KEY"
+	EnvVarPublicBaseURL = "PUBLIC_BASE_URL"
+
+	EnvVarRegistrationEnabled = "REGISTRATION_ENABLED"
+	EnvVarVerificationTTL     = "VERIFICATION_TTL"
+
+	EnvVarPasswordResetTTL        = "PASSWORD_RESET_TTL"
+	EnvVarPasswordResetPerIP      = "PASSWORD_RESET_PER_IP"
+	EnvVarPasswordResetPerAccount = "PASSWORD_RESET_PER_ACCOUNT"
+
+	EnvVarMailer   = "MAILER"
+	EnvVarMailFrom = "MAIL_FROM"
+	EnvVarMailDir  = "MAIL_DIR"
+	EnvVarSMTPAddr = "SMTP_ADDR"
+	EnvVarSMTPUser = "SMTP_USER"
+	EnvVarSMTPPass = "SMTP_PASS"
+
+	DefaultPublicBaseURL           = "http://localhost:8080"
+	DefaultVerificationTTL         = 24 * time.Hour
+	DefaultPasswordResetTTL        = time.Hour
+	DefaultPasswordResetPerIP      = 10
+	DefaultPasswordResetPerAccount = 3
+	DefaultMailFrom                = "Shortlink <noreply@shortlink.local>"
+	DefaultMailDir                 = "mail"
+
+	EnvVarMetadataEnabled = "METADATA_ENABLED"
+	EnvVarMetadataTimeout = "METADATA_TIMEOUT"
+	EnvVarMetadataMaxSize = "METADATA_MAX_SIZE"
+	EnvVarMetadataWorkers = "METADATA_WORKERS"
+
+	EnvVarHealthEnabled      = "HEALTH_ENABLED"
+	EnvVarHealthInterval     = "HEALTH_INTERVAL"
+	EnvVarHealthBatch        = "HEALTH_BATCH"
+	EnvVarHealthWorkers      = "HEALTH_WORKERS"
+	EnvVarHealthHostInterval = "HEALTH_HOST_INTERVAL"
+	EnvVarHealthTimeout      = "HEALTH_TIMEOUT"
+	EnvVarHealthFailures     = "HEALTH_FAILURES"
+
+	EnvVarWebhooksEnabled     = "WEBHOOKS_ENABLED"
+	EnvVarWebhookTimeout      = "WEBHOOK_TIMEOUT"
+	EnvVarWebhookWorkers      = "WEBHOOK_WORKERS"
+	EnvVarWebhookMaxAttempts  = "WEBHOOK_MAX_ATTEMPTS"
+	EnvVarWebhookBackoff      = "WEBHOOK_BACKOFF"
+	EnvVarWebhookMaxBackoff   = "WEBHOOK_MAX_BACKOFF"
+	EnvVarWebhookLogRetention = "WEBHOOK_LOG_RETENTION"
+
+	EnvVarTOTPIssuer      = "TOTP_ISSUER"
+	EnvVarMFARecentWindow = "MFA_RECENT_WINDOW"
+	EnvVarMFAAttempts     = "MFA_ATTEMPTS"
+
+	DefaultTOTPIssuer      = "Shortlink"
+	DefaultMFARecentWindow = 15 * time.Minute
+	DefaultMFAAttempts     = 5
+
+	EnvVarSessionIdleTimeout     = "SESSION_IDLE_TIMEOUT"
+	EnvVarSessionAbsoluteTimeout = "SESSION_ABSOLUTE_TIMEOUT"
+
+	DefaultSessionIdleTimeout     = 2 * time.Hour
+	DefaultSessionAbsoluteTimeout = 7 * 24 * time.Hour
+
+	EnvVarTrashRetention     = "TRASH_RETENTION"
+	EnvVarTrashPurgeInterval = "TRASH_PURGE_INTERVAL"
+
+	DefaultTrashRetention     = 30 * 24 * time.Hour
+	DefaultTrashPurgeInterval = time.Hour
+
+	EnvVarLocalLoginEnabled = "LOCAL_LOGIN_ENABLED"
+	EnvVarOIDCIssuer        = "OIDC_ISSUER"
+	EnvVarOIDCClientID      = "OIDC_CLIENT_ID"
+	EnvVarOIDCClientSecret  = "OIDC_CLIENT_SECRET"
+	EnvVarOIDCRedirectURL   = "OIDC_REDIRECT_URL"
+	EnvVarOIDCScopes        = "OIDC_SCOPES"
+	EnvVarOIDCProviderName  = "OIDC_PROVIDER_NAME"
+	EnvVarOIDCGroupsClaim   = "OIDC_GROUPS_CLAIM"
+	EnvVarOIDCRoleMapping   = "OIDC_ROLE_MAPPING"
+
+	DefaultOIDCScopes       = "openid email profile"
+	DefaultOIDCProviderName = "SSO"
+	DefaultOIDCGroupsClaim  = "groups"
+	oidcCallbackPath        = "/login/oidc/callback"
+
+	EnvVarShortDomains       = "SHORT_DOMAINS"
+	EnvVarDefaultShortDomain = "DEFAULT_SHORT_DOMAIN"
+
+	EnvVarLinkDedup = "LINK_DEDUP"
+
+	EnvVarTokenGenerator  = "TOKEN_GENERATOR"
+	EnvVarTokenGenerators = "TOKEN_GENERATORS"
+	EnvVarTokenLength     = "TOKEN_LENGTH"
+	EnvVarTokenWords      = "TOKEN_WORDS"
+	EnvVarHashidsSalt     = "HASHIDS_SALT"
+
+	EnvVarGeoIPDB = "GEOIP_DB"
+
+	EnvVarVariantCookieTTL  = "VARIANT_COOKIE_TTL"
+	DefaultVariantCookieTTL = 30 * 24 * time.Hour
+
+	EnvVarTimezone  = "TIMEZONE"
+	DefaultTimezone = "UTC"
+
+	EnvVarLinkPasswordAttempts = "LINK_PASSWORD_ATTEMPTS"
+	EnvVarLinkPasswordWindow   = "LINK_PASSWORD_WINDOW"
+	EnvVarLinkUnlockTTL        = "LINK_UNLOCK_TTL"
+
+	DefaultLinkPasswordAttempts = 5
+	DefaultLinkPasswordWindow   = 15 * time.Minute
+	DefaultLinkUnlockTTL        = 10 * time.Minute
+
+	EnvVarPasswordHasher           = "PASSWORD_HASHER"
+	EnvVarPasswordMinLength        = "PASSWORD_MIN_LENGTH"
+	EnvVarPasswordMaxLength        = "PASSWORD_MAX_LENGTH"
+	EnvVarPasswordRequireMixedCase = "PASSWORD_REQUIRE_MIXED_CASE"
+	EnvVarPasswordRequireDigit     = "PASSWORD_REQUIRE_DIGIT"
+	EnvVarPasswordRequireSymbol    = "PASSWORD_REQUIRE_SYMBOL"
+)
+
+type Config struct {
+	SecretKey     string
+	PublicBaseURL string
+
+	RegistrationEnabled bool
+	VerificationTTL     time.Duration
+
+	// Password reset requests are limited per hour
+	PasswordResetTTL        time.Duration
+	PasswordResetPerIP      int
+	PasswordResetPerAccount int
+
+	Mailer   string
+	MailFrom string
+	MailDir  string
+	SMTPAddr string
+	SMTPUser string
+	SMTPPass string
+
+	MetadataEnabled bool
+	MetadataTimeout time.Duration
+	MetadataMaxSize int64
+	MetadataWorkers int
+
+	// Destinations of active links are probed in batches of HealthBatch every HealthInterval by HealthWorkers,
+	// requests to one host are spaced by HealthHostInterval. A link is broken after HealthFailures failed checks
+	HealthEnabled      bool
+	HealthInterval     time.Duration
+	HealthBatch        int
+	HealthWorkers      int
+	HealthHostInterval time.Duration
+	HealthTimeout      time.Duration
+	HealthFailures     int
+
+	// Link events are delivered to webhooks by WebhookWorkers with WebhookTimeout per attempt. Failed deliveries
+	// are retried after WebhookBackoff doubled on every attempt up to WebhookMaxBackoff, WebhookMaxAttempts times
+	// at most. Finished deliveries stay in the log for WebhookLogRetention
+	WebhooksEnabled     bool
+	WebhookTimeout      time.Duration
+	WebhookWorkers      int
+	WebhookMaxAttempts  int
+	WebhookBackoff      time.Duration
+	WebhookMaxBackoff   time.Duration
+	WebhookLogRetention time.Duration
+
+	PasswordHasher string
+	PasswordPolicy auth.PasswordPolicy
+
+	// Sensitive operations require a second factor verified within MFARecentWindow,
+	// MFAAttempts limits wrong codes per user within the same window
+	TOTPIssuer      string
+	MFARecentWindow time.Duration
+	MFAAttempts     int
+
+	// Sessions end after SessionIdleTimeout without requests or SessionAbsoluteTimeout after login
+	SessionIdleTimeout     time.Duration
+	SessionAbsoluteTimeout time.Duration
+
+	// Deleted users and links stay in the trash for TrashRetention, the purge job runs every TrashPurgeInterval
+	TrashRetention     time.Duration
+	TrashPurgeInterval time.Duration
+
+	// Single sign-on is enabled if OIDCIssuer is set, LocalLoginEnabled=false leaves it the only way to sign in.
+	// OIDCRoleMapping maps values of the OIDCGroupsClaim claim to roles (OIDC_ROLE_MAPPING=admins=admin,staff=user)
+	LocalLoginEnabled bool
+	OIDCIssuer        string
+	OIDCClientID      string
+	OIDCClientSecret  string
+	OIDCRedirectURL   string
+	OIDCScopes        []string
+	OIDCProviderName  string
+	OIDCGroupsClaim   string
+	OIDCRoleMapping   map[string]string
+
+	// Short links are served on ShortDomains which map hosts to public base URLs
+	// (SHORT_DOMAINS=go.acme.io=https://go.acme.io,acme.link=https://acme.link). Links created without a domain
+	// use DefaultShortDomain (the host of PublicBaseURL by default), its tokens also resolve on unknown hosts
+	DefaultShortDomain string
+	ShortDomains       map[string]string
+
+	// With LinkDedup shortening the same destination again returns the existing active link of the owner
+	LinkDedup bool
+
+	// New tokens are made by TokenGenerator (hashids, random or words) or by the generator of the short domain
+	// (TOKEN_GENERATORS=acme.link=words), existing tokens are kept as is
+	TokenGenerator  string
+	TokenGenerators map[string]string
+	TokenOptions    objrepo.TokenOptions
+
+	// Countries of targeting rules are resolved by a local MaxMind database file (GeoLite2-Country.mmdb),
+	// without it rules with countries match no clicks
+	GeoIPDB string
+
+	// Clients of split links keep their variant for VariantCookieTTL, zero chooses a variant on every click
+	VariantCookieTTL time.Duration
+
+	// Passphrases of protected links may be tried LinkPasswordAttempts times per LinkPasswordWindow
+	// from one address, a correct one unlocks the link in the browser for LinkUnlockTTL
+	LinkPasswordAttempts int
+	LinkPasswordWindow   time.Duration
+	LinkUnlockTTL        time.Duration
+
+	// Schedule times without a zone offset are in Timezone (IANA name, e.g. Europe/Berlin),
+	// database sessions use it too
+	Timezone string
+}
+
+func ConfigFromEnv() Config {
+	c := Config{
+		SecretKey:     os.Getenv(EnvVarSecretKey),
+		PublicBaseURL: strings.TrimSuffix(getEnv(EnvVarPublicBaseURL, DefaultPublicBaseURL), "/"),
+
+		RegistrationEnabled: getEnvBool(EnvVarRegistrationEnabled, true),
+		VerificationTTL:     getEnvDuration(EnvVarVerificationTTL, DefaultVerificationTTL),
+
+		PasswordResetTTL:        getEnvDuration(EnvVarPasswordResetTTL, DefaultPasswordResetTTL),
+		PasswordResetPerIP:      getEnvInt(EnvVarPasswordResetPerIP, DefaultPasswordResetPerIP),
+		PasswordResetPerAccount: getEnvInt(EnvVarPasswordResetPerAccount, DefaultPasswordResetPerAccount),
+
+		Mailer:   getEnv(EnvVarMailer, mailer.TypeFile),
+		MailFrom: getEnv(EnvVarMailFrom, DefaultMailFrom),
+		MailDir:  getEnv(EnvVarMailDir, DefaultMailDir),
+		SMTPAddr: os.Getenv(EnvVarSMTPAddr),
+		SMTPUser: os.Getenv(EnvVarSMTPUser),
+		SMTPPass: os.Getenv(EnvVarSMTPPass),
+
+		MetadataEnabled: getEnvBool(EnvVarMetadataEnabled, true),
+		MetadataTimeout: getEnvDuration(EnvVarMetadataTimeout, metadata.DefaultTimeout),
+		MetadataMaxSize: int64(getEnvInt(EnvVarMetadataMaxSize, metadata.DefaultMaxSize)),
+		MetadataWorkers: getEnvInt(EnvVarMetadataWorkers, metadata.DefaultWorkers),
+
+		PasswordHasher: getEnv(EnvVarPasswordHasher, auth.HasherArgon2id),
+		PasswordPolicy: auth.PasswordPolicy{
+			MinLength:        getEnvInt(EnvVarPasswordMinLength, auth.DefaultPasswordPolicy.MinLength),
+			MaxLength:        getEnvInt(EnvVarPasswordMaxLength, auth.DefaultPasswordPolicy.MaxLength),
+			RequireMixedCase: getEnvBool(EnvVarPasswordRequireMixedCase, auth.DefaultPasswordPolicy.RequireMixedCase),
+			RequireDigit:     getEnvBool(EnvVarPasswordRequireDigit, auth.DefaultPasswordPolicy.RequireDigit),
+			RequireSymbol:    getEnvBool(EnvVarPasswordRequireSymbol, auth.DefaultPasswordPolicy.RequireSymbol),
+		},
+
+		TOTPIssuer:      getEnv(EnvVarTOTPIssuer, DefaultTOTPIssuer),
+		MFARecentWindow: getEnvDuration(EnvVarMFARecentWindow, DefaultMFARecentWindow),
+		MFAAttempts:     getEnvInt(EnvVarMFAAttempts, DefaultMFAAttempts),
+	}
+	c.SessionIdleTimeout = getEnvDuration(EnvVarSessionIdleTimeout, DefaultSessionIdleTimeout)
+	c.SessionAbsoluteTimeout = getEnvDuration(EnvVarSessionAbsoluteTimeout, DefaultSessionAbsoluteTimeout)
+	c.TrashRetention = getEnvDuration(EnvVarTrashRetention, DefaultTrashRetention)
+	c.TrashPurgeInterval = getEnvDuration(EnvVarTrashPurgeInterval, DefaultTrashPurgeInterval)
+	c.LocalLoginEnabled = getEnvBool(EnvVarLocalLoginEnabled, true)
+	c.OIDCIssuer = os.Getenv(EnvVarOIDCIssuer)
+	c.OIDCClientID = os.Getenv(EnvVarOIDCClientID)
+	c.OIDCClientSecret = os.Getenv(EnvVarOIDCClientSecret)
+	c.OIDCRedirectURL = getEnv(EnvVarOIDCRedirectURL, c.PublicBaseURL+oidcCallbackPath)
+	c.OIDCScopes = strings.Fields(getEnv(EnvVarOIDCScopes, DefaultOIDCScopes))
+	c.OIDCProviderName = getEnv(EnvVarOIDCProviderName, DefaultOIDCProviderName)
+	c.OIDCGroupsClaim = getEnv(EnvVarOIDCGroupsClaim, DefaultOIDCGroupsClaim)
+	c.OIDCRoleMapping = getEnvMap(EnvVarOIDCRoleMapping)
+	c.DefaultShortDomain, c.ShortDomains = shortDomainsFromEnv(c.PublicBaseURL)
+	c.LinkDedup = getEnvBool(EnvVarLinkDedup, false)
+	c.TokenGenerator = getEnv(EnvVarTokenGenerator, objrepo.TokenHashids)
+	c.TokenGenerators = getEnvMap(EnvVarTokenGenerators)
+	c.TokenOptions = objrepo.TokenOptions{
+		HashSalt: getEnv(EnvVarHashidsSalt, objrepo.HashSalt),
+		Length:   getEnvInt(EnvVarTokenLength, objrepo.DefaultTokenLength),
+		Words:    getEnvInt(EnvVarTokenWords, objrepo.DefaultTokenWords),
+	}
+	c.GeoIPDB = os.Getenv(EnvVarGeoIPDB)
+	c.VariantCookieTTL = getEnvNonNegativeDuration(EnvVarVariantCookieTTL, DefaultVariantCookieTTL)
+	c.LinkPasswordAttempts = getEnvInt(EnvVarLinkPasswordAttempts, DefaultLinkPasswordAttempts)
+	c.LinkPasswordWindow = getEnvDuration(EnvVarLinkPasswordWindow, DefaultLinkPasswordWindow)
+	c.LinkUnlockTTL = getEnvDuration(EnvVarLinkUnlockTTL, DefaultLinkUnlockTTL)
+	c.Timezone = getEnv(EnvVarTimezone, DefaultTimezone)
+	c.HealthEnabled = getEnvBool(EnvVarHealthEnabled, true)
+	c.HealthInterval = getEnvDuration(EnvVarHealthInterval, health.DefaultInterval)
+	c.HealthBatch = getEnvInt(EnvVarHealthBatch, health.DefaultBatch)
+	c.HealthWorkers = getEnvInt(EnvVarHealthWorkers, health.DefaultWorkers)
+	c.HealthHostInterval = getEnvNonNegativeDuration(EnvVarHealthHostInterval, health.DefaultHostInterval)
+	c.HealthTimeout = getEnvDuration(EnvVarHealthTimeout, health.DefaultTimeout)
+	c.HealthFailures = getEnvInt(EnvVarHealthFailures, health.DefaultFailures)
+	c.WebhooksEnabled = getEnvBool(EnvVarWebhooksEnabled, true)
+	c.WebhookTimeout = getEnvDuration(EnvVarWebhookTimeout, webhook.DefaultTimeout)
+	c.WebhookWorkers = getEnvInt(EnvVarWebhookWorkers, webhook.DefaultWorkers)
+	c.WebhookMaxAttempts = getEnvInt(EnvVarWebhookMaxAttempts, webhook.DefaultMaxAttempts)
+	c.WebhookBackoff = getEnvDuration(EnvVarWebhookBackoff, webhook.DefaultBackoff)
+	c.WebhookMaxBackoff = getEnvDuration(EnvVarWebhookMaxBackoff, webhook.DefaultMaxBackoff)
+	c.WebhookLogRetention = getEnvDuration(EnvVarWebhookLogRetention, webhook.DefaultRetention)
+	return c
+}
+
+// NewTokenGenerators creates the default token generator and generators of short domains.
+func (c Config) NewTokenGenerators() (objrepo.TokenGenerators, error) {
+	var (
+		generators = objrepo.TokenGenerators{ByDomain: make(map[string]objrepo.TokenGenerator)}
+		err        error
+	)
+	generators.Default, err = objrepo.NewTokenGenerator(c.TokenGenerator, c.TokenOptions)
+	if err != nil {
+		return generators, err
+	}
+	for domain, name := range c.TokenGenerators {
+		key, err := c.ShortDomainKey(domain)
+		if err != nil {
+			return generators, err
+		}
+		if generators.ByDomain[key], err = objrepo.NewTokenGenerator(name, c.TokenOptions); err != nil {
+			return generators, err
+		}
+	}
+	return generators, nil
+}
+
+func shortDomainsFromEnv(publicBaseURL string) (string, map[string]string) {
+	domains := make(map[string]string)
+	for host, baseURL := range getEnvMap(EnvVarShortDomains) {
+		host = strings.ToLower(host)
+		if baseURL == "" {
+			baseURL = "https://" + host
+		}
+		domains[host] = strings.TrimSuffix(baseURL, "/")
+	}
+	defaultDomain := publicBaseURL
+	if u, err := url.Parse(publicBaseURL); err == nil {
+		defaultDomain = u.Hostname()
+	}
+	defaultDomain = strings.ToLower(getEnv(EnvVarDefaultShortDomain, defaultDomain))
+	if _, ok := domains[defaultDomain]; !ok {
+		domains[defaultDomain] = publicBaseURL
+	}
+	return defaultDomain, domains
+}
+
+// ShortDomainKey returns the domain as it is stored with shortlinks: empty for the default domain.
+func (c Config) ShortDomainKey(domain string) (string, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if domain == "" || domain == c.DefaultShortDomain {
+		return "", nil
+	}
+	if _, ok := c.ShortDomains[domain]; !ok {
+		return "", fmt.Errorf("unknown short domain %q", domain)
+	}
+	return domain, nil
+}
+
+// ShortDomainByHost returns the stored domain for the Host header of a request.
+func (c Config) ShortDomainByHost(host string) string {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	key, err := c.ShortDomainKey(host)
+	if err != nil {
+		return ""
+	}
+	return key
+}
+
+// ShortURL returns the full short URL of the token on the stored domain.
+func (c Config) ShortURL(domain, token string) string {
+	if domain == "" {
+		domain = c.DefaultShortDomain
+	}
+	baseURL, ok := c.ShortDomains[domain]
+	if !ok {
+		// The domain is no longer configured
+		baseURL = "https://" + domain
+	}
+	return baseURL + "/" + token
+}
+
+// Location returns the configured timezone.
+func (c Config) Location() (*time.Location, error) {
+	return time.LoadLocation(c.Timezone)
+}
+
+// OIDCEnabled reports whether single sign-on is configured.
+func (c Config) OIDCEnabled() bool {
+	return c.OIDCIssuer != "" && c.OIDCClientID != ""
+}
+
+// OIDCRole maps the IdP groups to a role: administrator wins over the others, users without mapped groups
+// get the user role. An empty role (no mapping configured) leaves the role of the user unchanged.
+func (c Config) OIDCRole(groups []string) string {
+	if len(c.OIDCRoleMapping) == 0 {
+		return ""
+	}
+	role := models.RoleUser
+	for _, group := range groups {
+		if mapped, ok := c.OIDCRoleMapping[group]; ok {
+			if mapped == models.RoleAdmin {
+				return mapped
+			}
+			role = mapped
+		}
+	}
+	return role
+}
+
+func (c Config) NewMailer() (mailer.Mailer, error) {
+	switch c.Mailer {
+	case mailer.TypeSMTP:
+		if c.SMTPAddr == "" {
+			return nil, fmt.Errorf("%s is required for smtp mailer", EnvVarSMTPAddr)
+		}
+		return &mailer.SMTPMailer{Addr: c.SMTPAddr, Username: c.SMTPUser, Password: c.SMTPPass, From: c.MailFrom}, nil
+	case mailer.TypeFile:
+		return &mailer.FileMailer{Dir: c.MailDir, From: c.MailFrom}, nil
+	case mailer.TypeMemory:
+		return &mailer.MemoryMailer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown mailer %q", c.Mailer)
+	}
+}
+
+func getEnv(envVarName, defaultValue string) string {
+	result := os.Getenv(envVarName)
+	if result == "" {
+		result = defaultValue
+	}
+	return result
+}
+
+// getEnvMap parses comma separated key=value pairs.
+func getEnvMap(envVarName string) map[string]string {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv(envVarName), ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if key = strings.TrimSpace(key); ok && key != "" {
+			result[key] = strings.TrimSpace(value)
+		}
+	}
+	return result
+}
+
+func getEnvBool(envVarName string, defaultValue bool) bool {
+	result, err := strconv.ParseBool(os.Getenv(envVarName))
+	if err != nil {
+		return defaultValue
+	}
+	return result
+}
+
+func getEnvInt(envVarName string, defaultValue int) int {
+	result, err := strconv.Atoi(os.Getenv(envVarName))
+	if err != nil {
+		return defaultValue
+	}
+	return result
+}
+
+// getEnvDuration returns the default for zero and negative durations, they would break tickers and timeouts.
+func getEnvDuration(envVarName string, defaultValue time.Duration) time.Duration {
+	result, err := time.ParseDuration(os.Getenv(envVarName))
+	if err != nil || result <= 0 {
+		return defaultValue
+	}
+	return result
+}
+
+// getEnvNonNegativeDuration is getEnvDuration for durations where zero turns the limit off.
+func getEnvNonNegativeDuration(envVarName string, defaultValue time.Duration) time.Duration {
+	result, err := time.ParseDuration(os.Getenv(envVarName))
+	if err != nil || result < 0 {
+		return defaultValue
+	}
+	return result
+}
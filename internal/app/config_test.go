@@ -0,0 +1,39 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ptsypyshev/shortlink/internal/health"
+)
+
+func TestConfigDurations(t *testing.T) {
+	tests := []struct {
+		value        string
+		interval     time.Duration
+		hostInterval time.Duration
+	}{
+		{"", health.DefaultInterval, health.DefaultHostInterval},
+		{"bad", health.DefaultInterval, health.DefaultHostInterval},
+		{"-1s", health.DefaultInterval, health.DefaultHostInterval},
+		{"0s", health.DefaultInterval, 0},
+		{"3s", 3 * time.Second, 3 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv(EnvVarHealthInterval, tt.value)
+			t.Setenv(EnvVarTrashPurgeInterval, tt.value)
+			t.Setenv(EnvVarHealthHostInterval, tt.value)
+			c := ConfigFromEnv()
+			if c.HealthInterval != tt.interval {
+				t.Errorf("HealthInterval = %s, want %s", c.HealthInterval, tt.interval)
+			}
+			if c.TrashPurgeInterval <= 0 {
+				t.Errorf("TrashPurgeInterval = %s, want a positive interval", c.TrashPurgeInterval)
+			}
+			if c.HealthHostInterval != tt.hostInterval {
+				t.Errorf("HealthHostInterval = %s, want %s", c.HealthHostInterval, tt.hostInterval)
+			}
+		})
+	}
+}
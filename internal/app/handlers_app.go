@@ -4,25 +4,25 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 
+	"github.com/ptsypyshev/shortlink/internal/audit"
 	"github.com/ptsypyshev/shortlink/internal/db/pgdb"
 	"github.com/ptsypyshev/shortlink/internal/models"
 )
 
-const SessionAdmin = "admin"
-
 func (a App) HandlerIndex(c *gin.Context) {
 	session := sessions.Default(c)
 	userSession := session.Get(UserKey)
-	c.HTML(http.StatusOK, "main", gin.H{
+	a.html(c, http.StatusOK, "main", gin.H{
 		"title":         "Shortlink - make your links as short as possible!",
 		"h1_text":       "Shortlink - make your links as short as possible!",
 		"user_session":  userSession,
 		"page_template": "main",
-		"is_admin":      userSession == SessionAdmin,
+		"is_admin":      a.isAdmin(userSession),
 	})
 }
 
@@ -46,12 +46,12 @@ func (a App) HandlerDashboard(c *gin.Context) {
 		userID = user[0].ID
 	}
 
-	c.HTML(http.StatusOK, "dashboard", gin.H{
+	a.html(c, http.StatusOK, "dashboard", gin.H{
 		"title":         "Shortlink - Dashboard for user %s",
 		"h1_text":       "Shortlink - make your links as short as possible!",
 		"user_session":  userSession,
 		"userID":        userID,
-		"is_admin":      userSession == SessionAdmin,
+		"is_admin":      a.isAdmin(userSession),
 		"page_template": "dashboard",
 	})
 }
@@ -71,6 +71,31 @@ func (a App) HandlerDefault(c *gin.Context) (any, sessions.Session, any, error)
 	return userID, session, userSession, nil
 }
 
+// isAdmin reports whether the session user has the administrator role.
+func (a App) isAdmin(userSession any) bool {
+	if userSession == nil {
+		return false
+	}
+	user, err := a.findUser(fmt.Sprint(userSession))
+	return err == nil && user.Role == models.RoleAdmin
+}
+
+func (a App) currentUser(c *gin.Context) (*models.User, error) {
+	session := sessions.Default(c)
+	userSession := session.Get(UserKey)
+	if userSession == nil {
+		return nil, fmt.Errorf("invalid session token")
+	}
+	users, err := a.users.Search(a.ctx, "username", userSession)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("cannot find user with name %s", userSession)
+	}
+	return users[0], nil
+}
+
 func (a App) HandlerUsersManagement(c *gin.Context) {
 	userID, session, userSession, err := a.HandlerDefault(c)
 	if err != nil {
@@ -91,12 +116,12 @@ func (a App) HandlerUsersManagement(c *gin.Context) {
 		userID = user[0].ID
 	}
 
-	c.HTML(http.StatusOK, "users", gin.H{
+	a.html(c, http.StatusOK, "users", gin.H{
 		"title":         "Shortlink - User Management",
 		"h1_text":       "Shortlink - make your links as short as possible!",
 		"user_session":  userSession,
 		"userID":        userID,
-		"is_admin":      userSession == SessionAdmin,
+		"is_admin":      a.isAdmin(userSession),
 		"page_template": "users",
 	})
 }
@@ -106,17 +131,16 @@ func (a App) HandlerLoginPage(c *gin.Context) {
 	userSession := session.Get(UserKey)
 	if userSession != nil {
 		msg := "Please logout first"
-		c.HTML(http.StatusBadRequest, "login",
-			gin.H{
-				"title":         fmt.Sprintf("Shortlink - %s", msg),
-				"user_session":  userSession,
-				"page_template": "login",
-				"error_message": msg,
-				"do_logout":     "true",
-			})
+		a.renderLogin(c, http.StatusBadRequest, gin.H{
+			"title":         fmt.Sprintf("Shortlink - %s", msg),
+			"user_session":  userSession,
+			"page_template": "login",
+			"error_message": msg,
+			"do_logout":     "true",
+		})
 		return
 	}
-	c.HTML(http.StatusOK, "login", gin.H{
+	a.renderLogin(c, http.StatusOK, gin.H{
 		"title":         "Shortlink - make your links as short as possible!",
 		"user_session":  userSession,
 		"page_template": "login",
@@ -128,14 +152,13 @@ func (a App) HandlerLogin(c *gin.Context) {
 	userSession := session.Get(UserKey)
 	if userSession != nil {
 		msg := "Please Sign out first"
-		c.HTML(http.StatusBadRequest, "login",
-			gin.H{
-				"title":         fmt.Sprintf("Shortlink - %s", msg),
-				"user_session":  userSession,
-				"page_template": "login",
-				"error_message": msg,
-				"do_logout":     "true",
-			})
+		a.renderLogin(c, http.StatusBadRequest, gin.H{
+			"title":         fmt.Sprintf("Shortlink - %s", msg),
+			"user_session":  userSession,
+			"page_template": "login",
+			"error_message": msg,
+			"do_logout":     "true",
+		})
 		return
 	}
 
@@ -146,28 +169,48 @@ func (a App) HandlerLogin(c *gin.Context) {
 	}
 	checkedUser, ok := a.users.Check(a.ctx, user)
 	if !ok {
+		a.recordLogin(c, audit.ActionLoginFailed, nil, user.Username)
 		msg := "Bad login/password"
-		c.HTML(http.StatusUnauthorized, "login",
-			gin.H{
-				"title":         fmt.Sprintf("Shortlink - %s", msg),
-				"user_session":  userSession,
-				"page_template": "login",
-				"error_message": msg,
-			})
+		a.renderLogin(c, http.StatusUnauthorized, gin.H{
+			"title":         fmt.Sprintf("Shortlink - %s", msg),
+			"user_session":  userSession,
+			"page_template": "login",
+			"error_message": msg,
+		})
+		return
+	}
+	if checkedUser.PendingVerification {
+		msg := "Please confirm your email address first"
+		a.renderLogin(c, http.StatusForbidden, gin.H{
+			"title":         fmt.Sprintf("Shortlink - %s", msg),
+			"user_session":  userSession,
+			"page_template": "login",
+			"error_message": msg,
+		})
+		return
+	}
+	if checkedUser.TOTPEnabled {
+		session.Set(PendingUserKey, checkedUser.Username)
+		session.Set(PendingAtKey, time.Now().UnixNano())
+		if err := session.Save(); err != nil {
+			log.Println("Failed to save session:", err)
+		}
+		c.Redirect(http.StatusFound, "/login/2fa")
 		return
 	}
 	session.Set(UserKey, checkedUser.Username)
+	session.Set(LoginAtKey, time.Now().UnixNano())
 	if err := session.Save(); err != nil {
 		msg := "Failed to save session"
-		c.HTML(http.StatusInternalServerError, "login",
-			gin.H{
-				"title":         fmt.Sprintf("Shortlink - %s", msg),
-				"user_session":  userSession,
-				"page_template": "login",
-				"error_message": msg,
-			})
+		a.renderLogin(c, http.StatusInternalServerError, gin.H{
+			"title":         fmt.Sprintf("Shortlink - %s", msg),
+			"user_session":  userSession,
+			"page_template": "login",
+			"error_message": msg,
+		})
 		return
 	}
+	a.recordLogin(c, audit.ActionLogin, checkedUser, "")
 	c.Set("userID", checkedUser.ID)
 	c.Redirect(http.StatusFound, "/dashboard")
 }
@@ -177,16 +220,19 @@ func (a App) HandlerLogout(c *gin.Context) {
 	userSession := session.Get(UserKey)
 	if userSession == nil {
 		msg := "Please Sign in first"
-		c.HTML(http.StatusBadRequest, "login",
-			gin.H{
-				"title":         fmt.Sprintf("Shortlink - %s", msg),
-				"user_session":  userSession,
-				"page_template": "login",
-				"error_message": msg,
-			})
+		a.renderLogin(c, http.StatusBadRequest, gin.H{
+			"title":         fmt.Sprintf("Shortlink - %s", msg),
+			"user_session":  userSession,
+			"page_template": "login",
+			"error_message": msg,
+		})
 		return
 	}
-	session.Delete(UserKey)
+	user, _ := a.findUser(fmt.Sprint(userSession))
+	a.recordLogin(c, audit.ActionLogout, user, fmt.Sprint(userSession))
+	// Deletes the server-side session and the cookie
+	session.Clear()
+	session.Options(sessions.Options{Path: "/", MaxAge: -1})
 	if err := session.Save(); err != nil {
 		log.Println("Failed to save session:", err)
 		return
@@ -216,11 +262,11 @@ func (a App) HandlerAddDemoData(c *gin.Context) {
 func (a App) HandlerAPIHelp(c *gin.Context) {
 	session := sessions.Default(c)
 	userSession := session.Get(UserKey)
-	c.HTML(http.StatusOK, "api", gin.H{
+	a.html(c, http.StatusOK, "api", gin.H{
 		"title":         "Shortlink - API Help",
 		"h1_text":       "Shortlink - make your links as short as possible!",
 		"user_session":  userSession,
-		"is_admin":      userSession == SessionAdmin,
+		"is_admin":      a.isAdmin(userSession),
 		"page_template": "api",
 	})
 }
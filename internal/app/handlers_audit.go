@@ -0,0 +1,82 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+
+	"github.com/ptsypyshev/shortlink/internal/audit"
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+// requestCtx returns the context with the actor of the request for audit entries,
+// anonymous requests are recorded with the client IP only.
+func (a App) requestCtx(c *gin.Context) context.Context {
+	actor := audit.Actor{IP: c.ClientIP()}
+	if userSession := sessions.Default(c).Get(UserKey); userSession != nil {
+		actor.Username = fmt.Sprint(userSession)
+		if user, err := a.findUser(actor.Username); err == nil {
+			actor.UserID = user.ID
+		}
+	}
+	return audit.WithActor(a.ctx, actor)
+}
+
+// recordLogin records a login, logout or failed login of user, username is recorded for unknown users.
+func (a App) recordLogin(c *gin.Context, action string, user *models.User, username string) {
+	actor := audit.Actor{Username: username, IP: c.ClientIP()}
+	var targetID int
+	if user != nil {
+		actor.UserID, actor.Username = user.ID, user.Username
+		targetID = user.ID
+	}
+	a.audit.Record(audit.WithActor(a.ctx, actor), action, models.UserType, targetID, nil, nil)
+}
+
+// GetAuditLog returns audit entries filtered by actor_id, action, target_type, target_id
+// and the RFC 3339 time range from/to, newest first, paginated with limit and offset.
+func (a App) GetAuditLog(c *gin.Context) {
+	var filter models.AuditFilter
+	var err error
+	for key, dst := range map[string]*int{
+		"actor_id":  &filter.ActorID,
+		"target_id": &filter.TargetID,
+		"limit":     &filter.Limit,
+		"offset":    &filter.Offset,
+	} {
+		if value := c.Query(key); value != "" {
+			if *dst, err = strconv.Atoi(value); err != nil || *dst < 0 {
+				msg := fmt.Sprintf(`bad %s: %s`, key, value)
+				c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+				return
+			}
+		}
+	}
+	for key, dst := range map[string]*time.Time{
+		"from": &filter.From,
+		"to":   &filter.To,
+	} {
+		if value := c.Query(key); value != "" {
+			if *dst, err = time.Parse(time.RFC3339, value); err != nil {
+				msg := fmt.Sprintf(`bad %s: %s`, key, value)
+				c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+				return
+			}
+		}
+	}
+	filter.Action = c.Query("action")
+	filter.TargetType = c.Query("target_type")
+
+	entries, total, err := a.audit.Search(a.ctx, filter)
+	if err != nil {
+		msg := fmt.Sprintf(`get error: %s`, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"found": entries, "total": total})
+}
@@ -0,0 +1,178 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ptsypyshev/shortlink/internal/db/pgdb"
+	"github.com/ptsypyshev/shortlink/internal/models"
+	"github.com/ptsypyshev/shortlink/internal/repositories/objrepo"
+)
+
+func (a App) GetCollections(c *gin.Context) {
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	collections, err := a.collections.Search(a.ctx, user.ID)
+	if err != nil {
+		msg := fmt.Sprintf(`get error: %s`, err)
+		c.JSON(collectionErrorStatus(err), gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"found": collections})
+}
+
+func (a App) GetCollection(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		msg := fmt.Sprintf(`bad id: %s`, c.Param("id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	collection, err := a.collections.Read(a.ctx, id, user.ID)
+	if err != nil {
+		msg := fmt.Sprintf(`get error: %s`, err)
+		c.JSON(collectionErrorStatus(err), gin.H{"error": msg})
+		return
+	}
+	a.setShortURLs(collection.Links)
+	c.JSON(http.StatusOK, gin.H{"read": collection})
+}
+
+func (a App) CreateCollection(c *gin.Context) {
+	var collection models.Collection
+	if err := c.BindJSON(&collection); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	collection.OwnerID = user.ID
+	newCollection, err := a.collections.Create(a.ctx, &collection)
+	if err != nil {
+		msg := fmt.Sprintf(`create collection error: %s`, err)
+		c.JSON(collectionErrorStatus(err), gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"created": newCollection})
+}
+
+func (a App) UpdateCollection(c *gin.Context) {
+	var collection models.Collection
+	if err := c.BindJSON(&collection); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	collection.OwnerID = user.ID
+	updatedCollection, err := a.collections.Update(a.ctx, &collection)
+	if err != nil {
+		msg := fmt.Sprintf(`update collection error: %s`, err)
+		c.JSON(collectionErrorStatus(err), gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"updated": updatedCollection})
+}
+
+func (a App) DeleteCollection(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		msg := fmt.Sprintf(`bad id: %s`, c.Param("id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	deletedCollection, err := a.collections.Delete(a.ctx, id, user.ID)
+	if err != nil {
+		msg := fmt.Sprintf(`delete collection error: %s`, err)
+		c.JSON(collectionErrorStatus(err), gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deleted": deletedCollection})
+}
+
+func (a App) AddCollectionLink(c *gin.Context) {
+	id, linkID, ok := collectionLinkParams(c)
+	if !ok {
+		return
+	}
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	collection, err := a.collections.AddLink(a.ctx, id, linkID, user.ID)
+	if err != nil {
+		msg := fmt.Sprintf(`add link to collection error: %s`, err)
+		c.JSON(collectionErrorStatus(err), gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"updated": collection})
+}
+
+func (a App) RemoveCollectionLink(c *gin.Context) {
+	id, linkID, ok := collectionLinkParams(c)
+	if !ok {
+		return
+	}
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	collection, err := a.collections.RemoveLink(a.ctx, id, linkID, user.ID)
+	if err != nil {
+		msg := fmt.Sprintf(`remove link from collection error: %s`, err)
+		c.JSON(collectionErrorStatus(err), gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"updated": collection})
+}
+
+func collectionLinkParams(c *gin.Context) (id, linkID int, ok bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		msg := fmt.Sprintf(`bad id: %s`, c.Param("id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return 0, 0, false
+	}
+	linkID, err = strconv.Atoi(c.Param("link_id"))
+	if err != nil {
+		msg := fmt.Sprintf(`bad link id: %s`, c.Param("link_id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return 0, 0, false
+	}
+	return id, linkID, true
+}
+
+func collectionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, objrepo.ErrBadCollection):
+		return http.StatusBadRequest
+	case errors.Is(err, pgdb.ErrNotFound):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
@@ -1,14 +1,21 @@
 package app
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 
+	"github.com/ptsypyshev/shortlink/internal/db/pgdb"
 	"github.com/ptsypyshev/shortlink/internal/models"
+	"github.com/ptsypyshev/shortlink/internal/repositories/objrepo"
+	"github.com/ptsypyshev/shortlink/internal/targeting"
 )
 
 const DefaultUserID = 1
@@ -19,35 +26,121 @@ func (a App) CreateLink(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err})
 		return
 	}
-	if link.OwnerID == 0 {
-		session := sessions.Default(c)
-		userSession := session.Get(UserKey)
-		if userSession == nil {
-			link.OwnerID = DefaultUserID
-		} else {
-			user, err := a.users.Search(a.ctx, "username", userSession)
-			if err != nil {
-				fmt.Printf("cannot find user with name %s\n", userSession)
-				link.OwnerID = DefaultUserID
+	// The owner is the caller, anonymous links belong to the default user
+	link.OwnerID = DefaultUserID
+	if sessions.Default(c).Get(UserKey) != nil {
+		user, err := a.currentUser(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		link.OwnerID = user.ID
+		// Links without a workspace go to the personal workspace of the owner
+		if link.WorkspaceID == 0 {
+			if link.WorkspaceID, err = a.workspaces.Personal(a.ctx, user.ID); err != nil {
+				msg := fmt.Sprintf(`get error: %s`, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+				return
 			}
-			link.OwnerID = user[0].ID
+		}
+	}
+	// Anonymous callers can only create links in the personal workspace of the default user
+	if link.WorkspaceID != 0 {
+		if _, ok := a.workspaceAccess(c, link.WorkspaceID, models.WorkspaceEditor); !ok {
+			return
 		}
 	}
 
-	newLink, err := a.links.Create(a.ctx, &link)
+	domain, err := a.config.ShortDomainKey(link.Domain)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	link.Domain = domain
+	// Health is only set by the background checker
+	link.Health = nil
+	if !models.ValidPassthrough(link.Passthrough) {
+		msg := fmt.Sprintf(`bad passthrough: %s`, link.Passthrough)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if link.Targeting, err = objrepo.NormalizeTargeting(link.Targeting); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if link.Variants, err = objrepo.NormalizeVariants(link.Variants); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := objrepo.ValidateLinkPassword(link.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if link.Schedule, err = objrepo.NormalizeSchedule(link.Schedule, a.location); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := a.requestCtx(c)
+	if a.config.LinkDedup {
+		a.createDeduplicatedLink(c, &link)
+		return
+	}
+	newLink, err := a.links.Create(ctx, &link)
 	if err != nil {
 		msg := fmt.Sprintf(`create link error: %s`, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 		return
 	}
 	longLinkID := newLink.ID
-	shortlink, err := a.shortlinks.Create(a.ctx, longLinkID)
+	shortlink, err := a.shortlinks.Create(ctx, longLinkID, domain, "")
 	if err != nil {
 		msg := fmt.Sprintf(`create shortlink error: %s`, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"created": shortlink.Token})
+	a.metadata.Enqueue(newLink.ID, newLink.LongLink)
+	newLink.ShortLink = a.config.ShortURL(domain, shortlink.Token)
+	a.dispatcher.Emit(models.EventLinkCreated, newLink, nil)
+	c.JSON(http.StatusOK, gin.H{"created": newLink.ShortLink})
+}
+
+// createDeduplicatedLink responds with the active token of the existing link of the owner to the same destination
+// and reused=true, a new token is added to the existing link if it has no active token on the requested domain.
+func (a App) createDeduplicatedLink(c *gin.Context, link *models.Link) {
+	ctx := a.requestCtx(c)
+	newLink, reused, err := a.links.CreateDeduplicated(ctx, link)
+	if err != nil {
+		msg := fmt.Sprintf(`create link error: %s`, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	if reused {
+		tokens, err := a.shortlinks.Tokens(a.ctx, newLink.ID)
+		if err != nil {
+			msg := fmt.Sprintf(`get error: %s`, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+		for _, token := range tokens {
+			if token.RetiredAt == nil && token.Domain == link.Domain {
+				c.JSON(http.StatusOK, gin.H{"created": a.config.ShortURL(token.Domain, token.Token), "reused": true})
+				return
+			}
+		}
+	}
+	shortlink, err := a.shortlinks.Create(ctx, newLink.ID, link.Domain, "")
+	if err != nil {
+		msg := fmt.Sprintf(`create shortlink error: %s`, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	if !reused {
+		a.metadata.Enqueue(newLink.ID, newLink.LongLink)
+		newLink.ShortLink = a.config.ShortURL(link.Domain, shortlink.Token)
+		a.dispatcher.Emit(models.EventLinkCreated, newLink, nil)
+	}
+	c.JSON(http.StatusOK, gin.H{"created": a.config.ShortURL(link.Domain, shortlink.Token), "reused": reused})
 }
 
 func (a App) GetLink(c *gin.Context) {
@@ -57,12 +150,15 @@ func (a App) GetLink(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
 		return
 	}
-	link, err := a.links.Read(a.ctx, id)
+	link, err := a.links.ReadWithTags(a.ctx, id)
 	if err != nil {
 		msg := fmt.Sprintf(`get error: %s`, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 		return
 	}
+	if _, ok := a.workspaceAccess(c, link.WorkspaceID, models.WorkspaceViewer); !ok {
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"read": link})
 }
 
@@ -73,12 +169,43 @@ func (a App) UpdateLink(c *gin.Context) {
 		return
 	}
 	id := link.ID
-	updatedLink, err := a.links.Update(a.ctx, id, &link)
+	if !models.ValidPassthrough(link.Passthrough) {
+		msg := fmt.Sprintf(`bad passthrough: %s`, link.Passthrough)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	// Omitted rules and variants are kept unchanged, an empty list removes them
+	rules, err := objrepo.NormalizeTargeting(link.Targeting)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	link.Targeting = rules
+	if link.Variants, err = objrepo.NormalizeVariants(link.Variants); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := objrepo.ValidateLinkPassword(link.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if link.Schedule, err = objrepo.NormalizeSchedule(link.Schedule, a.location); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !a.linkAccess(c, id, models.WorkspaceEditor) {
+		return
+	}
+	updatedLink, err := a.links.Update(a.requestCtx(c), id, &link)
 	if err != nil {
 		msg := fmt.Sprintf(`update link error: %s`, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 		return
 	}
+	if link.LongLink != "" {
+		a.metadata.Enqueue(updatedLink.ID, updatedLink.LongLink)
+	}
+	a.dispatcher.Emit(models.EventLinkUpdated, updatedLink, nil)
 	c.JSON(http.StatusOK, gin.H{"updated": updatedLink})
 }
 
@@ -89,15 +216,46 @@ func (a App) DeleteLink(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
 		return
 	}
-	deletedLink, err := a.links.Delete(a.ctx, id)
+	if !a.linkAccess(c, id, models.WorkspaceEditor) {
+		return
+	}
+	deletedLink, err := a.links.Delete(a.requestCtx(c), id)
 	if err != nil {
 		msg := fmt.Sprintf(`delete link error: %s`, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 		return
 	}
+	a.dispatcher.Emit(models.EventLinkDeleted, deletedLink, nil)
 	c.JSON(http.StatusOK, gin.H{"deleted": deletedLink})
 }
 
+type transferRequest struct {
+	NewOwnerID int   `json:"new_owner_id"`
+	LinkIDs    []int `json:"link_ids"`
+}
+
+// TransferLinks moves the listed links (all links if link_ids is empty) of the user to another user.
+func (a App) TransferLinks(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		msg := fmt.Sprintf(`bad id: %s`, c.Param("id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	var req transferRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	count, err := a.links.Transfer(a.requestCtx(c), id, req.NewOwnerID, req.LinkIDs)
+	if err != nil {
+		msg := fmt.Sprintf(`transfer links error: %s`, err)
+		c.JSON(ownershipErrorStatus(err), gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"updated": count})
+}
+
 func (a App) SearchLinks(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -105,42 +263,284 @@ func (a App) SearchLinks(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
 		return
 	}
+	workspaceID, err := a.workspaces.Personal(a.ctx, id)
+	if err != nil {
+		msg := fmt.Sprintf(`no links found: %s`, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+		return
+	}
+	if _, ok := a.workspaceAccess(c, workspaceID, models.WorkspaceViewer); !ok {
+		return
+	}
+	a.searchWorkspaceLinks(c, workspaceID)
+}
 
-	foundLinks, err := a.links.Search(a.ctx, "owner_id", id)
+// searchWorkspaceLinks responds with links of the workspace filtered by the tag and q query parameters.
+func (a App) searchWorkspaceLinks(c *gin.Context, workspaceID int) {
+	var (
+		foundLinks []*models.Link
+		err        error
+	)
+	tag, text := c.Query("tag"), c.Query("q")
+	if tag != "" || text != "" {
+		foundLinks, err = a.links.SearchByFilter(a.ctx, workspaceID, tag, text)
+	} else {
+		foundLinks, err = a.links.Search(a.ctx, "workspace_id", workspaceID)
+	}
 	if err != nil {
 		msg := fmt.Sprintf(`no links found: %s`, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 		return
 	}
-
+	a.setShortURLs(foundLinks)
 	c.JSON(http.StatusOK, gin.H{"found": foundLinks})
 }
 
+// setShortURLs replaces tokens of the links with full short URLs.
+func (a App) setShortURLs(links []*models.Link) {
+	for _, link := range links {
+		if link.ShortLink != "" {
+			link.ShortLink = a.config.ShortURL(link.Domain, link.ShortLink)
+		}
+	}
+}
+
+// GetDomains returns the short domains available for new links.
+func (a App) GetDomains(c *gin.Context) {
+	domains := make([]gin.H, 0, len(a.config.ShortDomains))
+	for domain, baseURL := range a.config.ShortDomains {
+		domains = append(domains, gin.H{
+			"domain":   domain,
+			"base_url": baseURL,
+			"default":  domain == a.config.DefaultShortDomain,
+		})
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		return domains[i]["domain"].(string) < domains[j]["domain"].(string)
+	})
+	c.JSON(http.StatusOK, gin.H{"found": domains})
+}
+
+type tokenRequest struct {
+	Domain string      `json:"domain"`
+	Label  string      `json:"label"`
+	UTM    *models.UTM `json:"utm"`
+}
+
+// GetLinkTokens returns all tokens of the link with their clicks, retired tokens included.
+func (a App) GetLinkTokens(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		msg := fmt.Sprintf(`bad id: %s`, c.Param("id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if !a.linkAccess(c, id, models.WorkspaceViewer) {
+		return
+	}
+	tokens, err := a.shortlinks.Tokens(a.ctx, id)
+	if err != nil {
+		msg := fmt.Sprintf(`get error: %s`, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	for _, token := range tokens {
+		token.ShortURL = a.config.ShortURL(token.Domain, token.Token)
+	}
+	c.JSON(http.StatusOK, gin.H{"found": tokens})
+}
+
+// AddLinkToken adds one more token to the link, e.g. for a separate campaign channel.
+func (a App) AddLinkToken(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		msg := fmt.Sprintf(`bad id: %s`, c.Param("id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	var req tokenRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	domain, err := a.config.ShortDomainKey(req.Domain)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !a.linkAccess(c, id, models.WorkspaceEditor) {
+		return
+	}
+	token, err := a.shortlinks.Create(a.requestCtx(c), id, domain, req.Label)
+	if err != nil {
+		msg := fmt.Sprintf(`create shortlink error: %s`, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	if !req.UTM.IsZero() {
+		if token, err = a.shortlinks.SetUTM(a.requestCtx(c), id, token.ID, req.UTM); err != nil {
+			msg := fmt.Sprintf(`set utm error: %s`, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+	}
+	token.ShortURL = a.config.ShortURL(token.Domain, token.Token)
+	c.JSON(http.StatusOK, gin.H{"created": token})
+}
+
+// UpdateLinkToken changes UTM parameters of the token, empty parameters fall back to parameters of the link.
+func (a App) UpdateLinkToken(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		msg := fmt.Sprintf(`bad id: %s`, c.Param("id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	tokenID, err := strconv.Atoi(c.Param("token_id"))
+	if err != nil {
+		msg := fmt.Sprintf(`bad token id: %s`, c.Param("token_id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	var req tokenRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	if !a.linkAccess(c, id, models.WorkspaceEditor) {
+		return
+	}
+	token, err := a.shortlinks.SetUTM(a.requestCtx(c), id, tokenID, req.UTM)
+	if err != nil {
+		msg := fmt.Sprintf(`update token error: %s`, err)
+		c.JSON(tokenErrorStatus(err), gin.H{"error": msg})
+		return
+	}
+	token.ShortURL = a.config.ShortURL(token.Domain, token.Token)
+	c.JSON(http.StatusOK, gin.H{"updated": token})
+}
+
+// RetireLinkToken stops redirects by the token, the token is not given to other links.
+func (a App) RetireLinkToken(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		msg := fmt.Sprintf(`bad id: %s`, c.Param("id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	tokenID, err := strconv.Atoi(c.Param("token_id"))
+	if err != nil {
+		msg := fmt.Sprintf(`bad token id: %s`, c.Param("token_id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if !a.linkAccess(c, id, models.WorkspaceEditor) {
+		return
+	}
+	token, err := a.shortlinks.Retire(a.requestCtx(c), id, tokenID)
+	if err != nil {
+		msg := fmt.Sprintf(`retire token error: %s`, err)
+		c.JSON(tokenErrorStatus(err), gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deleted": token})
+}
+
+func tokenErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, objrepo.ErrLastToken):
+		return http.StatusBadRequest
+	case errors.Is(err, pgdb.ErrNotFound):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// linkAccess checks that the current user has at least the required role in the workspace of the link.
+func (a App) linkAccess(c *gin.Context, id int, required string) bool {
+	link, err := a.links.Read(a.ctx, id)
+	if err != nil {
+		msg := fmt.Sprintf(`read link error: %s`, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+		return false
+	}
+	_, ok := a.workspaceAccess(c, link.WorkspaceID, required)
+	return ok
+}
+
 func (a App) HandlerShortLink(c *gin.Context) {
-	value := c.Param("token")
-	shortlinks, err := a.shortlinks.Search(a.ctx, "token", value)
+	domain := a.config.ShortDomainByHost(c.Request.Host)
+	shortlink, err := a.shortlinks.Resolve(a.ctx, domain, c.Param("token"))
+	if errors.Is(err, pgdb.ErrNotFound) {
+		a.HandlerNoRoute(c)
+		return
+	}
 	if err != nil {
 		msg := fmt.Sprintf(`get error: %s`, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 		return
 	}
-	if len(shortlinks) != 1 {
+	// Tokens of purged links are reserved without a link
+	if shortlink.LongLinkID == 0 || shortlink.RetiredAt != nil {
 		a.HandlerNoRoute(c)
 		return
 	}
-	linkID := shortlinks[0].LongLinkID
+	linkID := shortlink.LongLinkID
 	link, err := a.links.Read(a.ctx, linkID)
+	if errors.Is(err, pgdb.ErrNotFound) {
+		// The link is in the trash
+		a.HandlerNoRoute(c)
+		return
+	}
 	if err != nil {
 		msg := fmt.Sprintf(`read link error: %s`, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 		return
 	}
+	// The path after the token is only served by links forwarding it
+	extraPath := c.Param("path")
+	now := time.Now()
+	if !link.IsActive || !link.Schedule.Active(now) ||
+		(strings.Trim(extraPath, "/") != "" && link.Passthrough != models.PassthroughPath) {
+		a.HandlerNoRoute(c)
+		return
+	}
+	if link.Protected && !a.unlockLink(c, link) {
+		return
+	}
+	if err := a.links.IncrementClicks(a.ctx, linkID); err != nil {
+		msg := fmt.Sprintf(`count click error: %s`, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
 	link.ClickCounter++
-	link, err = a.links.Update(a.ctx, linkID, link)
+	// A lost click of the token does not break the redirect
+	_ = a.shortlinks.CountClick(a.ctx, shortlink.ID)
+	stored := *link
+	variantName := ""
+	if destination := link.Schedule.Destination(now); destination != "" {
+		link.LongLink = destination
+	}
+	rule := -1
+	if len(link.Targeting) > 0 {
+		link.LongLink, rule = targeting.Destination(link, a.targetingRequest(c))
+	}
+	// Targeted clicks do not take part in the split
+	if rule < 0 && len(link.Variants) > 0 {
+		if variant := a.pickVariant(c, link); variant != nil {
+			link.LongLink, variantName = variant.Destination, variant.Name
+			_ = a.links.CountVariantClick(a.ctx, variant.ID)
+		}
+	}
+	destination, err := link.Destination(extraPath, c.Request.URL.Query())
+	if err == nil {
+		destination, err = link.UTM.Merge(shortlink.UTM).Apply(destination)
+	}
 	if err != nil {
-		msg := fmt.Sprintf(`update link error: %s`, err)
+		msg := fmt.Sprintf(`build destination error: %s`, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 		return
 	}
-	c.Redirect(http.StatusFound, link.LongLink)
+	a.emitClick(c, &stored, shortlink, destination, variantName)
+	c.Redirect(http.StatusFound, destination)
 }
@@ -0,0 +1,166 @@
+package app
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+
+	"github.com/ptsypyshev/shortlink/internal/audit"
+	"github.com/ptsypyshev/shortlink/internal/oidc"
+	"github.com/ptsypyshev/shortlink/internal/repositories/objrepo"
+)
+
+const (
+	oidcStateKey    = "oidc_state"
+	oidcNonceKey    = "oidc_nonce"
+	oidcVerifierKey = "oidc_verifier"
+)
+
+var errSSOFailed = errors.New("single sign-on failed, please try again")
+
+// HandlerOIDCLogin starts the authorization code flow with PKCE, the state, nonce and verifier
+// are kept in the session until the callback.
+func (a App) HandlerOIDCLogin(c *gin.Context) {
+	session := sessions.Default(c)
+	if session.Get(UserKey) != nil {
+		c.Redirect(http.StatusFound, "/dashboard")
+		return
+	}
+	state, err := oidc.RandomString()
+	if err != nil {
+		a.oidcFailed(c, err)
+		return
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		a.oidcFailed(c, err)
+		return
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		a.oidcFailed(c, err)
+		return
+	}
+	authURL, err := a.oidc.AuthCodeURL(c, state, nonce, challenge)
+	if err != nil {
+		a.oidcFailed(c, err)
+		return
+	}
+	session.Set(oidcStateKey, state)
+	session.Set(oidcNonceKey, nonce)
+	session.Set(oidcVerifierKey, verifier)
+	if err := session.Save(); err != nil {
+		a.oidcFailed(c, err)
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+func (a App) HandlerOIDCCallback(c *gin.Context) {
+	session := sessions.Default(c)
+	state, _ := session.Get(oidcStateKey).(string)
+	nonce, _ := session.Get(oidcNonceKey).(string)
+	verifier, _ := session.Get(oidcVerifierKey).(string)
+	session.Delete(oidcStateKey)
+	session.Delete(oidcNonceKey)
+	session.Delete(oidcVerifierKey)
+	if err := session.Save(); err != nil {
+		log.Println("Failed to save session:", err)
+	}
+
+	if errCode := c.Query("error"); errCode != "" {
+		a.oidcFailed(c, fmt.Errorf("provider returned error %s: %s", errCode, c.Query("error_description")))
+		return
+	}
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(c.Query("state"))) != 1 {
+		a.oidcFailed(c, fmt.Errorf("state mismatch"))
+		return
+	}
+	claims, err := a.oidc.Exchange(c, c.Query("code"), verifier, nonce)
+	if err != nil {
+		a.oidcFailed(c, err)
+		return
+	}
+	user, err := a.users.LoginExternal(a.requestCtx(c), objrepo.ExternalIdentity{
+		Issuer:        claims.Issuer,
+		Subject:       claims.Subject,
+		Username:      claims.PreferredUsername,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		FirstName:     claims.GivenName,
+		LastName:      claims.FamilyName,
+		Role:          a.config.OIDCRole(claims.Strings(a.config.OIDCGroupsClaim)),
+	})
+	if errors.Is(err, objrepo.ErrIdentityConflict) {
+		a.renderLogin(c, http.StatusConflict, gin.H{
+			"title":         "Shortlink - Single sign-on",
+			"page_template": "login",
+			"error_message": "An account with this email already exists, but the email is not verified",
+		})
+		return
+	}
+	if err != nil {
+		a.oidcFailed(c, err)
+		return
+	}
+	if !user.UserStatus {
+		a.renderLogin(c, http.StatusForbidden, gin.H{
+			"title":         "Shortlink - Single sign-on",
+			"page_template": "login",
+			"error_message": "Your account is disabled",
+		})
+		return
+	}
+	if user.TOTPEnabled {
+		session.Set(PendingUserKey, user.Username)
+		session.Set(PendingAtKey, time.Now().UnixNano())
+		if err := session.Save(); err != nil {
+			log.Println("Failed to save session:", err)
+		}
+		c.Redirect(http.StatusFound, "/login/2fa")
+		return
+	}
+	session.Set(UserKey, user.Username)
+	session.Set(LoginAtKey, time.Now().UnixNano())
+	if err := session.Save(); err != nil {
+		a.oidcFailed(c, err)
+		return
+	}
+	a.recordLogin(c, audit.ActionLogin, user, "")
+	c.Redirect(http.StatusFound, "/dashboard")
+}
+
+func (a App) oidcFailed(c *gin.Context, err error) {
+	a.logger.Error(fmt.Sprintf(`oidc login failed: %s`, err))
+	a.renderLogin(c, http.StatusBadGateway, gin.H{
+		"title":         "Shortlink - Single sign-on",
+		"page_template": "login",
+		"error_message": errSSOFailed.Error(),
+	})
+}
+
+// renderLogin renders the login page with the available sign in methods.
+func (a App) renderLogin(c *gin.Context, code int, h gin.H) {
+	h["local_login"] = a.config.LocalLoginEnabled
+	if a.oidc != nil {
+		h["oidc_name"] = a.config.OIDCProviderName
+	}
+	a.html(c, code, "login", h)
+}
+
+// LocalLoginRequired hides password based sign in, registration and password reset
+// when only single sign-on is allowed.
+func (a App) LocalLoginRequired(c *gin.Context) {
+	if !a.config.LocalLoginEnabled {
+		a.HandlerNoRoute(c)
+		c.Abort()
+		return
+	}
+	c.Next()
+}
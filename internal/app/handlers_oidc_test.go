@@ -0,0 +1,312 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/ptsypyshev/shortlink/internal/auth"
+	"github.com/ptsypyshev/shortlink/internal/models"
+	"github.com/ptsypyshev/shortlink/internal/oidc"
+	"github.com/ptsypyshev/shortlink/internal/repositories/objrepo"
+)
+
+// identityStore keeps users and identities in memory, other storage methods are not used by the sign in.
+type identityStore struct {
+	objrepo.NonGenericStorage
+	users      []*models.User
+	identities map[string]int
+	audit      []*models.AuditEntry
+}
+
+func (s *identityStore) SearchUsers(_ context.Context, field, value any) ([]*models.User, error) {
+	found := make([]*models.User, 0)
+	for _, user := range s.users {
+		if field == "username" && user.Username == value || field == "email" && user.Email == value {
+			found = append(found, user)
+		}
+	}
+	return found, nil
+}
+
+func (s *identityStore) FindUserByIdentity(_ context.Context, issuer, subject string) (*models.User, error) {
+	id, ok := s.identities[issuer+" "+subject]
+	if !ok {
+		return nil, nil
+	}
+	return s.user(id), nil
+}
+
+func (s *identityStore) CreateUserWithIdentity(_ context.Context, user *models.User, issuer, subject string) (int, error) {
+	created := *user
+	created.ID = len(s.users) + 100
+	s.users = append(s.users, &created)
+	s.identities[issuer+" "+subject] = created.ID
+	return created.ID, nil
+}
+
+func (s *identityStore) LinkUserIdentity(_ context.Context, id int, issuer, subject string) error {
+	s.identities[issuer+" "+subject] = id
+	return nil
+}
+
+func (s *identityStore) SetUserRole(_ context.Context, id int, role string) error {
+	s.user(id).Role = role
+	return nil
+}
+
+func (s *identityStore) CreateAuditEntry(_ context.Context, entry *models.AuditEntry) error {
+	s.audit = append(s.audit, entry)
+	return nil
+}
+
+func (s *identityStore) user(id int) *models.User {
+	for _, user := range s.users {
+		if user.ID == id {
+			return user
+		}
+	}
+	return nil
+}
+
+type oidcTest struct {
+	idp    *oidc.StubIdP
+	store  *identityStore
+	app    *httptest.Server
+	client *http.Client
+}
+
+// newOIDCTest starts the stub IdP and the application routes of single sign-on backed by store.
+func newOIDCTest(t *testing.T, roleMapping map[string]string, store *identityStore, users ...oidc.StubUser) *oidcTest {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	var idp *oidc.StubIdP
+	idpSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idp.ServeHTTP(w, r)
+	}))
+	t.Cleanup(idpSrv.Close)
+	var err error
+	if idp, err = oidc.NewStubIdP(idpSrv.URL, "shortlink", "secret", users...); err != nil {
+		t.Fatal(err)
+	}
+	if store.identities == nil {
+		store.identities = make(map[string]int)
+	}
+
+	router := gin.New()
+	appSrv := httptest.NewServer(router)
+	t.Cleanup(appSrv.Close)
+	logger := zap.NewNop()
+	a := App{
+		ctx: context.Background(),
+		config: Config{
+			OIDCGroupsClaim: DefaultOIDCGroupsClaim,
+			OIDCRoleMapping: roleMapping,
+		},
+		users: *objrepo.UsersNew(nil, store, nil, auth.PasswordPolicy{}, logger),
+		audit: *objrepo.AuditNew(store, logger),
+		oidc: oidc.NewProvider(oidc.Config{
+			IssuerURL:    idpSrv.URL,
+			ClientID:     "shortlink",
+			ClientSecret: "secret",
+			RedirectURL:  appSrv.URL + oidcCallbackPath,
+		}, idpSrv.Client()),
+		logger: logger,
+	}
+	router.SetHTMLTemplate(template.Must(template.New("login").Parse(`{{.error_message}}`)))
+	router.Use(sessions.Sessions("session", cookie.NewStore([]byte("test"))))
+	router.GET("/login/oidc", a.HandlerOIDCLogin)
+	router.GET(oidcCallbackPath, a.HandlerOIDCCallback)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{
+		Jar:           jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	return &oidcTest{idp: idp, store: store, app: appSrv, client: client}
+}
+
+// signIn starts the sign in as the IdP user with the username and returns the callback URL
+// the IdP redirects to.
+func (o *oidcTest) signIn(t *testing.T, username string) *url.URL {
+	t.Helper()
+	authURL := o.redirect(t, o.app.URL+"/login/oidc")
+	return o.redirect(t, authURL.String()+"&login_hint="+url.QueryEscape(username))
+}
+
+// callback follows the redirect of the IdP to the application and returns its response.
+func (o *oidcTest) callback(t *testing.T, callbackURL *url.URL) *http.Response {
+	t.Helper()
+	resp, err := o.client.Get(callbackURL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func (o *oidcTest) redirect(t *testing.T, rawURL string) *url.URL {
+	t.Helper()
+	resp, err := o.client.Get(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("GET %s: status = %d, want %d", rawURL, resp.StatusCode, http.StatusFound)
+	}
+	location, err := resp.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location
+}
+
+func TestOIDCCallbackProvisionsUser(t *testing.T) {
+	store := &identityStore{}
+	o := newOIDCTest(t, map[string]string{"admins": models.RoleAdmin, "staff": models.RoleUser}, store, oidc.StubUser{
+		Subject: "sub-alice", Username: "alice", Email: "alice@example.loc", EmailVerified: true,
+		GivenName: "Alice", Groups: []string{"staff", "admins"},
+	})
+	resp := o.callback(t, o.signIn(t, "alice"))
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "/dashboard" {
+		t.Fatalf("callback: status = %d, location = %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if len(store.users) != 1 {
+		t.Fatalf("%d users are provisioned, want 1", len(store.users))
+	}
+	user := store.users[0]
+	if user.Username != "alice" || user.Email != "alice@example.loc" || user.FirstName != "Alice" ||
+		user.Role != models.RoleAdmin || !user.UserStatus {
+		t.Errorf("unexpected provisioned user %+v", user)
+	}
+	if id := store.identities[o.idp.Issuer+" sub-alice"]; id != user.ID {
+		t.Errorf("identity is bound to user %d, want %d", id, user.ID)
+	}
+
+	// The identity signs in to the same user next time
+	o.client.Jar, _ = cookiejar.New(nil)
+	resp = o.callback(t, o.signIn(t, "alice"))
+	if resp.StatusCode != http.StatusFound || len(store.users) != 1 {
+		t.Errorf("second sign in: status = %d, %d users", resp.StatusCode, len(store.users))
+	}
+}
+
+func TestOIDCCallbackSuffixesTakenUsername(t *testing.T) {
+	store := &identityStore{users: []*models.User{{ID: 1, Username: "alice", Role: models.RoleUser}}}
+	o := newOIDCTest(t, nil, store, oidc.StubUser{Subject: "sub-alice", Username: "alice"})
+	if resp := o.callback(t, o.signIn(t, "alice")); resp.StatusCode != http.StatusFound {
+		t.Fatalf("callback: status = %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+	if len(store.users) != 2 || store.users[1].Username != "alice2" || store.users[1].Role != models.RoleUser {
+		t.Errorf("unexpected provisioned user %+v", store.users[len(store.users)-1])
+	}
+}
+
+func TestOIDCCallbackLinksVerifiedEmail(t *testing.T) {
+	local := &models.User{ID: 7, Username: "alice.local", Email: "alice@example.loc", Role: models.RoleUser, UserStatus: true}
+	store := &identityStore{users: []*models.User{local}}
+	o := newOIDCTest(t, nil, store, oidc.StubUser{
+		Subject: "sub-alice", Username: "alice", Email: "alice@example.loc", EmailVerified: true,
+	})
+	if resp := o.callback(t, o.signIn(t, "alice")); resp.StatusCode != http.StatusFound {
+		t.Fatalf("callback: status = %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+	if len(store.users) != 1 {
+		t.Errorf("%d users, the local account is not linked", len(store.users))
+	}
+	if id := store.identities[o.idp.Issuer+" sub-alice"]; id != local.ID {
+		t.Errorf("identity is bound to user %d, want %d", id, local.ID)
+	}
+}
+
+func TestOIDCCallbackRejectsUnverifiedEmail(t *testing.T) {
+	local := &models.User{ID: 7, Username: "bob.local", Email: "bob@example.loc", Role: models.RoleUser, UserStatus: true}
+	store := &identityStore{users: []*models.User{local}}
+	o := newOIDCTest(t, nil, store, oidc.StubUser{Subject: "sub-bob", Username: "bob", Email: "bob@example.loc"})
+	if resp := o.callback(t, o.signIn(t, "bob")); resp.StatusCode != http.StatusConflict {
+		t.Errorf("callback: status = %d, want %d", resp.StatusCode, http.StatusConflict)
+	}
+	if len(store.identities) != 0 || len(store.users) != 1 {
+		t.Errorf("unverified email is linked: identities %v, %d users", store.identities, len(store.users))
+	}
+}
+
+func TestOIDCCallbackAppliesRoleMapping(t *testing.T) {
+	admin := &models.User{ID: 7, Username: "carol", Role: models.RoleAdmin, UserStatus: true}
+	store := &identityStore{users: []*models.User{admin}}
+	o := newOIDCTest(t, map[string]string{"admins": models.RoleAdmin}, store, oidc.StubUser{
+		Subject: "sub-carol", Username: "carol", Groups: []string{"staff"},
+	})
+	store.identities[o.idp.Issuer+" sub-carol"] = admin.ID
+	if resp := o.callback(t, o.signIn(t, "carol")); resp.StatusCode != http.StatusFound {
+		t.Fatalf("callback: status = %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+	if admin.Role != models.RoleUser {
+		t.Errorf("role = %q, the IdP groups no longer grant %q", admin.Role, models.RoleAdmin)
+	}
+}
+
+func TestOIDCCallbackRejectsStateMismatch(t *testing.T) {
+	store := &identityStore{}
+	o := newOIDCTest(t, nil, store, oidc.StubUser{Subject: "sub-alice", Username: "alice"})
+	callbackURL := o.signIn(t, "alice")
+	q := callbackURL.Query()
+	q.Set("state", "forged")
+	callbackURL.RawQuery = q.Encode()
+	if resp := o.callback(t, callbackURL); resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("callback: status = %d, want %d", resp.StatusCode, http.StatusBadGateway)
+	}
+	if len(store.users) != 0 {
+		t.Errorf("%d users are provisioned with a forged state", len(store.users))
+	}
+}
+
+func TestOIDCCallbackRequiresLoginSession(t *testing.T) {
+	store := &identityStore{}
+	o := newOIDCTest(t, nil, store, oidc.StubUser{Subject: "sub-alice", Username: "alice"})
+	callbackURL := o.signIn(t, "alice")
+	// The callback in another browser has no state, nonce and verifier
+	o.client.Jar, _ = cookiejar.New(nil)
+	if resp := o.callback(t, callbackURL); resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("callback: status = %d, want %d", resp.StatusCode, http.StatusBadGateway)
+	}
+	if len(store.users) != 0 {
+		t.Errorf("%d users are provisioned without the login session", len(store.users))
+	}
+}
+
+func TestOIDCRole(t *testing.T) {
+	mapping := map[string]string{"admins": models.RoleAdmin, "staff": models.RoleUser}
+	tests := []struct {
+		mapping map[string]string
+		groups  []string
+		want    string
+	}{
+		{nil, []string{"admins"}, ""},
+		{mapping, nil, models.RoleUser},
+		{mapping, []string{"staff"}, models.RoleUser},
+		{mapping, []string{"staff", "admins"}, models.RoleAdmin},
+		{mapping, []string{"guests"}, models.RoleUser},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.groups), func(t *testing.T) {
+			if got := (Config{OIDCRoleMapping: tt.mapping}).OIDCRole(tt.groups); got != tt.want {
+				t.Errorf("OIDCRole(%v) = %q, want %q", tt.groups, got, tt.want)
+			}
+		})
+	}
+}
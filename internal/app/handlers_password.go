@@ -0,0 +1,195 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ptsypyshev/shortlink/internal/auth"
+	"github.com/ptsypyshev/shortlink/internal/mailer"
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const forgotPasswordMessage = "If the account exists, we have sent you an email with a link to reset the password"
+
+var (
+	errTooManyRequests = errors.New("too many requests, please try again later")
+	errBadResetToken   = errors.New("the password reset link is invalid or expired")
+)
+
+type passwordRequest struct {
+	Login    string `json:"login" form:"login"`
+	Token    string `json:"token" form:"token"`
+	Password string `json:"password" form:"password"`
+}
+
+func (a App) HandlerForgotPasswordPage(c *gin.Context) {
+	a.html(c, http.StatusOK, "forgot", gin.H{
+		"title":         "Shortlink - Forgot password",
+		"page_template": "forgot",
+	})
+}
+
+func (a App) HandlerForgotPassword(c *gin.Context) {
+	var req passwordRequest
+	if err := c.Bind(&req); err != nil {
+		c.String(http.StatusBadRequest, "cannot bind to request: %s", err)
+		return
+	}
+	if err := a.forgotPassword(c, req.Login); err != nil {
+		a.html(c, passwordErrorStatus(err), "forgot", gin.H{
+			"title":         "Shortlink - Forgot password",
+			"page_template": "forgot",
+			"error_message": err.Error(),
+		})
+		return
+	}
+	a.renderLogin(c, http.StatusOK, gin.H{
+		"title":         "Shortlink - Reset password",
+		"page_template": "login",
+		"info_message":  forgotPasswordMessage,
+	})
+}
+
+func (a App) HandlerResetPasswordPage(c *gin.Context) {
+	token := c.Query("token")
+	if _, err := a.users.PasswordResetUser(a.ctx, token); err != nil {
+		a.html(c, http.StatusBadRequest, "forgot", gin.H{
+			"title":         "Shortlink - Forgot password",
+			"page_template": "forgot",
+			"error_message": errBadResetToken.Error(),
+		})
+		return
+	}
+	a.html(c, http.StatusOK, "reset", gin.H{
+		"title":         "Shortlink - Reset password",
+		"page_template": "reset",
+		"token":         token,
+	})
+}
+
+func (a App) HandlerResetPassword(c *gin.Context) {
+	var req passwordRequest
+	if err := c.Bind(&req); err != nil {
+		c.String(http.StatusBadRequest, "cannot bind to request: %s", err)
+		return
+	}
+	if err := a.resetPassword(c, &req); err != nil {
+		template := "reset"
+		if errors.Is(err, errBadResetToken) {
+			template = "forgot"
+		}
+		a.html(c, passwordErrorStatus(err), template, gin.H{
+			"title":         "Shortlink - Reset password",
+			"page_template": template,
+			"error_message": err.Error(),
+			"token":         req.Token,
+		})
+		return
+	}
+	a.renderLogin(c, http.StatusOK, gin.H{
+		"title":         "Shortlink - Password is changed",
+		"page_template": "login",
+		"info_message":  "Your password is changed, please sign in",
+	})
+}
+
+func (a App) ForgotPassword(c *gin.Context) {
+	var req passwordRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	if err := a.forgotPassword(c, req.Login); err != nil {
+		c.JSON(passwordErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": forgotPasswordMessage})
+}
+
+func (a App) ResetPassword(c *gin.Context) {
+	var req passwordRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	if err := a.resetPassword(c, &req); err != nil {
+		c.JSON(passwordErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": "Password is changed"})
+}
+
+// forgotPassword sends reset links to the accounts found by the username or email.
+// It does not reveal whether an account exists, over-limit accounts are skipped silently.
+func (a App) forgotPassword(c *gin.Context, login string) error {
+	if !a.resetIPs.Allow("forgot:" + c.ClientIP()) {
+		return errTooManyRequests
+	}
+	login = strings.TrimSpace(login)
+	if login == "" {
+		return fmt.Errorf("%w: username or email is required", errRegistrationInvalid)
+	}
+	field := "username"
+	if strings.Contains(login, "@") {
+		field = "email"
+	}
+	users, err := a.users.Search(a.ctx, field, login)
+	if err != nil {
+		return nil
+	}
+	for _, user := range users {
+		if user.Email == "" || !a.resetUsers.Allow("forgot:"+strconv.Itoa(user.ID)) {
+			continue
+		}
+		if err := a.sendPasswordResetEmail(c, user); err != nil {
+			a.logger.Error(fmt.Sprintf(`cannot send password reset email: %s`, err))
+		}
+	}
+	return nil
+}
+
+func (a App) resetPassword(c *gin.Context, req *passwordRequest) error {
+	if !a.resetIPs.Allow("reset:" + c.ClientIP()) {
+		return errTooManyRequests
+	}
+	_, err := a.users.ResetPassword(a.ctx, req.Token, req.Password)
+	if errors.Is(err, auth.ErrWeakPassword) {
+		return err
+	}
+	if err != nil {
+		return errBadResetToken
+	}
+	return nil
+}
+
+func (a App) sendPasswordResetEmail(c *gin.Context, user *models.User) error {
+	token, err := a.users.RequestPasswordReset(a.ctx, user, a.config.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/reset?token=%s", a.config.PublicBaseURL, url.QueryEscape(token))
+	return a.mailer.Send(c, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Shortlink password",
+		Body: fmt.Sprintf("Hello, %s!\n\nTo set a new password follow the link:\n%s\n\n"+
+			"The link is valid for %s and can be used once. If you did not request a password reset, just ignore this email.\n",
+			user.Username, link, a.config.PasswordResetTTL),
+	})
+}
+
+func passwordErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errTooManyRequests):
+		return http.StatusTooManyRequests
+	case errors.Is(err, errRegistrationInvalid), errors.Is(err, auth.ErrWeakPassword), errors.Is(err, errBadResetToken):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,140 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4"
+
+	"github.com/ptsypyshev/shortlink/internal/mailer"
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+func (s *accountStore) CreatePasswordReset(_ context.Context, userID int, tokenHash string, _ time.Time) error {
+	s.resets[tokenHash] = userID
+	return nil
+}
+
+func (s *accountStore) FindPasswordReset(_ context.Context, tokenHash string) (int, error) {
+	userID, ok := s.resets[tokenHash]
+	if !ok {
+		return 0, pgx.ErrNoRows
+	}
+	return userID, nil
+}
+
+func (s *accountStore) ResetPassword(_ context.Context, tokenHash string, userID int, passwordHash string) error {
+	if s.resets[tokenHash] != userID {
+		return pgx.ErrNoRows
+	}
+	delete(s.resets, tokenHash)
+	user := s.users[userID]
+	user.PasswordHash = passwordHash
+	s.revokedAt[user.Username] = time.Now()
+	return nil
+}
+
+func (s *accountStore) SessionsRevokedAt(_ context.Context, username string) (time.Time, error) {
+	return s.revokedAt[username], nil
+}
+
+// newPasswordTest returns the account test application with the user alice.
+func newPasswordTest(t *testing.T, resetsPerIP, resetsPerAccount int) (*App, *accountStore, *mailer.MemoryMailer) {
+	t.Helper()
+	a, store, mail := newAccountTest(t, resetsPerIP, resetsPerAccount)
+	_, err := a.users.Create(a.ctx, &models.User{Username: "alice", Password: "old password", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, store, mail
+}
+
+func TestResetPassword(t *testing.T) {
+	a, _, mail := newPasswordTest(t, 10, 10)
+
+	// A session of alice started before the reset
+	sessionRouter := gin.New()
+	sessionRouter.Use(sessions.Sessions(SessionCookie, cookie.NewStore([]byte("test"))))
+	sessionRouter.GET("/signin", func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Set(UserKey, "alice")
+		session.Set(LoginAtKey, time.Now().UnixNano())
+		_ = session.Save()
+	})
+	sessionRouter.GET("/session", func(c *gin.Context) {
+		session := sessions.Default(c)
+		if !a.sessionValid(session, session.Get(UserKey)) {
+			c.Status(http.StatusUnauthorized)
+		}
+	})
+	rec := httptest.NewRecorder()
+	sessionRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/signin", nil))
+	sessionCookie := rec.Result().Cookies()[0]
+	sessionStatus := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/session", nil)
+		req.AddCookie(sessionCookie)
+		rec := httptest.NewRecorder()
+		sessionRouter.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if status := sessionStatus(); status != http.StatusOK {
+		t.Fatalf("session status before reset = %d, want %d", status, http.StatusOK)
+	}
+
+	rec = serveJSON(a.router, http.MethodPost, "/api/password/forgot", `{"login":"alice@example.com"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("forgot status = %d: %s", rec.Code, rec.Body)
+	}
+	reset := fmt.Sprintf(`{"token":%q,"password":"new password"}`, mailToken(t, mail))
+
+	if rec := serveJSON(a.router, http.MethodPost, "/api/password/reset", reset); rec.Code != http.StatusOK {
+		t.Fatalf("reset status = %d: %s", rec.Code, rec.Body)
+	}
+	if _, ok := a.users.Check(a.ctx, &models.User{Username: "alice", Password: "new password"}); !ok {
+		t.Error("new password is not accepted")
+	}
+	if _, ok := a.users.Check(a.ctx, &models.User{Username: "alice", Password: "old password"}); ok {
+		t.Error("old password is still accepted")
+	}
+	if status := sessionStatus(); status != http.StatusUnauthorized {
+		t.Errorf("session status after reset = %d, want %d", status, http.StatusUnauthorized)
+	}
+	if rec := serveJSON(a.router, http.MethodPost, "/api/password/reset", reset); rec.Code != http.StatusBadRequest {
+		t.Errorf("reuse status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestResetPasswordRateLimits(t *testing.T) {
+	a, _, mail := newPasswordTest(t, 2, 1)
+
+	// The account limit is silent to not reveal which accounts exist
+	for i := 0; i < 2; i++ {
+		if rec := serveJSON(a.router, http.MethodPost, "/api/password/forgot", `{"login":"alice"}`); rec.Code != http.StatusOK {
+			t.Errorf("forgot %d status = %d, want %d", i+1, rec.Code, http.StatusOK)
+		}
+	}
+	if n := len(mail.Messages()); n != 1 {
+		t.Errorf("%d emails are sent, want 1", n)
+	}
+	if rec := serveJSON(a.router, http.MethodPost, "/api/password/forgot", `{"login":"alice"}`); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("forgot status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+
+	// Reset attempts are limited separately from reset requests
+	reset := `{"token":"guess","password":"new password"}`
+	for i := 0; i < 2; i++ {
+		if rec := serveJSON(a.router, http.MethodPost, "/api/password/reset", reset); rec.Code != http.StatusBadRequest {
+			t.Errorf("reset %d status = %d, want %d", i+1, rec.Code, http.StatusBadRequest)
+		}
+	}
+	if rec := serveJSON(a.router, http.MethodPost, "/api/password/reset", reset); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("reset status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+}
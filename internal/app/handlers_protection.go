@@ -0,0 +1,91 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ptsypyshev/shortlink/internal/auth"
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const (
+	// LinkPasswordHeader carries the passphrase of a protected link for API clients
+	LinkPasswordHeader = "X-Link-Password"
+
+	unlockCookiePrefix = "unlock_"
+)
+
+var errWrongLinkPassword = errors.New("wrong password")
+
+// unlockLink checks access to the protected link by the unlock cookie, the passphrase header or
+// the submitted prompt form and responds itself if the redirect must not happen now. A successful form
+// submission sets the unlock cookie and repeats the request, so the click is counted once.
+func (a App) unlockLink(c *gin.Context, link *models.Link) bool {
+	hash, err := a.links.PasswordHash(a.ctx, link.ID)
+	if err != nil {
+		msg := fmt.Sprintf(`read link error: %s`, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return false
+	}
+	if hash == "" {
+		return true
+	}
+	// Unlock cookies are bound to the passphrase, changing it locks the link again
+	cookieName := unlockCookiePrefix + strconv.Itoa(link.ID)
+	unlocked := strconv.Itoa(link.ID) + ":" + auth.HashToken(hash)[:16]
+	if cookie, err := c.Cookie(cookieName); err == nil {
+		if data, err := a.signer.Verify(auth.PurposeUnlockLink, cookie); err == nil && data == unlocked {
+			return true
+		}
+	}
+
+	password, fromHeader := c.GetHeader(LinkPasswordHeader), true
+	if password == "" {
+		if c.Request.Method != http.MethodPost {
+			a.linkPasswordPage(c, http.StatusOK, "")
+			return false
+		}
+		password, fromHeader = c.PostForm("password"), false
+	}
+	key := c.ClientIP() + "|" + strconv.Itoa(link.ID)
+	switch {
+	case !a.unlockAttempts.Allow(key):
+		err = errTooManyRequests
+	case !a.links.VerifyPassword(hash, password):
+		err = errWrongLinkPassword
+	}
+	if err != nil {
+		status := http.StatusUnauthorized
+		if errors.Is(err, errTooManyRequests) {
+			status = http.StatusTooManyRequests
+		}
+		if fromHeader {
+			c.JSON(status, gin.H{"error": err.Error()})
+		} else {
+			a.linkPasswordPage(c, status, err.Error())
+		}
+		return false
+	}
+	a.unlockAttempts.Reset(key)
+	if fromHeader {
+		return true
+	}
+	c.SetCookie(cookieName, a.signer.Sign(auth.PurposeUnlockLink, unlocked, a.config.LinkUnlockTTL),
+		int(a.config.LinkUnlockTTL.Seconds()), "/", "", strings.HasPrefix(a.config.PublicBaseURL, "https://"), true)
+	c.Redirect(http.StatusSeeOther, c.Request.URL.RequestURI())
+	return false
+}
+
+func (a App) linkPasswordPage(c *gin.Context, code int, errorMessage string) {
+	c.Header("Cache-Control", "no-store")
+	a.html(c, code, "link_password", gin.H{
+		"title":         "Shortlink - Protected link",
+		"page_template": "link_password",
+		"error_message": errorMessage,
+	})
+}
@@ -0,0 +1,189 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+
+	"github.com/ptsypyshev/shortlink/internal/auth"
+	"github.com/ptsypyshev/shortlink/internal/mailer"
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+var (
+	usernameRegexp         = regexp.MustCompile(`^[a-zA-Z0-9._-]{3,100}$`)
+	errRegistrationInvalid = errors.New("invalid registration")
+	errRegistrationClosed  = errors.New("registration is disabled")
+)
+
+type registerRequest struct {
+	Username  string `json:"username" form:"username"`
+	Password  string `json:"password" form:"password"`
+	Email     string `json:"email" form:"email"`
+	FirstName string `json:"first_name" form:"first_name"`
+	LastName  string `json:"last_name" form:"last_name"`
+}
+
+func (a App) HandlerRegisterPage(c *gin.Context) {
+	session := sessions.Default(c)
+	userSession := session.Get(UserKey)
+	a.html(c, http.StatusOK, "register", gin.H{
+		"title":         "Shortlink - Sign up",
+		"user_session":  userSession,
+		"page_template": "register",
+		"disabled":      !a.config.RegistrationEnabled,
+	})
+}
+
+func (a App) HandlerRegister(c *gin.Context) {
+	var req registerRequest
+	if err := c.Bind(&req); err != nil {
+		c.String(http.StatusBadRequest, "cannot bind to user: %s", err)
+		return
+	}
+	if _, err := a.register(c, &req); err != nil {
+		a.html(c, registerErrorStatus(err), "register", gin.H{
+			"title":         "Shortlink - Sign up",
+			"page_template": "register",
+			"error_message": err.Error(),
+			"form":          req,
+			"disabled":      !a.config.RegistrationEnabled,
+		})
+		return
+	}
+	a.renderLogin(c, http.StatusOK, gin.H{
+		"title":         "Shortlink - Confirm your email",
+		"page_template": "login",
+		"info_message":  "We have sent you an email, please follow the link in it to activate your account",
+	})
+}
+
+func (a App) RegisterUser(c *gin.Context) {
+	var req registerRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	newUser, err := a.register(c, &req)
+	if err != nil {
+		c.JSON(registerErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"created": newUser})
+}
+
+// ResendVerification always answers OK to not reveal which usernames exist.
+func (a App) ResendVerification(c *gin.Context) {
+	var req registerRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	users, err := a.users.Search(a.ctx, "username", req.Username)
+	if err == nil && len(users) == 1 && users[0].PendingVerification {
+		if err := a.sendVerificationEmail(c, users[0]); err != nil {
+			a.logger.Error(fmt.Sprintf(`cannot resend verification email: %s`, err))
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"result": "If the account is waiting for verification, an email has been sent"})
+}
+
+func (a App) HandlerVerifyEmail(c *gin.Context) {
+	renderLogin := func(status int, msgKey, msg string) {
+		a.renderLogin(c, status, gin.H{
+			"title":         fmt.Sprintf("Shortlink - %s", msg),
+			"page_template": "login",
+			msgKey:          msg,
+		})
+	}
+
+	data, err := a.signer.Verify(auth.PurposeVerifyEmail, c.Query("token"))
+	if err != nil {
+		renderLogin(http.StatusBadRequest, "error_message", "The verification link is invalid or expired")
+		return
+	}
+	idStr, email, _ := strings.Cut(data, "|")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		renderLogin(http.StatusBadRequest, "error_message", "The verification link is invalid or expired")
+		return
+	}
+	user, err := a.users.Read(a.ctx, id)
+	if err != nil || user.Email != email {
+		renderLogin(http.StatusBadRequest, "error_message", "The verification link is invalid or expired")
+		return
+	}
+	if user.PendingVerification {
+		if _, err := a.users.VerifyEmail(a.ctx, id, email); err != nil {
+			renderLogin(http.StatusInternalServerError, "error_message", "Cannot verify email, please try again later")
+			return
+		}
+	}
+	renderLogin(http.StatusOK, "info_message", "Your email is confirmed, please sign in")
+}
+
+func (a App) register(c *gin.Context, req *registerRequest) (*models.User, error) {
+	if !a.config.RegistrationEnabled {
+		return nil, errRegistrationClosed
+	}
+	req.Username = strings.TrimSpace(req.Username)
+	req.Email = strings.TrimSpace(req.Email)
+	if !usernameRegexp.MatchString(req.Username) {
+		return nil, fmt.Errorf("%w: username must be 3-100 latin letters, digits, dots, dashes or underscores",
+			errRegistrationInvalid)
+	}
+	if addr, err := mail.ParseAddress(req.Email); err != nil || addr.Address != req.Email {
+		return nil, fmt.Errorf("%w: bad email address", errRegistrationInvalid)
+	}
+	if users, err := a.users.Search(a.ctx, "username", req.Username); err == nil && len(users) > 0 {
+		return nil, fmt.Errorf("%w: username is already taken", errRegistrationInvalid)
+	}
+
+	newUser, err := a.users.Create(a.requestCtx(c), &models.User{
+		Username:            req.Username,
+		Password:            req.Password,
+		FirstName:           req.FirstName,
+		LastName:            req.LastName,
+		Email:               req.Email,
+		UserStatus:          false,
+		PendingVerification: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := a.sendVerificationEmail(c, newUser); err != nil {
+		a.logger.Error(fmt.Sprintf(`cannot send verification email: %s`, err))
+	}
+	return newUser, nil
+}
+
+func (a App) sendVerificationEmail(c *gin.Context, user *models.User) error {
+	token := a.signer.Sign(auth.PurposeVerifyEmail, fmt.Sprintf("%d|%s", user.ID, user.Email), a.config.VerificationTTL)
+	link := fmt.Sprintf("%s/verify?token=%s", a.config.PublicBaseURL, url.QueryEscape(token))
+	return a.mailer.Send(c, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your Shortlink account",
+		Body: fmt.Sprintf("Hello, %s!\n\nPlease confirm your email address by following the link:\n%s\n\n"+
+			"The link is valid for %s. If you did not sign up for Shortlink, just ignore this email.\n",
+			user.Username, link, a.config.VerificationTTL),
+	})
+}
+
+func registerErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errRegistrationClosed):
+		return http.StatusForbidden
+	case errors.Is(err, errRegistrationInvalid), errors.Is(err, auth.ErrWeakPassword):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,187 @@
+package app
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+
+	"github.com/ptsypyshev/shortlink/internal/auth"
+	"github.com/ptsypyshev/shortlink/internal/mailer"
+	"github.com/ptsypyshev/shortlink/internal/models"
+	"github.com/ptsypyshev/shortlink/internal/ratelimit"
+	"github.com/ptsypyshev/shortlink/internal/repositories/objrepo"
+)
+
+// accountStore keeps users in memory like the users table does.
+type accountStore struct {
+	objrepo.Storage[*models.User]
+	objrepo.NonGenericStorage
+	users map[int]*models.User
+	// resets maps hashes of unused reset tokens to their users
+	resets    map[string]int
+	revokedAt map[string]time.Time
+}
+
+func (s *accountStore) Create(_ context.Context, user *models.User) (int, error) {
+	id := len(s.users) + 1
+	stored := *user
+	stored.ID = id
+	s.users[id] = &stored
+	return id, nil
+}
+
+func (s *accountStore) Read(_ context.Context, id int, _ *models.User) (*models.User, error) {
+	user, ok := s.users[id]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	found := *user
+	return &found, nil
+}
+
+func (s *accountStore) SearchUsers(_ context.Context, field any, value any) ([]*models.User, error) {
+	var users []*models.User
+	for _, user := range s.users {
+		if field == "username" && user.Username == value || field == "email" && user.Email == value {
+			found := *user
+			users = append(users, &found)
+		}
+	}
+	return users, nil
+}
+
+func (s *accountStore) VerifyUserEmail(_ context.Context, id int, email string) error {
+	user, ok := s.users[id]
+	if !ok || user.Email != email {
+		return pgx.ErrNoRows
+	}
+	user.PendingVerification, user.UserStatus = false, true
+	return nil
+}
+
+func (s *accountStore) CreateAuditEntry(context.Context, *models.AuditEntry) error {
+	return nil
+}
+
+// newAccountTest returns the application with in-memory users and mailer, password resets are
+// limited to resetsPerIP requests per client address and resetsPerAccount emails per account.
+func newAccountTest(t *testing.T, resetsPerIP, resetsPerAccount int) (*App, *accountStore, *mailer.MemoryMailer) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	hasher, err := auth.NewPasswordHasher(auth.HasherArgon2id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &accountStore{
+		users:     make(map[int]*models.User),
+		resets:    make(map[string]int),
+		revokedAt: make(map[string]time.Time),
+	}
+	mail := &mailer.MemoryMailer{}
+	a := &App{
+		ctx: context.Background(),
+		config: Config{
+			PublicBaseURL:       "http://sho.rt",
+			RegistrationEnabled: true,
+			VerificationTTL:     time.Hour,
+			PasswordResetTTL:    time.Hour,
+			LocalLoginEnabled:   true,
+		},
+		router:     gin.New(),
+		users:      *objrepo.UsersNew(store, store, hasher, auth.DefaultPasswordPolicy, zap.NewNop()),
+		signer:     auth.NewSigner([]byte("test")),
+		mailer:     mail,
+		resetIPs:   ratelimit.New(resetsPerIP, time.Hour),
+		resetUsers: ratelimit.New(resetsPerAccount, time.Hour),
+		logger:     zap.NewNop(),
+	}
+	a.router.SetHTMLTemplate(template.Must(template.New("login").Parse(
+		`{{define "forgot"}}{{.error_message}}{{end}}{{define "reset"}}{{.error_message}}{{end}}` +
+			`{{.error_message}}{{.info_message}}`)))
+	a.router.Use(sessions.Sessions(SessionCookie, cookie.NewStore([]byte("test"))))
+	a.routes()
+	return a, store, mail
+}
+
+var mailTokenRegexp = regexp.MustCompile(`\?token=(\S+)`)
+
+// mailToken returns the token of the link in the last sent email.
+func mailToken(t *testing.T, mail *mailer.MemoryMailer) string {
+	t.Helper()
+	messages := mail.Messages()
+	if len(messages) == 0 {
+		t.Fatal("no email is sent")
+	}
+	match := mailTokenRegexp.FindStringSubmatch(messages[len(messages)-1].Body)
+	if match == nil {
+		t.Fatalf("no link in %q", messages[len(messages)-1].Body)
+	}
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func serveJSON(router http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestVerifyEmail(t *testing.T) {
+	a, store, mail := newAccountTest(t, 10, 10)
+	rec := serveJSON(a.router, http.MethodPost, "/api/register/",
+		`{"username":"alice","password":"secret password","email":"alice@example.com"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("register status = %d: %s", rec.Code, rec.Body)
+	}
+	token := mailToken(t, mail)
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"empty", "", http.StatusBadRequest},
+		{"tampered", strings.Replace(token, token[:1], string(token[0]^1), 1), http.StatusBadRequest},
+		{"other purpose", a.signer.Sign(auth.PurposeUnlockLink, "1|alice@example.com", time.Hour), http.StatusBadRequest},
+		{"expired", a.signer.Sign(auth.PurposeVerifyEmail, "1|alice@example.com", -time.Minute), http.StatusBadRequest},
+		{"other email", a.signer.Sign(auth.PurposeVerifyEmail, "1|mallory@example.com", time.Hour), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			a.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/verify?token="+url.QueryEscape(tt.token), nil))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if !store.users[1].PendingVerification {
+				t.Error("email is verified")
+			}
+		})
+	}
+
+	rec = httptest.NewRecorder()
+	a.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/verify?token="+url.QueryEscape(token), nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if user := store.users[1]; user.PendingVerification || !user.UserStatus {
+		t.Errorf("user is not activated: pending = %t, active = %t", user.PendingVerification, user.UserStatus)
+	}
+}
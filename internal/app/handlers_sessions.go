@@ -0,0 +1,93 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (a App) GetSessions(c *gin.Context) {
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	userSessions, err := a.users.Sessions(a.ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	currentID := c.GetInt(sessionIDKey)
+	for _, s := range userSessions {
+		s.Current = s.ID == currentID
+	}
+	c.JSON(http.StatusOK, gin.H{"found": userSessions})
+}
+
+func (a App) RevokeSession(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		msg := fmt.Sprintf(`bad id: %s`, c.Param("id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err := a.users.RevokeSession(a.ctx, user.ID, id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deleted": id})
+}
+
+// RevokeOtherSessions signs the user out everywhere except the current session.
+func (a App) RevokeOtherSessions(c *gin.Context) {
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	count, err := a.users.RevokeSessions(a.ctx, user.ID, c.GetInt(sessionIDKey))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deleted": count})
+}
+
+func (a App) GetUserSessions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		msg := fmt.Sprintf(`bad id: %s`, c.Param("id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	userSessions, err := a.users.Sessions(a.ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"found": userSessions})
+}
+
+// RevokeUserSessions lets administrator sign the user out of all sessions.
+func (a App) RevokeUserSessions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		msg := fmt.Sprintf(`bad id: %s`, c.Param("id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	count, err := a.users.RevokeSessions(a.ctx, id, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	a.logger.Info(fmt.Sprintf(`%d sessions of user %d are revoked by administrator`, count, id))
+	c.JSON(http.StatusOK, gin.H{"deleted": count})
+}
@@ -0,0 +1,89 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+func (a App) GetTags(c *gin.Context) {
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	tags, err := a.tags.Search(a.ctx, user.ID)
+	if err != nil {
+		msg := fmt.Sprintf(`get error: %s`, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"found": tags})
+}
+
+func (a App) CreateTag(c *gin.Context) {
+	var tag models.Tag
+	if err := c.BindJSON(&tag); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	tag.OwnerID = user.ID
+	newTag, err := a.tags.Create(a.ctx, &tag)
+	if err != nil {
+		msg := fmt.Sprintf(`create tag error: %s`, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"created": newTag})
+}
+
+func (a App) UpdateTag(c *gin.Context) {
+	var tag models.Tag
+	if err := c.BindJSON(&tag); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	tag.OwnerID = user.ID
+	updatedTag, err := a.tags.Update(a.ctx, &tag)
+	if err != nil {
+		msg := fmt.Sprintf(`update tag error: %s`, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"updated": updatedTag})
+}
+
+func (a App) DeleteTag(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		msg := fmt.Sprintf(`bad id: %s`, c.Param("id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	deletedTag, err := a.tags.Delete(a.ctx, id, user.ID)
+	if err != nil {
+		msg := fmt.Sprintf(`delete tag error: %s`, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deleted": deletedTag})
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+	"github.com/ptsypyshev/shortlink/internal/targeting"
+)
+
+type targetingTestRequest struct {
+	IP             string `json:"ip"`
+	Country        string `json:"country"`
+	UserAgent      string `json:"user_agent"`
+	AcceptLanguage string `json:"accept_language"`
+}
+
+type targetingTestResult struct {
+	targeting.Request
+	Destination string `json:"destination"`
+	// Rule is the index of the matched rule, -1 for the default destination
+	Rule int `json:"rule"`
+}
+
+// targetingRequest describes the click for targeting rules, a failed country lookup leaves the country empty.
+func (a App) targetingRequest(c *gin.Context) targeting.Request {
+	req, err := targeting.NewRequest(a.geo, net.ParseIP(c.ClientIP()), c.Request.UserAgent(),
+		c.GetHeader("Accept-Language"))
+	if err != nil {
+		a.logger.Warn(fmt.Sprintf(`cannot resolve country of %s: %s`, c.ClientIP(), err))
+	}
+	return req
+}
+
+// TestLinkTargeting shows the destination a click with the given headers would receive without counting it.
+// The country is resolved by the IP address unless it is given explicitly.
+func (a App) TestLinkTargeting(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		msg := fmt.Sprintf(`bad id: %s`, c.Param("id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	var testReq targetingTestRequest
+	if err := c.BindJSON(&testReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	var ip net.IP
+	if testReq.IP != "" && testReq.Country == "" {
+		if ip = net.ParseIP(testReq.IP); ip == nil {
+			msg := fmt.Sprintf(`bad ip: %s`, testReq.IP)
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+	}
+	link, err := a.links.Read(a.ctx, id)
+	if err != nil {
+		msg := fmt.Sprintf(`read link error: %s`, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+		return
+	}
+	if _, ok := a.workspaceAccess(c, link.WorkspaceID, models.WorkspaceViewer); !ok {
+		return
+	}
+	req, err := targeting.NewRequest(a.geo, ip, testReq.UserAgent, testReq.AcceptLanguage)
+	if err != nil {
+		msg := fmt.Sprintf(`resolve country error: %s`, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	if testReq.Country != "" {
+		req.Country = strings.ToUpper(strings.TrimSpace(testReq.Country))
+	}
+	// Scheduled changes replace the default destination
+	if destination := link.Schedule.Destination(time.Now()); destination != "" {
+		link.LongLink = destination
+	}
+	destination, rule := targeting.Destination(link, req)
+	c.JSON(http.StatusOK, gin.H{"result": targetingTestResult{Request: req, Destination: destination, Rule: rule}})
+}
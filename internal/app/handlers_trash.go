@@ -0,0 +1,132 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ptsypyshev/shortlink/internal/db/pgdb"
+	"github.com/ptsypyshev/shortlink/internal/models"
+	"github.com/ptsypyshev/shortlink/internal/repositories/objrepo"
+)
+
+// GetTrash returns deleted links of the user which can be restored until they are purged.
+func (a App) GetTrash(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		msg := fmt.Sprintf(`bad id: %s`, c.Param("id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if user.ID != id && user.Role != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only own trash can be viewed"})
+		return
+	}
+	links, err := a.links.Trash(a.ctx, id)
+	if err != nil {
+		msg := fmt.Sprintf(`get error: %s`, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	a.setShortURLs(links)
+	c.JSON(http.StatusOK, gin.H{"found": links, "purge_after": a.config.TrashRetention.String()})
+}
+
+func (a App) RestoreLink(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		msg := fmt.Sprintf(`bad id: %s`, c.Param("id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	workspaceID, err := a.links.TrashWorkspace(a.ctx, id)
+	if err != nil {
+		msg := fmt.Sprintf(`restore link error: %s`, err)
+		c.JSON(trashErrorStatus(err), gin.H{"error": msg})
+		return
+	}
+	if _, ok := a.workspaceAccess(c, workspaceID, models.WorkspaceEditor); !ok {
+		return
+	}
+	link, err := a.links.Restore(a.requestCtx(c), id)
+	if err != nil {
+		msg := fmt.Sprintf(`restore link error: %s`, err)
+		c.JSON(trashErrorStatus(err), gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"restored": link})
+}
+
+func (a App) GetDeletedUsers(c *gin.Context) {
+	users, err := a.users.Trash(a.ctx)
+	if err != nil {
+		msg := fmt.Sprintf(`get error: %s`, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"found": users, "purge_after": a.config.TrashRetention.String()})
+}
+
+func (a App) RestoreUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		msg := fmt.Sprintf(`bad id: %s`, c.Param("id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	user, err := a.users.Restore(a.requestCtx(c), id)
+	if err != nil {
+		msg := fmt.Sprintf(`restore user error: %s`, err)
+		c.JSON(trashErrorStatus(err), gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"restored": user})
+}
+
+// startTrashPurge periodically hard-deletes links and users which are in the trash longer than TrashRetention.
+func (a *App) startTrashPurge() {
+	go func() {
+		ticker := time.NewTicker(a.config.TrashPurgeInterval)
+		defer ticker.Stop()
+		for {
+			a.purgeTrash()
+			select {
+			case <-a.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (a App) purgeTrash() {
+	before := time.Now().Add(-a.config.TrashRetention)
+	// Links go first, links of purged users stay without owner as before soft deletion
+	links, err := a.links.Purge(a.ctx, before)
+	if err != nil {
+		return
+	}
+	users, err := a.users.Purge(a.ctx, before)
+	if err != nil {
+		return
+	}
+	if links+users > 0 {
+		a.logger.Info(fmt.Sprintf(`trash is purged: %d links, %d users`, links, users))
+	}
+}
+
+func trashErrorStatus(err error) int {
+	if errors.Is(err, objrepo.ErrNotInTrash) || errors.Is(err, pgdb.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,285 @@
+package app
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+
+	"github.com/ptsypyshev/shortlink/internal/audit"
+	"github.com/ptsypyshev/shortlink/internal/auth"
+	"github.com/ptsypyshev/shortlink/internal/models"
+	"github.com/ptsypyshev/shortlink/internal/repositories/objrepo"
+)
+
+// pendingLoginTTL limits the time between the password and the second factor steps of login
+const pendingLoginTTL = 5 * time.Minute
+
+type twoFactorRequest struct {
+	Code string `json:"code" form:"code"`
+}
+
+func (a App) HandlerLogin2FAPage(c *gin.Context) {
+	if _, ok := pendingUser(sessions.Default(c)); !ok {
+		c.Redirect(http.StatusFound, "/login")
+		return
+	}
+	a.html(c, http.StatusOK, "login_2fa", gin.H{
+		"title":         "Shortlink - Two-factor authentication",
+		"page_template": "login_2fa",
+	})
+}
+
+// HandlerLogin2FA is the second step of login for users with 2FA enabled,
+// UserKey is set only after the code is verified.
+func (a App) HandlerLogin2FA(c *gin.Context) {
+	session := sessions.Default(c)
+	username, ok := pendingUser(session)
+	if !ok {
+		c.Redirect(http.StatusFound, "/login")
+		return
+	}
+	var req twoFactorRequest
+	if err := c.Bind(&req); err != nil {
+		c.String(http.StatusBadRequest, "cannot bind to request: %s", err)
+		return
+	}
+	user, err := a.findUser(username)
+	if err == nil {
+		err = a.verifySecondFactor(c, user, req.Code)
+	}
+	if err != nil {
+		a.recordLogin(c, audit.ActionLoginFailed, user, username)
+		a.html(c, twoFactorErrorStatus(err), "login_2fa", gin.H{
+			"title":         "Shortlink - Two-factor authentication",
+			"page_template": "login_2fa",
+			"error_message": err.Error(),
+		})
+		return
+	}
+	now := time.Now().UnixNano()
+	session.Delete(PendingUserKey)
+	session.Delete(PendingAtKey)
+	session.Set(UserKey, user.Username)
+	session.Set(LoginAtKey, now)
+	session.Set(MFAAtKey, now)
+	if err := session.Save(); err != nil {
+		log.Println("Failed to save session:", err)
+		c.String(http.StatusInternalServerError, "Failed to save session")
+		return
+	}
+	a.recordLogin(c, audit.ActionLogin, user, "")
+	c.Redirect(http.StatusFound, "/dashboard")
+}
+
+func (a App) HandlerSecurity(c *gin.Context) {
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.Redirect(http.StatusFound, "/login")
+		return
+	}
+	a.html(c, http.StatusOK, "security", gin.H{
+		"title":         "Shortlink - Security",
+		"h1_text":       "Shortlink - make your links as short as possible!",
+		"user_session":  user.Username,
+		"userID":        user.ID,
+		"is_admin":      user.Role == models.RoleAdmin,
+		"page_template": "security",
+	})
+}
+
+func (a App) Get2FA(c *gin.Context) {
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	left := 0
+	if user.TOTPEnabled {
+		if left, err = a.users.RecoveryCodesLeft(a.ctx, user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"result": gin.H{
+		"enabled":             user.TOTPEnabled,
+		"recovery_codes_left": left,
+	}})
+}
+
+// Setup2FA starts the enrolment: it returns the secret with the provisioning URI and its QR code (PNG data URL).
+func (a App) Setup2FA(c *gin.Context) {
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	secret, err := a.users.SetupTOTP(a.requestCtx(c), user)
+	if err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	uri := auth.TOTPURI(a.config.TOTPIssuer, user.Username, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("cannot make qr code: %s", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": gin.H{
+		"secret": secret,
+		"uri":    uri,
+		"qr":     "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	}})
+}
+
+func (a App) Enable2FA(c *gin.Context) {
+	var req twoFactorRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if !a.mfaAttempts.Allow(strconv.Itoa(user.ID)) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": errTooManyRequests.Error()})
+		return
+	}
+	codes, err := a.users.EnableTOTP(a.requestCtx(c), user, req.Code)
+	if err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	a.mfaAttempts.Reset(strconv.Itoa(user.ID))
+	a.markSecondFactor(c)
+	c.JSON(http.StatusOK, gin.H{"result": gin.H{"recovery_codes": codes}})
+}
+
+// Verify2FA is the step-up check for the operations protected by Recent2FARequired.
+func (a App) Verify2FA(c *gin.Context) {
+	var req twoFactorRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err := a.verifySecondFactor(c, user, req.Code); err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	a.markSecondFactor(c)
+	c.JSON(http.StatusOK, gin.H{"result": "Two-factor authentication is verified"})
+}
+
+func (a App) Disable2FA(c *gin.Context) {
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	updatedUser, err := a.users.ResetTOTP(a.requestCtx(c), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"updated": updatedUser})
+}
+
+func (a App) RegenerateRecoveryCodes(c *gin.Context) {
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	codes, err := a.users.RegenerateRecoveryCodes(a.requestCtx(c), user)
+	if err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": gin.H{"recovery_codes": codes}})
+}
+
+// Reset2FA lets administrator disable 2FA of a user who lost the authenticator and recovery codes.
+func (a App) Reset2FA(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		msg := fmt.Sprintf(`bad id: %s`, c.Param("id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	updatedUser, err := a.users.ResetTOTP(a.requestCtx(c), id)
+	if err != nil {
+		msg := fmt.Sprintf(`reset 2fa error: %s`, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	a.logger.Info(fmt.Sprintf(`2fa of user %d is reset by administrator`, id))
+	c.JSON(http.StatusOK, gin.H{"updated": updatedUser})
+}
+
+// verifySecondFactor checks the code with the rate limit of wrong attempts per user.
+func (a App) verifySecondFactor(c *gin.Context, user *models.User, code string) error {
+	key := strconv.Itoa(user.ID)
+	if !a.mfaAttempts.Allow(key) {
+		return errTooManyRequests
+	}
+	if err := a.users.VerifySecondFactor(a.requestCtx(c), user, code); err != nil {
+		return err
+	}
+	a.mfaAttempts.Reset(key)
+	return nil
+}
+
+func (a App) markSecondFactor(c *gin.Context) {
+	session := sessions.Default(c)
+	session.Set(MFAAtKey, time.Now().UnixNano())
+	if err := session.Save(); err != nil {
+		log.Println("Failed to save session:", err)
+	}
+}
+
+func (a App) findUser(username string) (*models.User, error) {
+	users, err := a.users.Search(a.ctx, "username", username)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("cannot find user with name %s", username)
+	}
+	return users[0], nil
+}
+
+func pendingUser(session sessions.Session) (string, bool) {
+	username, _ := session.Get(PendingUserKey).(string)
+	pendingAt, _ := session.Get(PendingAtKey).(int64)
+	if username == "" || time.Since(time.Unix(0, pendingAt)) > pendingLoginTTL {
+		return "", false
+	}
+	return username, true
+}
+
+func twoFactorErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errTooManyRequests):
+		return http.StatusTooManyRequests
+	case errors.Is(err, objrepo.ErrBadTOTPCode):
+		return http.StatusUnauthorized
+	case errors.Is(err, objrepo.ErrTOTPEnabled), errors.Is(err, objrepo.ErrTOTPNotEnrolled):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -1,13 +1,17 @@
 package app
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/ptsypyshev/shortlink/internal/auth"
+	"github.com/ptsypyshev/shortlink/internal/db/pgdb"
 	"github.com/ptsypyshev/shortlink/internal/models"
+	"github.com/ptsypyshev/shortlink/internal/repositories/objrepo"
 )
 
 func (a App) CreateUser(c *gin.Context) {
@@ -16,7 +20,11 @@ func (a App) CreateUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err})
 		return
 	}
-	newUser, err := a.users.Create(a.ctx, &user)
+	newUser, err := a.users.Create(a.requestCtx(c), &user)
+	if errors.Is(err, auth.ErrWeakPassword) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		msg := fmt.Sprintf(`create user error: %s`, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
@@ -32,6 +40,15 @@ func (a App) GetUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
 		return
 	}
+	current, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if current.ID != id && current.Role != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only own data can be viewed"})
+		return
+	}
 	user, err := a.users.Read(a.ctx, id)
 	if err != nil {
 		msg := fmt.Sprintf(`get error: %s`, err)
@@ -58,7 +75,11 @@ func (a App) UpdateUser(c *gin.Context) {
 		return
 	}
 	id := user.ID
-	updatedUser, err := a.users.Update(a.ctx, id, &user)
+	updatedUser, err := a.users.Update(a.requestCtx(c), id, &user)
+	if errors.Is(err, auth.ErrWeakPassword) || errors.Is(err, objrepo.ErrBadRole) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		msg := fmt.Sprintf(`update user error: %s`, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
@@ -67,6 +88,8 @@ func (a App) UpdateUser(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"updated": updatedUser})
 }
 
+// DeleteUser requires the links query parameter to choose whether links of the user are transferred
+// to the user new_owner_id, deactivated or deleted.
 func (a App) DeleteUser(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -74,11 +97,30 @@ func (a App) DeleteUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
 		return
 	}
-	deletedUser, err := a.users.Delete(a.ctx, id)
+	var newOwnerID int
+	if c.Query("links") == models.LinksTransfer {
+		if newOwnerID, err = strconv.Atoi(c.Query("new_owner_id")); err != nil {
+			msg := fmt.Sprintf(`bad new_owner_id: %s`, c.Query("new_owner_id"))
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+	}
+	deletedUser, err := a.users.Delete(a.requestCtx(c), id, c.Query("links"), newOwnerID)
 	if err != nil {
 		msg := fmt.Sprintf(`delete user error: %s`, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		c.JSON(ownershipErrorStatus(err), gin.H{"error": msg})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"deleted": deletedUser})
 }
+
+func ownershipErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, objrepo.ErrBadLinksAction), errors.Is(err, objrepo.ErrSameOwner),
+		errors.Is(err, objrepo.ErrNewOwnerNotFound), errors.Is(err, objrepo.ErrLinksNotOwned):
+		return http.StatusBadRequest
+	case errors.Is(err, pgdb.ErrNotFound):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
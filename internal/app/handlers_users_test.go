@@ -0,0 +1,46 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// newRoutesTest returns the application router with a cookie session store, storages are not set.
+func newRoutesTest() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	a := &App{
+		ctx:    context.Background(),
+		router: gin.New(),
+		logger: zap.NewNop(),
+	}
+	a.router.Use(sessions.Sessions("session", cookie.NewStore([]byte("test"))))
+	a.routes()
+	return a.router
+}
+
+func TestUsersRequireAuthentication(t *testing.T) {
+	router := newRoutesTest()
+	for _, path := range []string{"/api/users/", "/api/users/1"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("GET %s status = %d, want %d", path, rec.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestPagesRedirectToLogin(t *testing.T) {
+	router := newRoutesTest()
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/dashboard/", nil))
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/login" {
+		t.Errorf("status = %d, location = %q, want %d to /login", rec.Code, rec.Header().Get("Location"), http.StatusFound)
+	}
+}
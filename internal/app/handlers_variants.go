@@ -0,0 +1,46 @@
+package app
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const variantCookiePrefix = "variant_"
+
+// pickVariant chooses a variant of the split link by weights. With VariantCookieTTL the choice is remembered
+// in a cookie, so returning clients get the same variant even if its weight became zero.
+func (a App) pickVariant(c *gin.Context, link *models.Link) *models.Variant {
+	cookieName := variantCookiePrefix + strconv.Itoa(link.ID)
+	sticky := a.config.VariantCookieTTL > 0
+	if sticky {
+		if value, err := c.Cookie(cookieName); err == nil {
+			if id, err := strconv.Atoi(value); err == nil {
+				if variant := link.VariantByID(id); variant != nil {
+					return variant
+				}
+			}
+		}
+	}
+	total := models.TotalWeight(link.Variants)
+	if total <= 0 {
+		return nil
+	}
+	roll, err := rand.Int(rand.Reader, big.NewInt(int64(total)))
+	if err != nil {
+		a.logger.Error(fmt.Sprintf(`cannot pick variant of link %d: %s`, link.ID, err))
+		return nil
+	}
+	variant := models.PickVariant(link.Variants, int(roll.Int64()))
+	if variant != nil && sticky {
+		c.SetCookie(cookieName, strconv.Itoa(variant.ID), int(a.config.VariantCookieTTL.Seconds()), "/", "",
+			strings.HasPrefix(a.config.PublicBaseURL, "https://"), true)
+	}
+	return variant
+}
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+func TestPickVariant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	link := &models.Link{ID: 5, Variants: []models.Variant{
+		{ID: 1, Name: "A", Weight: 0},
+		{ID: 2, Name: "B", Weight: 1},
+	}}
+	pick := func(a App, cookie *http.Cookie) (*models.Variant, *httptest.ResponseRecorder) {
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		if cookie != nil {
+			c.Request.AddCookie(cookie)
+		}
+		return a.pickVariant(c, link), rec
+	}
+
+	sticky := App{config: Config{VariantCookieTTL: time.Hour}, logger: zap.NewNop()}
+	variant, rec := pick(sticky, nil)
+	if variant == nil || variant.Name != "B" {
+		t.Fatalf("variant = %+v, want B", variant)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "variant_5" || cookies[0].Value != "2" || !cookies[0].HttpOnly {
+		t.Fatalf("cookies = %+v, want variant_5=2", cookies)
+	}
+
+	// A remembered variant is kept even with zero weight, unknown ones are picked again
+	if variant, _ := pick(sticky, &http.Cookie{Name: "variant_5", Value: "1"}); variant == nil || variant.Name != "A" {
+		t.Errorf("remembered variant = %+v, want A", variant)
+	}
+	if variant, _ := pick(sticky, &http.Cookie{Name: "variant_5", Value: "9"}); variant == nil || variant.Name != "B" {
+		t.Errorf("variant for unknown cookie = %+v, want B", variant)
+	}
+
+	notSticky := App{logger: zap.NewNop()}
+	variant, rec = pick(notSticky, &http.Cookie{Name: "variant_5", Value: "1"})
+	if variant == nil || variant.Name != "B" || len(rec.Result().Cookies()) != 0 {
+		t.Errorf("variant = %+v, cookies = %+v, want B without cookies", variant, rec.Result().Cookies())
+	}
+
+	link.Variants[1].Weight = 0
+	if variant, _ := pick(notSticky, nil); variant != nil {
+		t.Errorf("variant = %+v, want nil when all weights are zero", variant)
+	}
+}
@@ -0,0 +1,220 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+	"github.com/ptsypyshev/shortlink/internal/repositories/objrepo"
+	"github.com/ptsypyshev/shortlink/internal/webhook"
+)
+
+var errWebhooksDisabled = errors.New("webhooks are disabled")
+
+// GetWebhooks returns webhooks of the workspace given by workspace_id or personal webhooks of the current user.
+func (a App) GetWebhooks(c *gin.Context) {
+	workspaceID := 0
+	if value := c.Query("workspace_id"); value != "" {
+		var err error
+		if workspaceID, err = strconv.Atoi(value); err != nil {
+			msg := fmt.Sprintf(`bad workspace_id: %s`, value)
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+	}
+	user, ok := a.webhookScopeAccess(c, workspaceID)
+	if !ok {
+		return
+	}
+	webhooks, err := a.webhooks.Search(a.ctx, user.ID, workspaceID)
+	if err != nil {
+		msg := fmt.Sprintf(`get error: %s`, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"found": webhooks})
+}
+
+func (a App) GetWebhook(c *gin.Context) {
+	webhook, ok := a.webhookAccess(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	webhook.Secret = ""
+	c.JSON(http.StatusOK, gin.H{"read": webhook})
+}
+
+// CreateWebhook subscribes the URL to events of links of the workspace given by workspace_id
+// or of links of the current user. The response contains the secret which signs payloads.
+func (a App) CreateWebhook(c *gin.Context) {
+	var webhook models.Webhook
+	if err := c.BindJSON(&webhook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	user, ok := a.webhookScopeAccess(c, webhook.WorkspaceID)
+	if !ok {
+		return
+	}
+	webhook.OwnerID = user.ID
+	newWebhook, err := a.webhooks.Create(a.ctx, &webhook)
+	if err != nil {
+		msg := fmt.Sprintf(`create webhook error: %s`, err)
+		c.JSON(webhookErrorStatus(err), gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"created": newWebhook})
+}
+
+// UpdateWebhook replaces the URL, events and the disabled flag of the webhook, a non-empty secret replaces
+// the current one. The owner and the workspace are not changed.
+func (a App) UpdateWebhook(c *gin.Context) {
+	var webhook models.Webhook
+	if err := c.BindJSON(&webhook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	current, ok := a.webhookAccess(c, strconv.Itoa(webhook.ID))
+	if !ok {
+		return
+	}
+	webhook.OwnerID, webhook.WorkspaceID = current.OwnerID, current.WorkspaceID
+	updatedWebhook, err := a.webhooks.Update(a.ctx, &webhook)
+	if err != nil {
+		msg := fmt.Sprintf(`update webhook error: %s`, err)
+		c.JSON(webhookErrorStatus(err), gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"updated": updatedWebhook})
+}
+
+func (a App) DeleteWebhook(c *gin.Context) {
+	webhook, ok := a.webhookAccess(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	deletedWebhook, err := a.webhooks.Delete(a.ctx, webhook.ID)
+	if err != nil {
+		msg := fmt.Sprintf(`delete webhook error: %s`, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deleted": deletedWebhook})
+}
+
+// GetWebhookDeliveries returns the delivery log of the webhook, newest first, paginated with limit and offset.
+func (a App) GetWebhookDeliveries(c *gin.Context) {
+	webhook, ok := a.webhookAccess(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	var limit, offset int
+	for key, dst := range map[string]*int{
+		"limit":  &limit,
+		"offset": &offset,
+	} {
+		if value := c.Query(key); value != "" {
+			var err error
+			if *dst, err = strconv.Atoi(value); err != nil || *dst < 0 {
+				msg := fmt.Sprintf(`bad %s: %s`, key, value)
+				c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+				return
+			}
+		}
+	}
+	deliveries, err := a.webhooks.Deliveries(a.ctx, webhook.ID, limit, offset)
+	if err != nil {
+		msg := fmt.Sprintf(`get error: %s`, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"found": deliveries})
+}
+
+// TestWebhook sends a webhook.test event to the webhook right away and responds with the delivery,
+// failed test deliveries are not retried.
+func (a App) TestWebhook(c *gin.Context) {
+	webhook, ok := a.webhookAccess(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if a.dispatcher == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": errWebhooksDisabled.Error()})
+		return
+	}
+	delivery, err := a.dispatcher.Test(a.ctx, webhook)
+	if err != nil {
+		msg := fmt.Sprintf(`test webhook error: %s`, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": delivery})
+}
+
+// webhookScopeAccess checks that the current user may manage webhooks of the workspace (owners only)
+// or personal webhooks for zero workspaceID.
+func (a App) webhookScopeAccess(c *gin.Context, workspaceID int) (*models.User, bool) {
+	if workspaceID != 0 {
+		return a.workspaceAccess(c, workspaceID, models.WorkspaceOwner)
+	}
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return user, true
+}
+
+// webhookAccess reads the webhook if the current user may manage it.
+func (a App) webhookAccess(c *gin.Context, rawID string) (*models.Webhook, bool) {
+	id, err := strconv.Atoi(rawID)
+	if err != nil {
+		msg := fmt.Sprintf(`bad id: %s`, rawID)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return nil, false
+	}
+	webhook, err := a.webhooks.Read(a.ctx, id)
+	if err != nil {
+		msg := fmt.Sprintf(`read webhook error: %s`, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+		return nil, false
+	}
+	user, ok := a.webhookScopeAccess(c, webhook.WorkspaceID)
+	if !ok {
+		return nil, false
+	}
+	if webhook.WorkspaceID == 0 && webhook.OwnerID != user.ID && user.Role != models.RoleAdmin {
+		msg := fmt.Sprintf(`webhook %d belongs to another user`, id)
+		c.JSON(http.StatusForbidden, gin.H{"error": msg})
+		return nil, false
+	}
+	return webhook, true
+}
+
+func webhookErrorStatus(err error) int {
+	if errors.Is(err, objrepo.ErrBadWebhook) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// emitClick notifies webhooks about the click, link is the stored link and destination is the final URL.
+func (a App) emitClick(c *gin.Context, link *models.Link, shortlink *models.ShortLink, destination, variant string) {
+	if a.dispatcher == nil {
+		return
+	}
+	req := a.targetingRequest(c)
+	a.dispatcher.Emit(models.EventLinkClicked, link, &webhook.Click{
+		ShortURL:    a.config.ShortURL(shortlink.Domain, shortlink.Token),
+		Destination: destination,
+		Referer:     c.Request.Referer(),
+		UserAgent:   c.Request.UserAgent(),
+		Country:     req.Country,
+		Device:      req.Device,
+		Variant:     variant,
+	})
+}
@@ -0,0 +1,235 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ptsypyshev/shortlink/internal/db/pgdb"
+	"github.com/ptsypyshev/shortlink/internal/models"
+	"github.com/ptsypyshev/shortlink/internal/repositories/objrepo"
+)
+
+// workspaceAccess checks that the current user has at least the required role in the workspace
+// and responds with an error otherwise. Administrators have access to links and members of all workspaces.
+func (a App) workspaceAccess(c *gin.Context, workspaceID int, required string) (*models.User, bool) {
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if user.Role == models.RoleAdmin {
+		return user, true
+	}
+	role, err := a.workspaces.Role(a.ctx, workspaceID, user.ID)
+	if err != nil {
+		msg := fmt.Sprintf(`get error: %s`, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return nil, false
+	}
+	if !models.WorkspaceRoleAllows(role, required) {
+		msg := fmt.Sprintf(`%s role in workspace %d is required`, required, workspaceID)
+		c.JSON(http.StatusForbidden, gin.H{"error": msg})
+		return nil, false
+	}
+	return user, true
+}
+
+func (a App) GetWorkspaces(c *gin.Context) {
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	workspaces, err := a.workspaces.Search(a.ctx, user.ID)
+	if err != nil {
+		msg := fmt.Sprintf(`get error: %s`, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"found": workspaces})
+}
+
+func (a App) CreateWorkspace(c *gin.Context) {
+	var workspace models.Workspace
+	if err := c.BindJSON(&workspace); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	newWorkspace, err := a.workspaces.Create(a.requestCtx(c), &workspace, user.ID)
+	if err != nil {
+		msg := fmt.Sprintf(`create workspace error: %s`, err)
+		c.JSON(workspaceErrorStatus(err), gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"created": newWorkspace})
+}
+
+func (a App) UpdateWorkspace(c *gin.Context) {
+	var workspace models.Workspace
+	if err := c.BindJSON(&workspace); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	role, err := a.workspaces.Role(a.ctx, workspace.ID, user.ID)
+	if err != nil || role != models.WorkspaceOwner {
+		msg := fmt.Sprintf(`owner role in workspace %d is required`, workspace.ID)
+		c.JSON(http.StatusForbidden, gin.H{"error": msg})
+		return
+	}
+	updatedWorkspace, err := a.workspaces.Update(a.requestCtx(c), &workspace, user.ID)
+	if err != nil {
+		msg := fmt.Sprintf(`update workspace error: %s`, err)
+		c.JSON(workspaceErrorStatus(err), gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"updated": updatedWorkspace})
+}
+
+// DeleteWorkspace deletes a shared workspace, its links must be moved or purged first.
+func (a App) DeleteWorkspace(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		msg := fmt.Sprintf(`bad id: %s`, c.Param("id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	role, err := a.workspaces.Role(a.ctx, id, user.ID)
+	if err != nil || role != models.WorkspaceOwner {
+		msg := fmt.Sprintf(`owner role in workspace %d is required`, id)
+		c.JSON(http.StatusForbidden, gin.H{"error": msg})
+		return
+	}
+	deletedWorkspace, err := a.workspaces.Delete(a.requestCtx(c), id, user.ID)
+	if err != nil {
+		msg := fmt.Sprintf(`delete workspace error: %s`, err)
+		c.JSON(workspaceErrorStatus(err), gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deleted": deletedWorkspace})
+}
+
+func (a App) GetWorkspaceLinks(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		msg := fmt.Sprintf(`bad id: %s`, c.Param("id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if _, ok := a.workspaceAccess(c, id, models.WorkspaceViewer); !ok {
+		return
+	}
+	a.searchWorkspaceLinks(c, id)
+}
+
+func (a App) GetWorkspaceMembers(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		msg := fmt.Sprintf(`bad id: %s`, c.Param("id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if _, ok := a.workspaceAccess(c, id, models.WorkspaceViewer); !ok {
+		return
+	}
+	members, err := a.workspaces.Members(a.ctx, id)
+	if err != nil {
+		msg := fmt.Sprintf(`get error: %s`, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"found": members})
+}
+
+// SetWorkspaceMember adds a user to the workspace or changes the member role.
+func (a App) SetWorkspaceMember(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		msg := fmt.Sprintf(`bad id: %s`, c.Param("id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	var member models.WorkspaceMember
+	if err := c.BindJSON(&member); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	if _, ok := a.workspaceAccess(c, id, models.WorkspaceOwner); !ok {
+		return
+	}
+	if _, err := a.users.Read(a.ctx, member.UserID); err != nil {
+		msg := fmt.Sprintf(`user %d is not found`, member.UserID)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	member.WorkspaceID = id
+	if err := a.workspaces.SetMember(a.requestCtx(c), &member); err != nil {
+		msg := fmt.Sprintf(`set workspace member error: %s`, err)
+		c.JSON(workspaceErrorStatus(err), gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"updated": member})
+}
+
+func (a App) RemoveWorkspaceMember(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		msg := fmt.Sprintf(`bad id: %s`, c.Param("id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	userID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		msg := fmt.Sprintf(`bad user id: %s`, c.Param("user_id"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	// Members may leave the workspace themselves
+	user, err := a.currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if user.ID != userID {
+		if _, ok := a.workspaceAccess(c, id, models.WorkspaceOwner); !ok {
+			return
+		}
+	}
+	if err := a.workspaces.RemoveMember(a.requestCtx(c), id, userID); err != nil {
+		msg := fmt.Sprintf(`remove workspace member error: %s`, err)
+		c.JSON(workspaceErrorStatus(err), gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deleted": userID})
+}
+
+func workspaceErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, objrepo.ErrBadWorkspaceName), errors.Is(err, objrepo.ErrBadWorkspaceRole),
+		errors.Is(err, objrepo.ErrLastOwner), errors.Is(err, objrepo.ErrPersonalWorkspace):
+		return http.StatusBadRequest
+	case errors.Is(err, objrepo.ErrWorkspaceInUse):
+		return http.StatusConflict
+	case errors.Is(err, pgdb.ErrNotFound):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
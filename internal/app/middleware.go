@@ -1,23 +1,212 @@
 package app
 
 import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+
+	"github.com/ptsypyshev/shortlink/internal/auth"
+	"github.com/ptsypyshev/shortlink/internal/sessionstore"
+)
+
+var (
+	errAuthRequired      = errors.New("authentication required")
+	errAdminRequired     = errors.New("administrator privileges required")
+	errRecent2FARequired = errors.New("recent two-factor authentication required")
+	errCSRF              = errors.New("invalid or missing CSRF token")
 )
 
-const UserKey = "user"
+const (
+	// SessionCookie is the name of the session cookie
+	SessionCookie = "session"
+
+	UserKey    = "user"
+	LoginAtKey = "login_at"
+	// MFAAtKey keeps the time of the last successful second factor check
+	MFAAtKey = "mfa_at"
+	// PendingUserKey and PendingAtKey keep the user who passed the password check but not the second factor yet
+	PendingUserKey = "pending_user"
+	PendingAtKey   = "pending_at"
 
-func AuthRequired(c *gin.Context) {
+	// CSRFKey keeps the synchronizer token of the session, it is sent back in the X-CSRF-Token header
+	// or the csrf_token form field
+	CSRFKey       = "csrf_token"
+	CSRFHeader    = "X-CSRF-Token"
+	csrfFormField = "csrf_token"
+
+	// sessionIDKey is the gin context key with the id of the current session record
+	sessionIDKey = "sessionID"
+	// sessionTouchInterval limits updates of the session last seen time
+	sessionTouchInterval = time.Minute
+)
+
+func (a App) AuthRequired(c *gin.Context) {
 	session := sessions.Default(c)
 	user := session.Get(UserKey)
 	if user == nil {
 		log.Println("User not logged in")
-		c.Redirect(http.StatusFound, "/login")
-		c.Abort()
+		loginRequired(c)
+		return
+	}
+	if !a.sessionValid(session, user) || !a.sessionActive(c, session) {
+		log.Println("User session is revoked or expired")
+		session.Clear()
+		session.Options(sessions.Options{Path: "/", MaxAge: -1})
+		if err := session.Save(); err != nil {
+			log.Println("Failed to save session:", err)
+		}
+		loginRequired(c)
+		return
+	}
+	c.Next()
+}
+
+// loginRequired redirects pages to the login form, API requests are rejected with 401.
+func loginRequired(c *gin.Context) {
+	if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": errAuthRequired.Error()})
+		return
+	}
+	c.Redirect(http.StatusFound, "/login")
+	c.Abort()
+}
+
+// sessionActive enforces the idle and absolute session timeouts and keeps the session metadata up to date.
+func (a App) sessionActive(c *gin.Context, session sessions.Session) bool {
+	meta, err := a.sessions.Lookup(a.ctx, session.ID())
+	if err != nil {
+		return false
+	}
+	now := time.Now()
+	if now.Sub(meta.LastSeenAt) > a.config.SessionIdleTimeout || now.Sub(meta.CreatedAt) > a.config.SessionAbsoluteTimeout {
+		return false
+	}
+	if now.Sub(meta.LastSeenAt) > sessionTouchInterval || meta.IP != c.ClientIP() {
+		if err := a.sessions.Touch(a.ctx, session.ID(), c.ClientIP(), c.Request.UserAgent()); err != nil {
+			log.Println("Failed to update session:", err)
+		}
+	}
+	c.Set(sessionIDKey, meta.ID)
+	return true
+}
+
+// sessionValid reports whether the session was started after the last revocation of user's sessions
+// (e.g. by a password reset).
+func (a App) sessionValid(session sessions.Session, user any) bool {
+	revokedAt, err := a.users.SessionsRevokedAt(a.ctx, fmt.Sprint(user))
+	if err != nil {
+		return false
+	}
+	if revokedAt.IsZero() {
+		return true
+	}
+	loginAt, _ := session.Get(LoginAtKey).(int64)
+	return time.Unix(0, loginAt).After(revokedAt)
+}
+
+// AdminRequired must be used after AuthRequired.
+func (a App) AdminRequired(c *gin.Context) {
+	if !a.isAdmin(sessions.Default(c).Get(UserKey)) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": errAdminRequired.Error()})
 		return
 	}
 	c.Next()
 }
+
+// Recent2FARequired protects sensitive operations: the session must have passed the second factor
+// within the configured window (see /api/2fa/verify for step-up). It must be used after AuthRequired.
+func (a App) Recent2FARequired(c *gin.Context) {
+	mfaAt, _ := sessions.Default(c).Get(MFAAtKey).(int64)
+	if mfaAt == 0 || time.Since(time.Unix(0, mfaAt)) > a.config.MFARecentWindow {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": errRecent2FARequired.Error()})
+		return
+	}
+	c.Next()
+}
+
+// CSRFProtect rejects state-changing requests authenticated by the session cookie without a valid
+// synchronizer token. Requests without the cookie (API clients) are not checked: a forged cross-site
+// request could only act on behalf of the cookie it carries.
+func (a App) CSRFProtect(c *gin.Context) {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		c.Next()
+		return
+	}
+	if _, err := c.Request.Cookie(SessionCookie); err != nil {
+		c.Next()
+		return
+	}
+	expected, _ := sessions.Default(c).Get(CSRFKey).(string)
+	token := c.GetHeader(CSRFHeader)
+	if token == "" {
+		token = c.PostForm(csrfFormField)
+	}
+	if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(token)) != 1 {
+		log.Println("CSRF check failed:", c.Request.Method, c.Request.URL.Path)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": errCSRF.Error()})
+		return
+	}
+	c.Next()
+}
+
+// csrfToken returns the CSRF token of the session, a new one is created on first use.
+func (a App) csrfToken(c *gin.Context) string {
+	session := sessions.Default(c)
+	if token, ok := session.Get(CSRFKey).(string); ok && token != "" {
+		return token
+	}
+	token, _, err := auth.NewRandomToken()
+	if err != nil {
+		log.Println("Failed to generate CSRF token:", err)
+		return ""
+	}
+	session.Set(CSRFKey, token)
+	if err := session.Save(); err != nil {
+		log.Println("Failed to save session:", err)
+		return ""
+	}
+	return token
+}
+
+// GetCSRFToken gives non-browser clients of the cookie-authenticated API a token for state-changing requests.
+func (a App) GetCSRFToken(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"result": a.csrfToken(c)})
+}
+
+// formTemplates are pages with forms posted without scripts, they always get a CSRF token.
+var formTemplates = map[string]bool{
+	"login":         true,
+	"login_2fa":     true,
+	"register":      true,
+	"forgot":        true,
+	"reset":         true,
+	"link_password": true,
+}
+
+// html renders the page template with the CSRF token for its forms and scripts. Other anonymous pages
+// are rendered without a token, so visits without sign in do not create sessions; their scripts request
+// the token from /api/csrf when needed.
+func (a App) html(c *gin.Context, code int, name string, h gin.H) {
+	session := sessions.Default(c)
+	token, _ := session.Get(CSRFKey).(string)
+	if token == "" && (formTemplates[name] || session.Get(UserKey) != nil) {
+		token = a.csrfToken(c)
+	}
+	h["csrf_token"] = token
+	c.HTML(code, name, h)
+}
+
+// ClientIP passes the client address resolved by gin (with trusted proxies) to the session store,
+// so the address saved with a session matches the one AuthRequired compares it with.
+func (a App) ClientIP(c *gin.Context) {
+	c.Request = c.Request.WithContext(sessionstore.WithClientIP(c.Request.Context(), c.ClientIP()))
+	c.Next()
+}
@@ -0,0 +1,60 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+)
+
+func TestCSRFProtect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	a := App{}
+	router := gin.New()
+	router.Use(sessions.Sessions(SessionCookie, cookie.NewStore([]byte("test"))))
+	router.Use(a.CSRFProtect)
+	router.GET("/api/csrf", a.GetCSRFToken)
+	router.POST("/api/links/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/csrf", nil))
+	var resp struct {
+		Result string `json:"result"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Result == "" {
+		t.Fatalf("no token in %s: %v", rec.Body, err)
+	}
+	sessionCookie := rec.Result().Cookies()[0]
+
+	tests := []struct {
+		name   string
+		cookie bool
+		token  string
+		want   int
+	}{
+		{"without session cookie", false, "", http.StatusOK},
+		{"session without token", true, "", http.StatusForbidden},
+		{"session with wrong token", true, "wrong", http.StatusForbidden},
+		{"session with token", true, resp.Result, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/links/", nil)
+			if tt.cookie {
+				req.AddCookie(sessionCookie)
+			}
+			if tt.token != "" {
+				req.Header.Set(CSRFHeader, tt.token)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+// Package audit carries the actor of a request through the context and computes field diffs for audit entries.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const (
+	ActionCreate      = "create"
+	ActionUpdate      = "update"
+	ActionDelete      = "delete"
+	ActionRestore     = "restore"
+	ActionPurge       = "purge"
+	ActionLogin       = "login"
+	ActionLoginFailed = "login_failed"
+	ActionLogout      = "logout"
+
+	redacted = "[redacted]"
+)
+
+// secretFields are recorded only as changed, ignoredFields (counters updated on every redirect) are not recorded
+var (
+	secretFields  = map[string]bool{"password": true}
+	ignoredFields = map[string]bool{"click_counter": true}
+)
+
+// Actor is who performs the request, an anonymous actor has only IP.
+type Actor struct {
+	UserID   int
+	Username string
+	IP       string
+}
+
+type actorKey struct{}
+
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor of the request or the zero Actor for background jobs.
+func ActorFrom(ctx context.Context) Actor {
+	actor, _ := ctx.Value(actorKey{}).(Actor)
+	return actor
+}
+
+// Diff returns changed fields between JSON representations of before and after, nil before or after
+// means the object is created or deleted.
+func Diff(before, after any) (map[string]models.AuditChange, error) {
+	old, err := toMap(before)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := toMap(after)
+	if err != nil {
+		return nil, err
+	}
+	changes := make(map[string]models.AuditChange)
+	for key, value := range old {
+		if newValue, ok := updated[key]; !ok || !reflect.DeepEqual(value, newValue) {
+			changes[key] = models.AuditChange{Old: value, New: newValue}
+		}
+	}
+	for key, value := range updated {
+		if _, ok := old[key]; !ok {
+			changes[key] = models.AuditChange{New: value}
+		}
+	}
+	for key, change := range changes {
+		switch {
+		case ignoredFields[key]:
+			delete(changes, key)
+		case secretFields[key]:
+			if change.Old != nil {
+				change.Old = redacted
+			}
+			if change.New != nil {
+				change.New = redacted
+			}
+			changes[key] = change
+		}
+	}
+	return changes, nil
+}
+
+func toMap(obj any) (map[string]any, error) {
+	result := make(map[string]any)
+	if v := reflect.ValueOf(obj); !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return result, nil
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,248 @@
+// Package auth contains authentication primitives: password hashing and policies.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	HasherArgon2id = "argon2id"
+	HasherBcrypt   = "bcrypt"
+
+	argon2idPrefix = "$argon2id$"
+	bcryptMaxBytes = 72
+)
+
+var (
+	ErrWeakPassword = errors.New("password does not satisfy the password policy")
+	ErrUnknownHash  = errors.New("unknown password hash format")
+	ErrInvalidHash  = errors.New("invalid password hash")
+	// bcrypt ignores bytes after the 72nd, such passwords are rejected as any other policy violation
+	ErrPasswordTooLong = fmt.Errorf("%w: must be at most %d bytes long", ErrWeakPassword, bcryptMaxBytes)
+
+	DefaultArgon2idParams = Argon2idParams{Memory: 19 * 1024, Time: 2, Threads: 1, SaltLength: 16, KeyLength: 32}
+	DefaultBcryptCost     = 12
+	DefaultPasswordPolicy = PasswordPolicy{MinLength: 8, MaxLength: 128}
+
+	bcryptPrefixes = []string{"$2a$", "$2b$", "$2y$"}
+)
+
+var (
+	_ PasswordHasher = &Argon2idHasher{}
+	_ PasswordHasher = &BcryptHasher{}
+	_ PasswordHasher = &MultiHasher{}
+)
+
+// PasswordHasher hashes passwords for storage and verifies them on login.
+// Verify also reports whether the stored hash is outdated and should be replaced with Hash(password).
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(encoded, password string) (ok, rehash bool, err error)
+}
+
+type Argon2idParams struct {
+	Memory     uint32
+	Time       uint32
+	Threads    uint8
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+type Argon2idHasher struct {
+	Params Argon2idParams
+}
+
+// Hash returns the password hash in PHC string format: $argon2id$v=19$m=...,t=...,p=...$salt$key
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.Params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Params.Time, h.Params.Memory, h.Params.Threads, h.Params.KeyLength)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version, h.Params.Memory, h.Params.Time, h.Params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *Argon2idHasher) Verify(encoded, password string) (ok, rehash bool, err error) {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, false, err
+	}
+	otherKey := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+		return false, false, nil
+	}
+	return true, params != h.Params, nil
+}
+
+func decodeArgon2id(encoded string) (params Argon2idParams, salt, key []byte, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != HasherArgon2id {
+		return params, nil, nil, ErrInvalidHash
+	}
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrInvalidHash
+	}
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	if len(password) > bcryptMaxBytes {
+		return "", ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(hash), err
+}
+
+// Verify also accepts hashes created by pgcrypto's crypt(password, gen_salt('bf')), they are plain bcrypt.
+func (h *BcryptHasher) Verify(encoded, password string) (ok, rehash bool, err error) {
+	err = bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	cost, err := bcrypt.Cost([]byte(encoded))
+	if err != nil {
+		return false, false, err
+	}
+	return true, cost < h.Cost, nil
+}
+
+// MultiHasher hashes new passwords with the preferred algorithm and verifies hashes of all known algorithms.
+// Hashes of a non-preferred algorithm are reported for rehash.
+type MultiHasher struct {
+	preferred string
+	argon2id  *Argon2idHasher
+	bcrypt    *BcryptHasher
+	dummyHash string
+}
+
+// NewPasswordHasher returns a hasher for the algorithm (argon2id or bcrypt) with default parameters.
+func NewPasswordHasher(algorithm string) (*MultiHasher, error) {
+	h := &MultiHasher{
+		preferred: algorithm,
+		argon2id:  &Argon2idHasher{Params: DefaultArgon2idParams},
+		bcrypt:    &BcryptHasher{Cost: DefaultBcryptCost},
+	}
+	if algorithm != HasherArgon2id && algorithm != HasherBcrypt {
+		return nil, fmt.Errorf("unknown password hasher %q", algorithm)
+	}
+	dummyHash, err := h.Hash("dummy password")
+	if err != nil {
+		return nil, err
+	}
+	h.dummyHash = dummyHash
+	return h, nil
+}
+
+func (h *MultiHasher) Hash(password string) (string, error) {
+	if h.preferred == HasherBcrypt {
+		return h.bcrypt.Hash(password)
+	}
+	return h.argon2id.Hash(password)
+}
+
+func (h *MultiHasher) Verify(encoded, password string) (ok, rehash bool, err error) {
+	var algorithm string
+	switch {
+	case strings.HasPrefix(encoded, argon2idPrefix):
+		algorithm = HasherArgon2id
+		ok, rehash, err = h.argon2id.Verify(encoded, password)
+	case hasAnyPrefix(encoded, bcryptPrefixes):
+		algorithm = HasherBcrypt
+		ok, rehash, err = h.bcrypt.Verify(encoded, password)
+	default:
+		return false, false, ErrUnknownHash
+	}
+	return ok, ok && (rehash || algorithm != h.preferred), err
+}
+
+// VerifyDummy spends the same time as a real verification, it is used
+// when the user is not found to not reveal existing usernames by response time.
+func (h *MultiHasher) VerifyDummy(password string) {
+	_, _, _ = h.Verify(h.dummyHash, password)
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type PasswordPolicy struct {
+	MinLength        int
+	MaxLength        int
+	RequireMixedCase bool
+	RequireDigit     bool
+	RequireSymbol    bool
+}
+
+// Validate checks the password against the policy. Returned errors wrap ErrWeakPassword.
+func (p PasswordPolicy) Validate(username, password string) error {
+	length := len([]rune(password))
+	if length < p.MinLength {
+		return fmt.Errorf("%w: must be at least %d characters long", ErrWeakPassword, p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return fmt.Errorf("%w: must be at most %d characters long", ErrWeakPassword, p.MaxLength)
+	}
+	if username != "" && strings.EqualFold(username, password) {
+		return fmt.Errorf("%w: must differ from the username", ErrWeakPassword)
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		default:
+			hasSymbol = true
+		}
+	}
+	if p.RequireMixedCase && !(hasUpper && hasLower) {
+		return fmt.Errorf("%w: must contain both upper and lower case letters", ErrWeakPassword)
+	}
+	if p.RequireDigit && !hasDigit {
+		return fmt.Errorf("%w: must contain a digit", ErrWeakPassword)
+	}
+	if p.RequireSymbol && !hasSymbol {
+		return fmt.Errorf("%w: must contain a symbol", ErrWeakPassword)
+	}
+	return nil
+}
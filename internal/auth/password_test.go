@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Cheap parameters keep the tests fast, the format of the hashes does not depend on them
+var testArgon2idParams = Argon2idParams{Memory: 64, Time: 1, Threads: 1, SaltLength: 16, KeyLength: 32}
+
+func testHasher(preferred string) *MultiHasher {
+	return &MultiHasher{
+		preferred: preferred,
+		argon2id:  &Argon2idHasher{Params: testArgon2idParams},
+		bcrypt:    &BcryptHasher{Cost: bcrypt.MinCost},
+	}
+}
+
+func TestMultiHasher(t *testing.T) {
+	argon2idHash, err := testHasher(HasherArgon2id).Hash("secret password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bcryptHash, err := testHasher(HasherBcrypt).Hash("secret password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(argon2idHash, argon2idPrefix) || !strings.HasPrefix(bcryptHash, "$2a$") {
+		t.Fatalf("unexpected hashes %q and %q", argon2idHash, bcryptHash)
+	}
+
+	tests := []struct {
+		name      string
+		preferred string
+		hash      string
+		password  string
+		ok        bool
+		rehash    bool
+	}{
+		{"argon2id", HasherArgon2id, argon2idHash, "secret password", true, false},
+		{"argon2id wrong password", HasherArgon2id, argon2idHash, "wrong password", false, false},
+		{"bcrypt", HasherBcrypt, bcryptHash, "secret password", true, false},
+		{"bcrypt wrong password", HasherBcrypt, bcryptHash, "wrong password", false, false},
+		// Hashes of the other algorithm are verified and upgraded
+		{"bcrypt to argon2id", HasherArgon2id, bcryptHash, "secret password", true, true},
+		{"argon2id to bcrypt", HasherBcrypt, argon2idHash, "secret password", true, true},
+		{"bcrypt to argon2id wrong password", HasherArgon2id, bcryptHash, "wrong password", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash, err := testHasher(tt.preferred).Verify(tt.hash, tt.password)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.ok || rehash != tt.rehash {
+				t.Errorf("Verify = %t, %t, want %t, %t", ok, rehash, tt.ok, tt.rehash)
+			}
+		})
+	}
+}
+
+func TestMultiHasherRehashOutdatedParams(t *testing.T) {
+	hash, err := testHasher(HasherArgon2id).Hash("secret password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stronger := testHasher(HasherArgon2id)
+	stronger.argon2id.Params.Time = 2
+	ok, rehash, err := stronger.Verify(hash, "secret password")
+	if err != nil || !ok || !rehash {
+		t.Errorf("Verify = %t, %t, %v, want true, true, nil", ok, rehash, err)
+	}
+}
+
+func TestMultiHasherRejectsUnknownHashes(t *testing.T) {
+	h := testHasher(HasherArgon2id)
+	if _, _, err := h.Verify("plain text", "plain text"); !errors.Is(err, ErrUnknownHash) {
+		t.Errorf("err = %v, want %v", err, ErrUnknownHash)
+	}
+	if _, _, err := h.Verify("$argon2id$v=19$broken", "secret"); !errors.Is(err, ErrInvalidHash) {
+		t.Errorf("err = %v, want %v", err, ErrInvalidHash)
+	}
+}
+
+func TestBcryptRejectsLongPasswords(t *testing.T) {
+	_, err := testHasher(HasherBcrypt).Hash(strings.Repeat("a", bcryptMaxBytes+1))
+	if !errors.Is(err, ErrPasswordTooLong) || !errors.Is(err, ErrWeakPassword) {
+		t.Errorf("err = %v, want %v", err, ErrPasswordTooLong)
+	}
+}
+
+func TestNewPasswordHasher(t *testing.T) {
+	if _, err := NewPasswordHasher("md5"); err == nil {
+		t.Error("unknown algorithm is accepted")
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	strict := PasswordPolicy{MinLength: 8, MaxLength: 16, RequireMixedCase: true, RequireDigit: true, RequireSymbol: true}
+	tests := []struct {
+		name     string
+		policy   PasswordPolicy
+		username string
+		password string
+		ok       bool
+	}{
+		{"default", DefaultPasswordPolicy, "alice", "long enough", true},
+		{"too short", DefaultPasswordPolicy, "alice", "short", false},
+		{"length in characters", PasswordPolicy{MinLength: 4}, "alice", "пароль", true},
+		{"too long", strict, "alice", "Aa1!aaaaaaaaaaaaa", false},
+		{"same as username", DefaultPasswordPolicy, "longusername", "LongUserName", false},
+		{"strict", strict, "alice", "Passw0rd!", true},
+		{"no upper case", strict, "alice", "passw0rd!", false},
+		{"no digit", strict, "alice", "Password!", false},
+		{"no symbol", strict, "alice", "Passw0rdd", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate(tt.username, tt.password)
+			if (err == nil) != tt.ok {
+				t.Errorf("Validate(%q) = %v, want ok = %t", tt.password, err, tt.ok)
+			}
+			if err != nil && !errors.Is(err, ErrWeakPassword) {
+				t.Errorf("err = %v does not wrap %v", err, ErrWeakPassword)
+			}
+		})
+	}
+}
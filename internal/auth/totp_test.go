@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of RFC 6238 test vectors ("12345678901234567890") in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, the last 6 of 8 digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		code, err := TOTPCode(rfcSecret, tt.unix/int64(TOTPPeriod.Seconds()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tt.code {
+			t.Errorf("code at %d = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / int64(TOTPPeriod.Seconds())
+	codeAt := func(counter int64) string {
+		code, err := TOTPCode(rfcSecret, counter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+	tests := []struct {
+		name    string
+		code    string
+		ok      bool
+		counter int64
+	}{
+		{"current step", "050471", true, current},
+		{"spaces are ignored", " 050 471 ", true, current},
+		{"previous step", "081804", true, current - 1},
+		{"next step", codeAt(current + 1), true, current + 1},
+		{"two steps ago", codeAt(current - 2), false, 0},
+		{"two steps ahead", codeAt(current + 2), false, 0},
+		{"wrong code", "123456", false, 0},
+		{"short code", "05047", false, 0},
+		{"8 digits", "07081804", false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter, ok := ValidateTOTP(rfcSecret, tt.code, now)
+			if ok != tt.ok || counter != tt.counter {
+				t.Errorf("ValidateTOTP(%q) = %d, %t, want %d, %t", tt.code, counter, ok, tt.counter, tt.ok)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPBadSecret(t *testing.T) {
+	if _, ok := ValidateTOTP("not base32!", "123456", time.Now()); ok {
+		t.Error("code is accepted for an invalid secret")
+	}
+}
@@ -0,0 +1,94 @@
+package pgdb
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const (
+	AuditDefaultLimit = 50
+	AuditMaxLimit     = 500
+
+	AuditCreate = `
+INSERT INTO audit_log(actor_id, actor_name, action, target_type, target_id, changes, ip)
+VALUES
+    (NULLIF($1, 0), $2, $3, $4, $5, $6, $7)
+RETURNING id, created_at;
+`
+	AuditSelectByFilter = `
+SELECT id, created_at, COALESCE(actor_id, 0), actor_name, action, target_type, target_id, changes, ip,
+    COUNT(*) OVER () AS total
+FROM audit_log
+WHERE ($1 = 0 OR actor_id = $1) AND ($2 = '' OR action = $2) AND ($3 = '' OR target_type = $3)
+    AND ($4 = 0 OR target_id = $4)
+    AND ($5::timestamptz IS NULL OR created_at >= $5) AND ($6::timestamptz IS NULL OR created_at < $6)
+ORDER BY id DESC
+LIMIT $7 OFFSET $8;`
+)
+
+// queryRower is a pool or a transaction, so audit entries can be stored together with the audited change.
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+func (n *NGDB) CreateAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+	return createAuditEntry(ctx, n.conn(ctx), entry)
+}
+
+func createAuditEntry(ctx context.Context, q queryRower, entry *models.AuditEntry) error {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+	return q.QueryRow(ctx, AuditCreate, entry.ActorID, entry.ActorName, entry.Action, entry.TargetType,
+		entry.TargetID, changes, entry.IP).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+// SearchAuditEntries returns a page of entries (newest first) and the total number of matching entries.
+func (n *NGDB) SearchAuditEntries(ctx context.Context, filter models.AuditFilter) ([]*models.AuditEntry, int, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = AuditDefaultLimit
+	}
+	if filter.Limit > AuditMaxLimit {
+		filter.Limit = AuditMaxLimit
+	}
+	var from, to any
+	if !filter.From.IsZero() {
+		from = filter.From
+	}
+	if !filter.To.IsZero() {
+		to = filter.To
+	}
+	rows, err := n.conn(ctx).Query(ctx, AuditSelectByFilter, filter.ActorID, filter.Action, filter.TargetType,
+		filter.TargetID, from, to, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	var (
+		entries = make([]*models.AuditEntry, 0)
+		total   int
+	)
+	for rows.Next() {
+		var (
+			e       models.AuditEntry
+			changes []byte
+		)
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.ActorID, &e.ActorName, &e.Action, &e.TargetType, &e.TargetID,
+			&changes, &e.IP, &total); err != nil {
+			return nil, 0, err
+		}
+		if err := json.Unmarshal(changes, &e.Changes); err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, &e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
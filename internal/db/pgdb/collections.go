@@ -0,0 +1,180 @@
+package pgdb
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const (
+	CollectionCreate = `
+INSERT INTO collections(name, description, owner_id)
+VALUES
+    ($1, $2, $3)
+RETURNING id;
+`
+	CollectionSelectColumns = `
+SELECT collections.id, collections.name, collections.description, collections.owner_id,
+       COUNT(links.id), COALESCE(SUM(links.click_counter), 0)
+FROM collections
+LEFT JOIN collection_links ON collection_links.collection_id = collections.id
+LEFT JOIN links ON links.id = collection_links.link_id AND links.deleted_at IS NULL`
+	CollectionSelectByID = CollectionSelectColumns + `
+WHERE collections.id = $1 AND collections.owner_id = $2 GROUP BY collections.id;`
+	CollectionSelectByOwner = CollectionSelectColumns + `
+WHERE collections.owner_id = $1 GROUP BY collections.id ORDER BY collections.name;`
+	CollectionUpdate      = `UPDATE collections SET (name, description) = ($1, $2) WHERE id = $3 AND owner_id = $4;`
+	CollectionDeleteByID  = `DELETE FROM collections WHERE id = $1 AND owner_id = $2;`
+	CollectionLinksSelect = `
+SELECT ` + LinkListColumns + ` FROM links, shortlinks, collection_links
+WHERE links.id = shortlinks.long_link_id AND ` + LinkPrimaryShortLink + ` AND links.id = collection_links.link_id AND collection_links.collection_id = $1
+  AND links.deleted_at IS NULL
+ORDER BY links.id DESC;`
+	CollectionLinkInsert = `
+INSERT INTO collection_links(collection_id, link_id)
+SELECT collections.id, links.id FROM collections, links
+WHERE collections.id = $1 AND links.id = $2 AND collections.owner_id = $3 AND links.owner_id = $3
+  AND links.deleted_at IS NULL
+ON CONFLICT DO NOTHING;`
+	CollectionLinkDelete = `
+DELETE FROM collection_links USING collections
+WHERE collection_links.collection_id = collections.id
+  AND collection_links.collection_id = $1 AND collection_links.link_id = $2 AND collections.owner_id = $3;`
+	CollectionLinkExists = `
+SELECT EXISTS (SELECT 1 FROM collection_links WHERE collection_id = $1 AND link_id = $2);`
+)
+
+func (n *NGDB) CreateCollection(ctx context.Context, collection *models.Collection) (id int, err error) {
+	err = n.conn(ctx).QueryRow(ctx, CollectionCreate, collection.Name, collection.Description, collection.OwnerID).Scan(&id)
+	return
+}
+
+func (n *NGDB) ReadCollection(ctx context.Context, id, ownerID int) (*models.Collection, error) {
+	rows, err := n.conn(ctx).Query(ctx, CollectionSelectByID, id, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	collections, err := getCollectionsFromRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(collections) == 0 {
+		return nil, ErrNotFound
+	}
+	return collections[0], nil
+}
+
+func (n *NGDB) SearchCollections(ctx context.Context, ownerID int) ([]*models.Collection, error) {
+	rows, err := n.conn(ctx).Query(ctx, CollectionSelectByOwner, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	return getCollectionsFromRows(rows)
+}
+
+func (n *NGDB) SearchCollectionLinks(ctx context.Context, id int) ([]*models.Link, error) {
+	rows, err := n.conn(ctx).Query(ctx, CollectionLinksSelect, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sliceLinks := make([]*models.Link, 0)
+	for rows.Next() {
+		newlink, err := setLinkFieldsNG(rows)
+		if err != nil {
+			return nil, err
+		}
+		sliceLinks = append(sliceLinks, &newlink)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sliceLinks, nil
+}
+
+func (n *NGDB) UpdateCollection(ctx context.Context, collection *models.Collection) error {
+	res, err := n.conn(ctx).Exec(ctx, CollectionUpdate, collection.Name, collection.Description, collection.ID, collection.OwnerID)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (n *NGDB) DeleteCollection(ctx context.Context, id, ownerID int) error {
+	res, err := n.conn(ctx).Exec(ctx, CollectionDeleteByID, id, ownerID)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (n *NGDB) AddCollectionLink(ctx context.Context, id, linkID, ownerID int) error {
+	res, err := n.conn(ctx).Exec(ctx, CollectionLinkInsert, id, linkID, ownerID)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 1 {
+		return nil
+	}
+	// Nothing inserted: either the link is already in the collection or it is not owned by the user
+	var exists bool
+	if err := n.conn(ctx).QueryRow(ctx, CollectionLinkExists, id, linkID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (n *NGDB) RemoveCollectionLink(ctx context.Context, id, linkID, ownerID int) error {
+	res, err := n.conn(ctx).Exec(ctx, CollectionLinkDelete, id, linkID, ownerID)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func getCollectionsFromRows(rows pgx.Rows) ([]*models.Collection, error) {
+	defer rows.Close()
+
+	sliceCollections := make([]*models.Collection, 0)
+	for rows.Next() {
+		var (
+			id, ownerID, linkCount, clickCounter int
+			name, description                    string
+			collection                           models.Collection
+		)
+		if err := rows.Scan(&id, &name, &description, &ownerID, &linkCount, &clickCounter); err != nil {
+			return nil, err
+		}
+		mCollectionFields := map[string]interface{}{
+			"id":            id,
+			"name":          name,
+			"description":   description,
+			"owner_id":      ownerID,
+			"link_count":    linkCount,
+			"click_counter": clickCounter,
+		}
+		if err := collection.Set(mCollectionFields); err != nil {
+			return nil, err
+		}
+		sliceCollections = append(sliceCollections, &collection)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sliceCollections, nil
+}
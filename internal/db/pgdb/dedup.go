@@ -0,0 +1,38 @@
+package pgdb
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const (
+	LinkCreateDedup = `
+INSERT INTO links(long_link, click_counter, owner_id, is_active, workspace_id, passthrough, url_hash)
+VALUES
+    ($1, $2, $3, $4, NULLIF($5, 0), COALESCE(NULLIF($6, ''), 'off'), $7)
+ON CONFLICT (workspace_id, owner_id, url_hash) WHERE url_hash IS NOT NULL AND deleted_at IS NULL AND is_active
+DO NOTHING
+RETURNING id;`
+	LinkSelectByURLHash = `
+SELECT id FROM links
+WHERE owner_id = $1 AND url_hash = $2 AND deleted_at IS NULL AND is_active
+  AND workspace_id = COALESCE(NULLIF($3, 0), (SELECT id FROM workspaces WHERE personal_user_id = $1));`
+)
+
+// CreateLinkDedup creates the link unless the owner has an active link with the same urlHash in the workspace,
+// in that case it returns the id of the existing link and reused is true.
+func (n *NGDB) CreateLinkDedup(ctx context.Context, link *models.Link, urlHash string) (id int, reused bool, err error) {
+	err = n.conn(ctx).QueryRow(ctx, LinkCreateDedup,
+		link.LongLink, link.ClickCounter, link.OwnerID, link.IsActive, link.WorkspaceID, link.Passthrough, urlHash).Scan(&id)
+	if err != pgx.ErrNoRows {
+		return id, false, err
+	}
+	err = n.conn(ctx).QueryRow(ctx, LinkSelectByURLHash, link.OwnerID, urlHash, link.WorkspaceID).Scan(&id)
+	if err == pgx.ErrNoRows {
+		err = ErrNotFound
+	}
+	return id, true, err
+}
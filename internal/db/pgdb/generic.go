@@ -3,9 +3,11 @@ package pgdb
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
@@ -15,6 +17,9 @@ import (
 	"github.com/ptsypyshev/shortlink/internal/repositories/objrepo"
 )
 
+// uniqueViolation is the PostgreSQL error code of unique constraint violations
+const uniqueViolation = "23505"
+
 type Rowsable interface {
 	Scan(dest ...interface{}) error
 }
@@ -32,16 +37,20 @@ func DBNew[T objrepo.Modelable](p *pgxpool.Pool) *DB[T] {
 func (db *DB[T]) Create(ctx context.Context, obj T) (id int, err error) {
 	fields := obj.GetList()
 	query := switchQuery(obj, CreateQuery)
-	res := db.pool.QueryRow(
+	res := db.conn(ctx).QueryRow(
 		ctx, query, fields...,
 	)
 	err = res.Scan(&id)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		err = fmt.Errorf("%w: %s", objrepo.ErrDuplicate, pgErr.Message)
+	}
 	return
 }
 
 func (db *DB[T]) Read(ctx context.Context, id int, obj T) (T, error) {
 	query := switchQuery(obj, ReadQuery)
-	rows, err := db.pool.Query(ctx, query, id)
+	rows, err := db.conn(ctx).Query(ctx, query, id)
 	if err != nil {
 		return nil, err
 	}
@@ -56,8 +65,8 @@ func (db *DB[T]) Search(ctx context.Context, field any, value any, obj T) ([]T,
 	query := switchQuery(obj, SearchQuery)
 
 	fmt.Printf("Field: %v, value: %v\n", field, value)
-	//rows, err := db.pool.Query(ctx, query, field, value)
-	rows, err := db.pool.Query(ctx, query, value)
+	//rows, err := db.conn(ctx).Query(ctx, query, field, value)
+	rows, err := db.conn(ctx).Query(ctx, query, value)
 
 	if err != nil {
 		return nil, err
@@ -72,7 +81,10 @@ func (db *DB[T]) Update(ctx context.Context, obj T, newObj T) error {
 		err = fmt.Errorf("cannot compile query: %w", err)
 		return err
 	}
-	res, err := db.pool.Exec(ctx, UpdateQuery)
+	if UpdateQuery == "" {
+		return nil
+	}
+	res, err := db.conn(ctx).Exec(ctx, UpdateQuery)
 	if err != nil {
 		return err
 	}
@@ -86,34 +98,13 @@ func (db *DB[T]) Delete(ctx context.Context, id int) error {
 	)
 	query := switchQuery(obj, DeleteQuery)
 
-	res, err := db.pool.Exec(ctx, query, id)
+	res, err := db.conn(ctx).Exec(ctx, query, id)
 	if err != nil {
 		return err
 	}
 	return checkRowsAffected(res, "delete", obj)
 }
 
-func (db *DB[T]) Check(ctx context.Context, obj T) (T, bool) {
-	fields := obj.GetList()
-	switch obj.GetType() {
-	case models.UserType:
-		fields = fields[:2]
-	default:
-		fmt.Printf("cannot check %s type", obj.GetType())
-		return nil, false
-	}
-	fmt.Printf("Fields is %v\n", fields)
-	query := switchQuery(obj, CheckQuery)
-	row := db.pool.QueryRow(ctx, query, fields...)
-	checkedObj, err := setObjFields(row, obj)
-	if err != nil {
-		fmt.Println(err)
-		return nil, false
-	}
-
-	return checkedObj, true
-}
-
 func switchQuery[T objrepo.Modelable](obj T, queryType int) (query string) {
 	switch obj.GetType() {
 	case models.UserType:
@@ -140,8 +131,6 @@ func switchUserQuery(queryType int) (query string) {
 		query = UserDeleteByID
 	case SearchQuery:
 		query = UserSelectByField
-	case CheckQuery:
-		query = UserCheckPW
 	default:
 		panic("Unknown query type")
 	}
@@ -293,20 +282,25 @@ func setUserFields[R Rowsable, T objrepo.Modelable](rows R, obj T) (T, error) {
 	var (
 		id                                                    int
 		username, password, firstName, lastName, email, phone string
-		userstatus                                            bool
+		role                                                  string
+		userstatus, pendingVerification, totpEnabled          bool
 	)
-	if err := rows.Scan(&id, &username, &password, &firstName, &lastName, &email, &phone, &userstatus); err != nil {
+	if err := rows.Scan(&id, &username, &password, &firstName, &lastName, &email, &phone, &userstatus, &pendingVerification,
+		&totpEnabled, &role); err != nil {
 		return nil, err
 	}
 	mObjFields := map[string]interface{}{
-		"id":          id,
-		"username":    username,
-		"password":    password,
-		"first_name":  firstName,
-		"last_name":   lastName,
-		"email":       email,
-		"phone":       phone,
-		"user_status": userstatus,
+		"id":                   id,
+		"username":             username,
+		"password":             password,
+		"first_name":           firstName,
+		"last_name":            lastName,
+		"email":                email,
+		"phone":                phone,
+		"user_status":          userstatus,
+		"pending_verification": pendingVerification,
+		"totp_enabled":         totpEnabled,
+		"role":                 role,
 	}
 	err := obj.Set(mObjFields)
 	return obj, err
@@ -314,11 +308,19 @@ func setUserFields[R Rowsable, T objrepo.Modelable](rows R, obj T) (T, error) {
 
 func setLinkFields[R Rowsable, T objrepo.Modelable](rows R, obj T) (T, error) {
 	var (
-		id, clickCounter, ownerID int
-		longLink                  string
-		isActive                  bool
+		id, clickCounter, ownerID, workspaceID             int
+		longLink, title, description, imageURL, faviconURL string
+		passthrough                                        string
+		isActive, protected                                bool
+		utm                                                *models.UTM
+		schedule                                           *models.Schedule
+		health                                             *models.LinkHealth
+		targeting                                          []models.TargetRule
+		variants                                           []models.Variant
 	)
-	if err := rows.Scan(&id, &longLink, &clickCounter, &ownerID, &isActive); err != nil {
+	if err := rows.Scan(&id, &longLink, &clickCounter, &ownerID, &isActive,
+		&title, &description, &imageURL, &faviconURL, &workspaceID, &utm, &passthrough, &targeting,
+		&protected, &schedule, &health, &variants); err != nil {
 		return nil, err
 	}
 	mObjFields := map[string]interface{}{
@@ -327,6 +329,18 @@ func setLinkFields[R Rowsable, T objrepo.Modelable](rows R, obj T) (T, error) {
 		"click_counter": clickCounter,
 		"owner_id":      ownerID,
 		"is_active":     isActive,
+		"title":         title,
+		"description":   description,
+		"image_url":     imageURL,
+		"favicon_url":   faviconURL,
+		"workspace_id":  workspaceID,
+		"utm":           utm,
+		"passthrough":   passthrough,
+		"targeting":     targeting,
+		"protected":     protected,
+		"schedule":      schedule,
+		"health":        health,
+		"variants":      variants,
 	}
 	err := obj.Set(mObjFields)
 	return obj, err
@@ -334,16 +348,23 @@ func setLinkFields[R Rowsable, T objrepo.Modelable](rows R, obj T) (T, error) {
 
 func setShortLinkFields[R Rowsable, T objrepo.Modelable](rows R, obj T) (T, error) {
 	var (
-		id, longLinkID int
-		token          string
+		id, longLinkID, clickCounter int
+		token, domain, label         string
+		retiredAt                    *time.Time
+		utm                          *models.UTM
 	)
-	if err := rows.Scan(&id, &token, &longLinkID); err != nil {
+	if err := rows.Scan(&id, &token, &longLinkID, &domain, &label, &clickCounter, &retiredAt, &utm); err != nil {
 		return nil, err
 	}
 	mObjFields := map[string]interface{}{
-		"id":           id,
-		"token":        token,
-		"long_link_id": longLinkID,
+		"id":            id,
+		"token":         token,
+		"long_link_id":  longLinkID,
+		"domain":        domain,
+		"label":         label,
+		"click_counter": clickCounter,
+		"retired_at":    retiredAt,
+		"utm":           utm,
 	}
 	err := obj.Set(mObjFields)
 	return obj, err
@@ -362,6 +383,9 @@ func updateQueryCompilation(dbTable string, obj interface{}, newObj interface{})
 
 	var fmtStr string
 	fields, values := getChangedFieldsAndValues(objMap, newObjMap)
+	if len(values) == 0 {
+		return "", nil
+	}
 	if len(values) < 2 {
 		fmtStr = "UPDATE %s SET %s = (%s) WHERE id = %.0f;"
 	} else {
@@ -395,6 +419,11 @@ func getChangedFieldsAndValues(objMap, newObjMap map[string]interface{}) (fields
 		if k == "id" {
 			continue
 		}
+		// Slices and nested objects (e.g. link tags) are stored in separate tables
+		switch v.(type) {
+		case []interface{}, map[string]interface{}:
+			continue
+		}
 		if v != objMap[k] {
 			fields = append(fields, k)
 			var (
@@ -0,0 +1,44 @@
+package pgdb
+
+import (
+	"context"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const (
+	// Links which were never checked go first, then the ones checked longest ago
+	LinkSelectHealthCheck = `
+SELECT id, long_link, health FROM links WHERE is_active AND deleted_at IS NULL
+ORDER BY (health->>'checked_at')::timestamptz NULLS FIRST, id LIMIT $1;`
+	// The result is dropped if the destination was changed during the check
+	LinkSetHealth = `UPDATE links SET health = $1 WHERE id = $2 AND long_link = $3;`
+)
+
+// SearchHealthCheckLinks returns active links with their destinations and health for the next check.
+func (n *NGDB) SearchHealthCheckLinks(ctx context.Context, limit int) ([]*models.Link, error) {
+	rows, err := n.conn(ctx).Query(ctx, LinkSelectHealthCheck, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sliceLinks := make([]*models.Link, 0)
+	for rows.Next() {
+		link := &models.Link{IsActive: true}
+		if err := rows.Scan(&link.ID, &link.LongLink, &link.Health); err != nil {
+			return nil, err
+		}
+		sliceLinks = append(sliceLinks, link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sliceLinks, nil
+}
+
+// SetLinkHealth stores the check result of the destination, it is ignored if the link has another destination now.
+func (n *NGDB) SetLinkHealth(ctx context.Context, linkID int, destination string, health *models.LinkHealth) error {
+	_, err := n.conn(ctx).Exec(ctx, LinkSetHealth, health, linkID, destination)
+	return err
+}
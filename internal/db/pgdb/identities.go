@@ -0,0 +1,71 @@
+package pgdb
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const (
+	UserSelectByIdentity = `
+SELECT ` + UserColumnsPrefixed + ` FROM users JOIN user_identities ON user_identities.user_id = users.id
+WHERE issuer = $1 AND subject = $2 AND users.deleted_at IS NULL;`
+	UserColumnsPrefixed = `users.id, username, password, first_name, last_name, email, phone, user_status, pending_verification,
+    totp_enabled, role`
+	IdentityCreate = `INSERT INTO user_identities(user_id, issuer, subject) VALUES ($1, $2, $3);`
+	UserSetRole    = `UPDATE users SET role = $1 WHERE id = $2;`
+	IdentityExists = `SELECT EXISTS (SELECT 1 FROM user_identities WHERE user_id = $1);`
+)
+
+// HasUserIdentity reports whether the user signs in with an external identity provider.
+func (n *NGDB) HasUserIdentity(ctx context.Context, id int) (exists bool, err error) {
+	err = n.conn(ctx).QueryRow(ctx, IdentityExists, id).Scan(&exists)
+	return
+}
+
+// FindUserByIdentity returns nil without error if the identity is not linked to any user.
+func (n *NGDB) FindUserByIdentity(ctx context.Context, issuer, subject string) (*models.User, error) {
+	rows, err := n.conn(ctx).Query(ctx, UserSelectByIdentity, issuer, subject)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	user, err := setUserFieldsNG(rows)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// CreateUserWithIdentity provisions an externally authenticated user, the user has no local password.
+func (n *NGDB) CreateUserWithIdentity(ctx context.Context, user *models.User, issuer, subject string) (id int, err error) {
+	err = n.conn(ctx).BeginFunc(ctx, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx, UserCreate, user.GetList()...).Scan(&id); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, IdentityCreate, id, issuer, subject)
+		return err
+	})
+	return
+}
+
+func (n *NGDB) LinkUserIdentity(ctx context.Context, id int, issuer, subject string) error {
+	_, err := n.conn(ctx).Exec(ctx, IdentityCreate, id, issuer, subject)
+	return err
+}
+
+func (n *NGDB) SetUserRole(ctx context.Context, id int, role string) error {
+	res, err := n.conn(ctx).Exec(ctx, UserSetRole, role, id)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffectedNG(res, "update", models.UserType)
+}
@@ -2,7 +2,10 @@ package pgdb
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 
@@ -11,6 +14,8 @@ import (
 
 const AllObjects = "all"
 
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
 type NGDB struct {
 	pool *pgxpool.Pool
 }
@@ -29,10 +34,13 @@ func (n *NGDB) SearchUsers(ctx context.Context, field any, value any) ([]*models
 
 	if field == AllObjects {
 		query := UserSelectAll
-		rows, err = n.pool.Query(ctx, query)
+		rows, err = n.conn(ctx).Query(ctx, query)
+	} else if field == "email" {
+		query := UserSelectByEmail
+		rows, err = n.conn(ctx).Query(ctx, query, value)
 	} else {
 		query := UserSelectByField
-		rows, err = n.pool.Query(ctx, query, value)
+		rows, err = n.conn(ctx).Query(ctx, query, value)
 	}
 
 	if err != nil {
@@ -54,10 +62,26 @@ func (n *NGDB) SearchUsers(ctx context.Context, field any, value any) ([]*models
 	return sliceUsers, nil
 }
 
+func (n *NGDB) SetUserPassword(ctx context.Context, id int, hash string) error {
+	res, err := n.conn(ctx).Exec(ctx, UserSetPassword, hash, id)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffectedNG(res, "update", models.UserType)
+}
+
+func (n *NGDB) VerifyUserEmail(ctx context.Context, id int, email string) error {
+	res, err := n.conn(ctx).Exec(ctx, UserVerifyEmail, id, email)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffectedNG(res, "verify", models.UserType)
+}
+
 func (n *NGDB) SearchLinks(ctx context.Context, field any, value any) ([]*models.Link, error) {
 	query := LinkSelectByField
 
-	rows, err := n.pool.Query(ctx, query, value)
+	rows, err := n.conn(ctx).Query(ctx, query, value)
 	if err != nil {
 		return nil, err
 	}
@@ -77,48 +101,140 @@ func (n *NGDB) SearchLinks(ctx context.Context, field any, value any) ([]*models
 	return sliceLinks, nil
 }
 
-func setUserFieldsNG(rows pgx.Rows) (models.User, error) {
+// setUserFieldsNG scans UserColumns followed by extra columns.
+func setUserFieldsNG(rows pgx.Rows, extra ...any) (models.User, error) {
 	var (
 		id                                                    int
 		username, password, firstName, lastName, email, phone string
-		userstatus                                            bool
+		role                                                  string
+		userstatus, pendingVerification, totpEnabled          bool
 		userStruct                                            models.User
 	)
-	if err := rows.Scan(&id, &username, &password, &firstName, &lastName, &email, &phone, &userstatus); err != nil {
+	dest := append([]any{&id, &username, &password, &firstName, &lastName, &email, &phone, &userstatus, &pendingVerification,
+		&totpEnabled, &role}, extra...)
+	if err := rows.Scan(dest...); err != nil {
 		return userStruct, err
 	}
 	mUserFields := map[string]interface{}{
-		"id":          id,
-		"username":    username,
-		"password":    password,
-		"first_name":  firstName,
-		"last_name":   lastName,
-		"email":       email,
-		"phone":       phone,
-		"user_status": userstatus,
+		"id":                   id,
+		"username":             username,
+		"password":             password,
+		"first_name":           firstName,
+		"last_name":            lastName,
+		"email":                email,
+		"phone":                phone,
+		"user_status":          userstatus,
+		"pending_verification": pendingVerification,
+		"totp_enabled":         totpEnabled,
+		"role":                 role,
 	}
 
 	err := userStruct.Set(mUserFields)
 	return userStruct, err
 }
 
-func setLinkFieldsNG(rows pgx.Rows) (models.Link, error) {
+func (n *NGDB) SearchLinksByFilter(ctx context.Context, workspaceID int, tag, text string) ([]*models.Link, error) {
+	if text != "" {
+		text = "%" + likeEscaper.Replace(text) + "%"
+	}
+	rows, err := n.conn(ctx).Query(ctx, LinkSelectByFilter, workspaceID, tag, text)
+	if err != nil {
+		return nil, err
+	}
+
+	sliceLinks := make([]*models.Link, 0)
+	for rows.Next() {
+		newlink, err := setLinkFieldsNG(rows)
+		if err != nil {
+			return nil, err
+		}
+		sliceLinks = append(sliceLinks, &newlink)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sliceLinks, nil
+}
+
+func (n *NGDB) SetLinkMetadata(ctx context.Context, linkID int, meta *models.LinkMetadata) error {
+	res, err := n.conn(ctx).Exec(ctx, LinkSetMetadata, meta.Title, meta.Description, meta.ImageURL, meta.FaviconURL, linkID)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffectedNG(res, "update", models.LinkType)
+}
+
+func (n *NGDB) CountLinkClick(ctx context.Context, id int) error {
+	res, err := n.conn(ctx).Exec(ctx, LinkCountClick, id)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffectedNG(res, "count click", models.LinkType)
+}
+
+// ResolveShortLink finds the shortlink by the token on the short domain, empty domain is the default one.
+func (n *NGDB) ResolveShortLink(ctx context.Context, domain, token string) (*models.ShortLink, error) {
+	rows, err := n.conn(ctx).Query(ctx, ShortLinkSelectByDomainToken, domain, token)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return getObjectFromRows(rows, &models.ShortLink{})
+}
+
+// setLinkFieldsNG scans LinkListColumns followed by extra columns.
+func setLinkFieldsNG(rows pgx.Rows, extra ...any) (models.Link, error) {
 	var (
-		clickCounter, ownerID    int
-		longLink, shortLinkToken string
-		isActive                 bool
-		linkStruct               models.Link
+		id, clickCounter, ownerID, workspaceID   int
+		longLink, shortLinkToken, domain         string
+		passthrough                              string
+		title, description, imageURL, faviconURL string
+		isActive, protected                      bool
+		tags                                     []string
+		utm                                      *models.UTM
+		schedule                                 *models.Schedule
+		health                                   *models.LinkHealth
+		targeting                                []models.TargetRule
+		variants                                 []models.Variant
+		linkStruct                               models.Link
 	)
-	if err := rows.Scan(&longLink, &shortLinkToken, &clickCounter, &isActive); err != nil {
+	dest := append([]any{&id, &longLink, &shortLinkToken, &clickCounter, &isActive, &tags,
+		&title, &description, &imageURL, &faviconURL, &ownerID, &workspaceID, &domain, &utm, &passthrough,
+		&targeting, &protected, &schedule, &health, &variants}, extra...)
+	if err := rows.Scan(dest...); err != nil {
 		return linkStruct, err
 	}
 	mLinkFields := map[string]interface{}{
+		"id":            id,
 		"long_link":     longLink,
 		"click_counter": clickCounter,
 		"owner_id":      ownerID,
 		"is_active":     isActive,
 		"short_link":    shortLinkToken,
+		"tags":          tags,
+		"title":         title,
+		"description":   description,
+		"image_url":     imageURL,
+		"favicon_url":   faviconURL,
+		"workspace_id":  workspaceID,
+		"domain":        domain,
+		"utm":           utm,
+		"passthrough":   passthrough,
+		"targeting":     targeting,
+		"protected":     protected,
+		"schedule":      schedule,
+		"health":        health,
+		"variants":      variants,
 	}
 	err := linkStruct.Set(mLinkFields)
 	return linkStruct, err
 }
+
+func checkRowsAffectedNG(res pgconn.CommandTag, operation, objType string) error {
+	if rowsAffected := res.RowsAffected(); rowsAffected != 1 {
+		err := fmt.Errorf("%s %s error: %d rows affected", operation, objType, rowsAffected)
+		return err
+	}
+	return nil
+}
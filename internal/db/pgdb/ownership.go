@@ -0,0 +1,125 @@
+package pgdb
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+	"github.com/ptsypyshev/shortlink/internal/repositories/objrepo"
+)
+
+const (
+	UserExists = `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND deleted_at IS NULL);`
+	// Links in the personal workspace of the previous owner move to the personal workspace of the new one
+	LinkTransfer = `
+UPDATE links SET owner_id = $2, workspace_id = CASE
+    WHEN workspace_id = (SELECT id FROM workspaces WHERE personal_user_id = $1)
+    THEN (SELECT id FROM workspaces WHERE personal_user_id = $2) ELSE workspace_id END
+WHERE owner_id = $1 AND ($3::int[] IS NULL OR id = ANY($3)) RETURNING id;`
+	// Tags are per owner, so the new owner gets own tags with the same names
+	LinkTagsTransfer = `
+INSERT INTO tags(name, owner_id)
+SELECT DISTINCT tags.name, $2::int FROM link_tags JOIN tags ON tags.id = link_tags.tag_id
+WHERE link_tags.link_id = ANY($1)
+ON CONFLICT DO NOTHING;`
+	LinkTagsReassign = `
+UPDATE link_tags SET tag_id = new_tags.id FROM tags AS old_tags, tags AS new_tags
+WHERE link_tags.tag_id = old_tags.id AND old_tags.owner_id <> $2
+  AND new_tags.name = old_tags.name AND new_tags.owner_id = $2 AND link_tags.link_id = ANY($1);`
+	// Collections are per owner too, transferred links leave collections of the previous owner
+	LinkCollectionsDetach = `
+DELETE FROM collection_links USING collections
+WHERE collection_links.collection_id = collections.id AND collections.owner_id <> $2
+  AND collection_links.link_id = ANY($1);`
+	LinkDeactivateByOwner = `
+UPDATE links SET is_active = false
+WHERE owner_id = $1 AND deleted_at IS NULL AND is_active IS DISTINCT FROM false RETURNING id;`
+	LinkDeleteByOwner = `UPDATE links SET deleted_at = now() WHERE owner_id = $1 AND deleted_at IS NULL RETURNING id;`
+)
+
+// TransferLinks moves links (all links if linkIDs is nil) from one user to another in one transaction
+// together with the audit entries built by record for the moved links.
+func (n *NGDB) TransferLinks(ctx context.Context, fromID, toID int, linkIDs []int,
+	record func(linkIDs []int) []*models.AuditEntry) (transferred []int, err error) {
+	err = n.conn(ctx).BeginFunc(ctx, func(tx pgx.Tx) error {
+		if transferred, err = transferLinks(ctx, tx, fromID, toID, linkIDs); err != nil {
+			return err
+		}
+		if linkIDs != nil && len(transferred) != len(linkIDs) {
+			return objrepo.ErrLinksNotOwned
+		}
+		return createAuditEntries(ctx, tx, record(transferred))
+	})
+	return
+}
+
+// OffboardUser moves the user to the trash and transfers, deactivates or deletes the user links
+// in one transaction together with the audit entries built by record for the affected links.
+func (n *NGDB) OffboardUser(ctx context.Context, id, toID int, linksAction string,
+	record func(linkIDs []int) []*models.AuditEntry) error {
+	return n.conn(ctx).BeginFunc(ctx, func(tx pgx.Tx) error {
+		var (
+			linkIDs []int
+			err     error
+		)
+		switch linksAction {
+		case models.LinksTransfer:
+			linkIDs, err = transferLinks(ctx, tx, id, toID, nil)
+		case models.LinksDeactivate:
+			linkIDs, err = queryIDs(ctx, tx, LinkDeactivateByOwner, id)
+		case models.LinksDelete:
+			linkIDs, err = queryIDs(ctx, tx, LinkDeleteByOwner, id)
+		default:
+			err = objrepo.ErrBadLinksAction
+		}
+		if err != nil {
+			return err
+		}
+		res, err := tx.Exec(ctx, UserDeleteByID, id)
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() != 1 {
+			return ErrNotFound
+		}
+		return createAuditEntries(ctx, tx, record(linkIDs))
+	})
+}
+
+func transferLinks(ctx context.Context, tx pgx.Tx, fromID, toID int, linkIDs []int) ([]int, error) {
+	var exists bool
+	if err := tx.QueryRow(ctx, UserExists, toID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, objrepo.ErrNewOwnerNotFound
+	}
+	transferred, err := queryIDs(ctx, tx, LinkTransfer, fromID, toID, linkIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, query := range []string{LinkTagsTransfer, LinkTagsReassign, LinkCollectionsDetach} {
+		if _, err := tx.Exec(ctx, query, transferred, toID); err != nil {
+			return nil, err
+		}
+	}
+	return transferred, nil
+}
+
+func queryIDs(ctx context.Context, tx pgx.Tx, query string, args ...interface{}) ([]int, error) {
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanIDs(rows)
+}
+
+func createAuditEntries(ctx context.Context, tx pgx.Tx, entries []*models.AuditEntry) error {
+	for _, entry := range entries {
+		if err := createAuditEntry(ctx, tx, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package pgdb
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const (
+	PasswordResetCreate = `
+INSERT INTO password_resets(user_id, token_hash, expires_at)
+VALUES
+    ($1, $2, $3);
+`
+	PasswordResetSelect = `
+SELECT user_id FROM password_resets
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now();`
+	PasswordResetUse = `
+UPDATE password_resets SET used_at = now()
+WHERE token_hash = $1 AND user_id = $2 AND used_at IS NULL AND expires_at > now();`
+	PasswordResetUseAll   = `UPDATE password_resets SET used_at = now() WHERE user_id = $1 AND used_at IS NULL;`
+	UserResetPassword     = `UPDATE users SET (password, sessions_revoked_at) = ($1, now()) WHERE id = $2;`
+	UserSessionsDeleteAll = `DELETE FROM sessions WHERE user_id = $1;`
+)
+
+func (n *NGDB) CreatePasswordReset(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	_, err := n.conn(ctx).Exec(ctx, PasswordResetCreate, userID, tokenHash, expiresAt)
+	return err
+}
+
+func (n *NGDB) FindPasswordReset(ctx context.Context, tokenHash string) (userID int, err error) {
+	err = n.conn(ctx).QueryRow(ctx, PasswordResetSelect, tokenHash).Scan(&userID)
+	if err == pgx.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	return
+}
+
+// ResetPassword consumes the reset token, sets the new password hash, revokes all sessions of the user
+// and invalidates all other reset tokens of the user in one transaction.
+func (n *NGDB) ResetPassword(ctx context.Context, tokenHash string, userID int, passwordHash string) error {
+	return n.conn(ctx).BeginFunc(ctx, func(tx pgx.Tx) error {
+		res, err := tx.Exec(ctx, PasswordResetUse, tokenHash, userID)
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() != 1 {
+			return ErrNotFound
+		}
+		if _, err := tx.Exec(ctx, PasswordResetUseAll, userID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, UserSessionsDeleteAll, userID); err != nil {
+			return err
+		}
+		res, err = tx.Exec(ctx, UserResetPassword, passwordHash, userID)
+		if err != nil {
+			return err
+		}
+		return checkRowsAffectedNG(res, "update", models.UserType)
+	})
+}
+
+// SessionsRevokedAt returns the time before which all sessions of the user are invalid (zero if never revoked).
+func (n *NGDB) SessionsRevokedAt(ctx context.Context, username string) (time.Time, error) {
+	var revokedAt *time.Time
+	err := n.conn(ctx).QueryRow(ctx, UserSessionsRevokedAt, username).Scan(&revokedAt)
+	if err == pgx.ErrNoRows {
+		return time.Time{}, ErrNotFound
+	}
+	if err != nil || revokedAt == nil {
+		return time.Time{}, err
+	}
+	return *revokedAt, nil
+}
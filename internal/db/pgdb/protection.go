@@ -0,0 +1,31 @@
+package pgdb
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const (
+	LinkSetPasswordHash    = `UPDATE links SET password_hash = $1 WHERE id = $2;`
+	LinkSelectPasswordHash = `SELECT password_hash FROM links WHERE id = $1 AND deleted_at IS NULL;`
+)
+
+// SetLinkPasswordHash stores the passphrase hash of the link, empty hash makes the link public.
+func (n *NGDB) SetLinkPasswordHash(ctx context.Context, linkID int, hash string) error {
+	res, err := n.conn(ctx).Exec(ctx, LinkSetPasswordHash, hash, linkID)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffectedNG(res, "set password", models.LinkType)
+}
+
+func (n *NGDB) GetLinkPasswordHash(ctx context.Context, linkID int) (hash string, err error) {
+	err = n.conn(ctx).QueryRow(ctx, LinkSelectPasswordHash, linkID).Scan(&hash)
+	if err == pgx.ErrNoRows {
+		return "", ErrNotFound
+	}
+	return
+}
@@ -0,0 +1,22 @@
+package pgdb
+
+import (
+	"context"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const LinkSetSchedule = `UPDATE links SET schedule = $1 WHERE id = $2;`
+
+// SetLinkSchedule stores the schedule of the link, empty schedule is removed.
+func (n *NGDB) SetLinkSchedule(ctx context.Context, linkID int, schedule *models.Schedule) error {
+	var value interface{}
+	if !schedule.IsZero() {
+		value = schedule
+	}
+	res, err := n.conn(ctx).Exec(ctx, LinkSetSchedule, value, linkID)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffectedNG(res, "set schedule", models.LinkType)
+}
@@ -0,0 +1,120 @@
+package pgdb
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const (
+	SessionColumns = `id, COALESCE(user_id, 0), created_at, last_seen_at, expires_at, ip, user_agent`
+	SessionLoad    = `SELECT data FROM sessions WHERE token_hash = $1 AND expires_at > now();`
+	SessionSelect  = `SELECT ` + SessionColumns + ` FROM sessions WHERE token_hash = $1 AND expires_at > now();`
+	SessionSave    = `
+INSERT INTO sessions(token_hash, user_id, data, ip, user_agent, expires_at)
+VALUES
+    ($1, (SELECT id FROM users WHERE username = $2), $3, $4, $5, $6)
+ON CONFLICT (token_hash) DO UPDATE
+SET (user_id, data, last_seen_at) = (EXCLUDED.user_id, EXCLUDED.data, now());`
+	SessionTouch         = `UPDATE sessions SET (last_seen_at, ip, user_agent) = (now(), $2, $3) WHERE token_hash = $1;`
+	SessionDelete        = `DELETE FROM sessions WHERE token_hash = $1;`
+	SessionDeleteExpired = `DELETE FROM sessions WHERE expires_at <= now();`
+	UserSessionsSelect   = `
+SELECT ` + SessionColumns + ` FROM sessions WHERE user_id = $1 AND expires_at > now() ORDER BY last_seen_at DESC;`
+	UserSessionDelete  = `DELETE FROM sessions WHERE user_id = $1 AND id = $2;`
+	UserSessionsDelete = `DELETE FROM sessions WHERE user_id = $1 AND id <> $2;`
+)
+
+// LoadSession returns nil data if the session does not exist or is expired.
+func (n *NGDB) LoadSession(ctx context.Context, tokenHash string) (data []byte, err error) {
+	err = n.conn(ctx).QueryRow(ctx, SessionLoad, tokenHash).Scan(&data)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return
+}
+
+// SaveSession creates or updates the session, the username binds it to the user (empty for anonymous sessions).
+// The expiry is set at creation only, so sessions cannot be prolonged beyond the absolute timeout.
+func (n *NGDB) SaveSession(ctx context.Context, tokenHash, username string, data []byte, ip, userAgent string,
+	expiresAt time.Time) error {
+	_, err := n.conn(ctx).Exec(ctx, SessionSave, tokenHash, username, data, ip, userAgent, expiresAt)
+	return err
+}
+
+func (n *NGDB) GetSession(ctx context.Context, tokenHash string) (*models.Session, error) {
+	rows, err := n.conn(ctx).Query(ctx, SessionSelect, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := getSessionsFromRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, ErrNotFound
+	}
+	return sessions[0], nil
+}
+
+func (n *NGDB) TouchSession(ctx context.Context, tokenHash, ip, userAgent string) error {
+	_, err := n.conn(ctx).Exec(ctx, SessionTouch, tokenHash, ip, userAgent)
+	return err
+}
+
+func (n *NGDB) DeleteSession(ctx context.Context, tokenHash string) error {
+	_, err := n.conn(ctx).Exec(ctx, SessionDelete, tokenHash)
+	return err
+}
+
+func (n *NGDB) DeleteExpiredSessions(ctx context.Context) (int64, error) {
+	res, err := n.conn(ctx).Exec(ctx, SessionDeleteExpired)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+func (n *NGDB) GetUserSessions(ctx context.Context, userID int) ([]*models.Session, error) {
+	rows, err := n.conn(ctx).Query(ctx, UserSessionsSelect, userID)
+	if err != nil {
+		return nil, err
+	}
+	return getSessionsFromRows(rows)
+}
+
+func (n *NGDB) DeleteUserSession(ctx context.Context, userID, id int) error {
+	res, err := n.conn(ctx).Exec(ctx, UserSessionDelete, userID, id)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffectedNG(res, "delete", models.SessionType)
+}
+
+// DeleteUserSessions deletes all sessions of the user except the one with exceptID (0 deletes all).
+func (n *NGDB) DeleteUserSessions(ctx context.Context, userID, exceptID int) (int64, error) {
+	res, err := n.conn(ctx).Exec(ctx, UserSessionsDelete, userID, exceptID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+func getSessionsFromRows(rows pgx.Rows) ([]*models.Session, error) {
+	defer rows.Close()
+	sessions := make([]*models.Session, 0)
+	for rows.Next() {
+		var s models.Session
+		if err := rows.Scan(&s.ID, &s.UserID, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt, &s.IP, &s.UserAgent); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
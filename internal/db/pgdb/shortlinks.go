@@ -0,0 +1,70 @@
+package pgdb
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+	"github.com/ptsypyshev/shortlink/internal/repositories/objrepo"
+)
+
+const (
+	ShortLinkSelectByLink = `
+SELECT ` + ShortLinkColumns + ` FROM shortlinks WHERE long_link_id = $1 ORDER BY retired_at IS NOT NULL, id;`
+	ShortLinkRetire = `
+UPDATE shortlinks SET retired_at = now() WHERE id = $1 AND long_link_id = $2 AND retired_at IS NULL;`
+	ShortLinkActiveCount = `SELECT COUNT(*) FROM shortlinks WHERE long_link_id = $1 AND retired_at IS NULL;`
+	ShortLinkCountClick  = `UPDATE shortlinks SET click_counter = click_counter + 1 WHERE id = $1;`
+)
+
+// SearchLinkShortLinks returns tokens of the link, active tokens go first.
+func (n *NGDB) SearchLinkShortLinks(ctx context.Context, linkID int) ([]*models.ShortLink, error) {
+	rows, err := n.conn(ctx).Query(ctx, ShortLinkSelectByLink, linkID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shortlinks := make([]*models.ShortLink, 0)
+	for rows.Next() {
+		shortlink, err := setShortLinkFields(rows, &models.ShortLink{})
+		if err != nil {
+			return nil, err
+		}
+		shortlinks = append(shortlinks, shortlink)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return shortlinks, nil
+}
+
+// RetireShortLink stops redirects by the token of the link, the link keeps at least one active token.
+func (n *NGDB) RetireShortLink(ctx context.Context, linkID, id int) error {
+	return n.conn(ctx).BeginFunc(ctx, func(tx pgx.Tx) error {
+		res, err := tx.Exec(ctx, ShortLinkRetire, id, linkID)
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() != 1 {
+			return ErrNotFound
+		}
+		var active int
+		if err := tx.QueryRow(ctx, ShortLinkActiveCount, linkID).Scan(&active); err != nil {
+			return err
+		}
+		if active == 0 {
+			return objrepo.ErrLastToken
+		}
+		return nil
+	})
+}
+
+func (n *NGDB) CountShortLinkClick(ctx context.Context, id int) error {
+	res, err := n.conn(ctx).Exec(ctx, ShortLinkCountClick, id)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffectedNG(res, "count click", models.ShortLinkType)
+}
@@ -0,0 +1,151 @@
+package pgdb
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const (
+	TagCreate = `
+INSERT INTO tags(name, owner_id)
+VALUES
+    ($1, $2)
+RETURNING id;
+`
+	TagUpsert = `
+INSERT INTO tags(name, owner_id)
+VALUES
+    ($1, $2)
+ON CONFLICT (owner_id, name) DO UPDATE SET name = EXCLUDED.name
+RETURNING id;
+`
+	TagSelectByID = `
+SELECT tags.id, tags.name, tags.owner_id, COUNT(link_tags.link_id) FROM tags
+LEFT JOIN link_tags ON link_tags.tag_id = tags.id
+WHERE tags.id = $1 AND tags.owner_id = $2 GROUP BY tags.id;`
+	TagSelectByOwner = `
+SELECT tags.id, tags.name, tags.owner_id, COUNT(link_tags.link_id) FROM tags
+LEFT JOIN link_tags ON link_tags.tag_id = tags.id
+WHERE tags.owner_id = $1 GROUP BY tags.id ORDER BY tags.name;`
+	TagUpdate      = `UPDATE tags SET name = $1 WHERE id = $2 AND owner_id = $3;`
+	TagDeleteByID  = `DELETE FROM tags WHERE id = $1 AND owner_id = $2;`
+	LinkTagsDelete = `DELETE FROM link_tags WHERE link_id = $1;`
+	LinkTagsInsert = `INSERT INTO link_tags(link_id, tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING;`
+	LinkTagsSelect = `
+SELECT tags.name FROM link_tags JOIN tags ON tags.id = link_tags.tag_id
+WHERE link_tags.link_id = $1 ORDER BY tags.name;`
+)
+
+func (n *NGDB) CreateTag(ctx context.Context, tag *models.Tag) (id int, err error) {
+	err = n.conn(ctx).QueryRow(ctx, TagCreate, tag.Name, tag.OwnerID).Scan(&id)
+	return
+}
+
+func (n *NGDB) ReadTag(ctx context.Context, id, ownerID int) (*models.Tag, error) {
+	rows, err := n.conn(ctx).Query(ctx, TagSelectByID, id, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := getTagsFromRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) == 0 {
+		return nil, ErrNotFound
+	}
+	return tags[0], nil
+}
+
+func (n *NGDB) SearchTags(ctx context.Context, ownerID int) ([]*models.Tag, error) {
+	rows, err := n.conn(ctx).Query(ctx, TagSelectByOwner, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	return getTagsFromRows(rows)
+}
+
+func (n *NGDB) UpdateTag(ctx context.Context, tag *models.Tag) error {
+	res, err := n.conn(ctx).Exec(ctx, TagUpdate, tag.Name, tag.ID, tag.OwnerID)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffectedNG(res, "update", models.TagType)
+}
+
+func (n *NGDB) DeleteTag(ctx context.Context, id, ownerID int) error {
+	res, err := n.conn(ctx).Exec(ctx, TagDeleteByID, id, ownerID)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffectedNG(res, "delete", models.TagType)
+}
+
+// SetLinkTags replaces all tags of the link, creating missing tags for the owner.
+func (n *NGDB) SetLinkTags(ctx context.Context, linkID, ownerID int, tags []string) error {
+	return n.conn(ctx).BeginFunc(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, LinkTagsDelete, linkID); err != nil {
+			return err
+		}
+		for _, name := range tags {
+			var tagID int
+			if err := tx.QueryRow(ctx, TagUpsert, name, ownerID).Scan(&tagID); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, LinkTagsInsert, linkID, tagID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (n *NGDB) GetLinkTags(ctx context.Context, linkID int) ([]string, error) {
+	rows, err := n.conn(ctx).Query(ctx, LinkTagsSelect, linkID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tags = append(tags, name)
+	}
+	return tags, rows.Err()
+}
+
+func getTagsFromRows(rows pgx.Rows) ([]*models.Tag, error) {
+	defer rows.Close()
+
+	sliceTags := make([]*models.Tag, 0)
+	for rows.Next() {
+		var (
+			id, ownerID, linkCount int
+			name                   string
+			tag                    models.Tag
+		)
+		if err := rows.Scan(&id, &name, &ownerID, &linkCount); err != nil {
+			return nil, err
+		}
+		mTagFields := map[string]interface{}{
+			"id":         id,
+			"name":       name,
+			"owner_id":   ownerID,
+			"link_count": linkCount,
+		}
+		if err := tag.Set(mTagFields); err != nil {
+			return nil, err
+		}
+		sliceTags = append(sliceTags, &tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sliceTags, nil
+}
@@ -0,0 +1,22 @@
+package pgdb
+
+import (
+	"context"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const LinkSetTargeting = `UPDATE links SET targeting = $1 WHERE id = $2;`
+
+// SetLinkTargeting stores targeting rules of the link, empty rules are removed.
+func (n *NGDB) SetLinkTargeting(ctx context.Context, linkID int, rules []models.TargetRule) error {
+	var value interface{}
+	if len(rules) > 0 {
+		value = rules
+	}
+	res, err := n.conn(ctx).Exec(ctx, LinkSetTargeting, value, linkID)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffectedNG(res, "set targeting", models.LinkType)
+}
@@ -0,0 +1,130 @@
+package pgdb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const (
+	LinkSelectDeleted = `
+SELECT ` + LinkListColumns + `, deleted_at FROM links, shortlinks
+WHERE links.id = shortlinks.long_link_id AND ` + LinkPrimaryShortLink + ` AND owner_id = $1 AND deleted_at IS NOT NULL
+ORDER BY deleted_at DESC;`
+	LinkDeletedWorkspace = `SELECT workspace_id FROM links WHERE id = $1 AND deleted_at IS NOT NULL;`
+	LinkRestore          = `UPDATE links SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL;`
+	// Shortlinks of purged links are detached by the foreign key, so their tokens stay reserved
+	LinkPurge = `DELETE FROM links WHERE deleted_at < $1 RETURNING id;`
+
+	UserSelectDeleted = `
+SELECT ` + UserColumns + `, deleted_at FROM users WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC;`
+	UserRestore = `UPDATE users SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL;`
+	UserPurge   = `DELETE FROM users WHERE deleted_at < $1 RETURNING id;`
+)
+
+func (n *NGDB) SearchDeletedLinks(ctx context.Context, ownerID int) ([]*models.Link, error) {
+	rows, err := n.conn(ctx).Query(ctx, LinkSelectDeleted, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	sliceLinks := make([]*models.Link, 0)
+	for rows.Next() {
+		var deletedAt time.Time
+		newlink, err := setLinkFieldsNG(rows, &deletedAt)
+		if err != nil {
+			return nil, err
+		}
+		newlink.DeletedAt = &deletedAt
+		sliceLinks = append(sliceLinks, &newlink)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sliceLinks, nil
+}
+
+func (n *NGDB) SearchDeletedUsers(ctx context.Context) ([]*models.User, error) {
+	rows, err := n.conn(ctx).Query(ctx, UserSelectDeleted)
+	if err != nil {
+		return nil, err
+	}
+
+	sliceUsers := make([]*models.User, 0)
+	for rows.Next() {
+		var deletedAt time.Time
+		newuser, err := setUserFieldsNG(rows, &deletedAt)
+		if err != nil {
+			return nil, err
+		}
+		newuser.DeletedAt = &deletedAt
+		sliceUsers = append(sliceUsers, &newuser)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sliceUsers, nil
+}
+
+// DeletedLinkWorkspace returns the workspace of the link in the trash.
+func (n *NGDB) DeletedLinkWorkspace(ctx context.Context, id int) (int, error) {
+	var workspaceID int
+	err := n.conn(ctx).QueryRow(ctx, LinkDeletedWorkspace, id).Scan(&workspaceID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	return workspaceID, err
+}
+
+// RestoreLink returns the number of restored links, 0 if the link is not in the trash.
+func (n *NGDB) RestoreLink(ctx context.Context, id int) (int64, error) {
+	res, err := n.conn(ctx).Exec(ctx, LinkRestore, id)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+// RestoreUser returns the number of restored users, 0 if the user is not in the trash.
+func (n *NGDB) RestoreUser(ctx context.Context, id int) (int64, error) {
+	res, err := n.conn(ctx).Exec(ctx, UserRestore, id)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+// PurgeLinks hard-deletes links moved to the trash before the given time and returns their ids.
+func (n *NGDB) PurgeLinks(ctx context.Context, before time.Time) ([]int, error) {
+	rows, err := n.conn(ctx).Query(ctx, LinkPurge, before)
+	if err != nil {
+		return nil, err
+	}
+	return scanIDs(rows)
+}
+
+// PurgeUsers hard-deletes users moved to the trash before the given time and returns their ids.
+func (n *NGDB) PurgeUsers(ctx context.Context, before time.Time) ([]int, error) {
+	rows, err := n.conn(ctx).Query(ctx, UserPurge, before)
+	if err != nil {
+		return nil, err
+	}
+	return scanIDs(rows)
+}
+
+func scanIDs(rows pgx.Rows) ([]int, error) {
+	defer rows.Close()
+	ids := make([]int, 0)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,109 @@
+package pgdb
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const (
+	UserTOTPSelect    = `SELECT totp_secret, totp_enabled, totp_last_counter FROM users WHERE id = $1;`
+	UserTOTPSetSecret = `UPDATE users SET totp_secret = $1 WHERE id = $2 AND NOT totp_enabled;`
+	UserTOTPEnable    = `
+UPDATE users SET (totp_enabled, totp_last_counter) = (true, $1)
+WHERE id = $2 AND NOT totp_enabled AND totp_secret <> '';`
+	UserTOTPUseCounter = `UPDATE users SET totp_last_counter = $1 WHERE id = $2 AND totp_last_counter < $1;`
+	UserTOTPReset      = `
+UPDATE users SET (totp_secret, totp_enabled, totp_last_counter) = ('', false, 0) WHERE id = $1;`
+	RecoveryCodesDelete = `DELETE FROM recovery_codes WHERE user_id = $1;`
+	RecoveryCodeInsert  = `INSERT INTO recovery_codes(user_id, code_hash) VALUES ($1, $2);`
+	RecoveryCodeUse     = `
+UPDATE recovery_codes SET used_at = now() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;`
+	RecoveryCodesCount = `SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL;`
+)
+
+func (n *NGDB) GetUserTOTP(ctx context.Context, id int) (secret string, enabled bool, lastCounter int64, err error) {
+	err = n.conn(ctx).QueryRow(ctx, UserTOTPSelect, id).Scan(&secret, &enabled, &lastCounter)
+	if err == pgx.ErrNoRows {
+		err = ErrNotFound
+	}
+	return
+}
+
+func (n *NGDB) SetUserTOTPSecret(ctx context.Context, id int, secret string) error {
+	res, err := n.conn(ctx).Exec(ctx, UserTOTPSetSecret, secret, id)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffectedNG(res, "update", models.UserType)
+}
+
+// EnableUserTOTP turns on 2FA for the user and replaces the recovery codes in one transaction.
+func (n *NGDB) EnableUserTOTP(ctx context.Context, id int, counter int64, codeHashes []string) error {
+	return n.conn(ctx).BeginFunc(ctx, func(tx pgx.Tx) error {
+		res, err := tx.Exec(ctx, UserTOTPEnable, counter, id)
+		if err != nil {
+			return err
+		}
+		if err := checkRowsAffectedNG(res, "update", models.UserType); err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(ctx, tx, id, codeHashes)
+	})
+}
+
+// UseUserTOTPCounter accepts the TOTP time step only if it is newer than the last used one.
+func (n *NGDB) UseUserTOTPCounter(ctx context.Context, id int, counter int64) (bool, error) {
+	res, err := n.conn(ctx).Exec(ctx, UserTOTPUseCounter, counter, id)
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() == 1, nil
+}
+
+func (n *NGDB) ResetUserTOTP(ctx context.Context, id int) error {
+	return n.conn(ctx).BeginFunc(ctx, func(tx pgx.Tx) error {
+		res, err := tx.Exec(ctx, UserTOTPReset, id)
+		if err != nil {
+			return err
+		}
+		if err := checkRowsAffectedNG(res, "update", models.UserType); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, RecoveryCodesDelete, id)
+		return err
+	})
+}
+
+func (n *NGDB) ReplaceRecoveryCodes(ctx context.Context, id int, codeHashes []string) error {
+	return n.conn(ctx).BeginFunc(ctx, func(tx pgx.Tx) error {
+		return replaceRecoveryCodes(ctx, tx, id, codeHashes)
+	})
+}
+
+func (n *NGDB) UseRecoveryCode(ctx context.Context, id int, codeHash string) (bool, error) {
+	res, err := n.conn(ctx).Exec(ctx, RecoveryCodeUse, id, codeHash)
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() == 1, nil
+}
+
+func (n *NGDB) CountRecoveryCodes(ctx context.Context, id int) (count int, err error) {
+	err = n.conn(ctx).QueryRow(ctx, RecoveryCodesCount, id).Scan(&count)
+	return
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, id int, codeHashes []string) error {
+	if _, err := tx.Exec(ctx, RecoveryCodesDelete, id); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.Exec(ctx, RecoveryCodeInsert, id, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
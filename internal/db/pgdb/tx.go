@@ -0,0 +1,46 @@
+package pgdb
+
+import (
+	"context"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// querier is a pool or a transaction, nested BeginFunc of a transaction makes a savepoint.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+	BeginFunc(ctx context.Context, f func(pgx.Tx) error) error
+}
+
+type txKey struct{}
+
+// conn returns the transaction started by InTx for the context or the pool.
+func conn(ctx context.Context, pool *pgxpool.Pool) querier {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return pool
+}
+
+func (n *NGDB) conn(ctx context.Context) querier {
+	return conn(ctx, n.pool)
+}
+
+func (db *DB[T]) conn(ctx context.Context) querier {
+	return conn(ctx, db.pool)
+}
+
+// InTx runs fn in one transaction, both storages use it for queries with the context passed to fn.
+// The transaction is rolled back if fn returns an error, nested calls join the outer transaction.
+func (n *NGDB) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return fn(ctx)
+	}
+	return n.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+}
@@ -0,0 +1,41 @@
+package pgdb
+
+import (
+	"context"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const (
+	LinkSetUTM      = `UPDATE links SET utm = $1 WHERE id = $2;`
+	ShortLinkSetUTM = `UPDATE shortlinks SET utm = $1 WHERE id = $2 AND long_link_id = $3;`
+)
+
+// SetLinkUTM stores campaign parameters of the link, empty parameters are removed.
+func (n *NGDB) SetLinkUTM(ctx context.Context, linkID int, utm *models.UTM) error {
+	res, err := n.conn(ctx).Exec(ctx, LinkSetUTM, utmValue(utm), linkID)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffectedNG(res, "set utm", models.LinkType)
+}
+
+// SetShortLinkUTM stores campaign parameters of the token of the link, empty parameters are removed.
+func (n *NGDB) SetShortLinkUTM(ctx context.Context, linkID, id int, utm *models.UTM) error {
+	res, err := n.conn(ctx).Exec(ctx, ShortLinkSetUTM, utmValue(utm), id, linkID)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// utmValue returns nil for empty parameters, so they are stored as NULL.
+func utmValue(utm *models.UTM) interface{} {
+	if utm.IsZero() {
+		return nil
+	}
+	return utm
+}
@@ -0,0 +1,46 @@
+package pgdb
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const (
+	LinkVariantsDelete = `DELETE FROM link_variants WHERE link_id = $1 AND NOT (name = ANY($2));`
+	LinkVariantUpsert  = `
+INSERT INTO link_variants(link_id, name, destination, weight)
+VALUES
+    ($1, $2, $3, $4)
+ON CONFLICT (link_id, name) DO UPDATE SET (destination, weight) = (EXCLUDED.destination, EXCLUDED.weight);`
+	LinkVariantCountClick = `UPDATE link_variants SET click_counter = click_counter + 1 WHERE id = $1;`
+)
+
+// SetLinkVariants replaces variants of the link, variants with the same names keep their click counters.
+func (n *NGDB) SetLinkVariants(ctx context.Context, linkID int, variants []models.Variant) error {
+	names := make([]string, 0, len(variants))
+	for _, variant := range variants {
+		names = append(names, variant.Name)
+	}
+	return n.conn(ctx).BeginFunc(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, LinkVariantsDelete, linkID, names); err != nil {
+			return err
+		}
+		for _, variant := range variants {
+			if _, err := tx.Exec(ctx, LinkVariantUpsert, linkID, variant.Name, variant.Destination, variant.Weight); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (n *NGDB) CountLinkVariantClick(ctx context.Context, id int) error {
+	res, err := n.conn(ctx).Exec(ctx, LinkVariantCountClick, id)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffectedNG(res, "count click", "variant")
+}
@@ -0,0 +1,232 @@
+package pgdb
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const (
+	WebhookDeliveriesDefaultLimit = 50
+	WebhookDeliveriesMaxLimit     = 500
+
+	WebhookColumns = `id, owner_id, COALESCE(workspace_id, 0), url, secret, events, disabled, created_at`
+	WebhookCreate  = `
+INSERT INTO webhooks(owner_id, workspace_id, url, secret, events, disabled)
+VALUES
+    ($1, NULLIF($2, 0), $3, $4, $5, $6)
+RETURNING id, created_at;
+`
+	WebhookSelectByID        = `SELECT ` + WebhookColumns + ` FROM webhooks WHERE id = $1;`
+	WebhookSelectByOwner     = `SELECT ` + WebhookColumns + ` FROM webhooks WHERE owner_id = $1 AND workspace_id IS NULL ORDER BY id;`
+	WebhookSelectByWorkspace = `SELECT ` + WebhookColumns + ` FROM webhooks WHERE workspace_id = $1 ORDER BY id;`
+	// An empty secret keeps the current one
+	WebhookUpdate = `
+UPDATE webhooks SET (url, events, disabled, secret) = ($1, $2, $3, COALESCE(NULLIF($4, ''), secret)) WHERE id = $5;`
+	WebhookDeleteByID = `DELETE FROM webhooks WHERE id = $1;`
+
+	// Events of a link go to webhooks of its workspace and personal webhooks of its owner
+	WebhookDeliveriesEnqueue = `
+INSERT INTO webhook_deliveries(webhook_id, event, payload)
+SELECT id, $1::text, $2::text FROM webhooks
+WHERE NOT disabled AND $1::text = ANY(events) AND (workspace_id = $3 OR (workspace_id IS NULL AND owner_id = $4));`
+	WebhookDeliveryCreate = `
+INSERT INTO webhook_deliveries(webhook_id, event, payload, status, attempts, status_code, error, last_attempt_at)
+VALUES
+    ($1, $2, $3, $4, $5, $6, $7, now())
+RETURNING id, created_at, last_attempt_at;
+`
+	// Claimed deliveries are leased: if the process stops before storing the result, they are sent again
+	WebhookDeliveriesClaim = `
+UPDATE webhook_deliveries SET next_attempt_at = now() + make_interval(secs => $2)
+FROM webhooks
+WHERE webhooks.id = webhook_deliveries.webhook_id AND webhook_deliveries.id IN (
+    SELECT id FROM webhook_deliveries WHERE status = 'pending' AND next_attempt_at <= now()
+    ORDER BY next_attempt_at LIMIT $1 FOR UPDATE SKIP LOCKED)
+RETURNING webhook_deliveries.id, webhook_deliveries.webhook_id, webhook_deliveries.event, webhook_deliveries.payload,
+    webhook_deliveries.attempts, webhook_deliveries.created_at, webhooks.url, webhooks.secret;`
+	WebhookDeliveryUpdate = `
+UPDATE webhook_deliveries SET (status, attempts, status_code, error, next_attempt_at, last_attempt_at) =
+    ($1, $2, $3, $4, $5, now())
+WHERE id = $6;`
+	WebhookDeliveriesSelect = `
+SELECT id, webhook_id, event, payload, status, attempts, status_code, error, created_at, next_attempt_at, last_attempt_at
+FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY id DESC LIMIT $2 OFFSET $3;`
+	WebhookDeliveriesPurge = `DELETE FROM webhook_deliveries WHERE status <> 'pending' AND created_at < $1;`
+)
+
+func (n *NGDB) CreateWebhook(ctx context.Context, webhook *models.Webhook) (id int, err error) {
+	err = n.conn(ctx).QueryRow(ctx, WebhookCreate, webhook.OwnerID, webhook.WorkspaceID, webhook.URL, webhook.Secret,
+		webhook.Events, webhook.Disabled).Scan(&id, &webhook.CreatedAt)
+	return
+}
+
+func (n *NGDB) ReadWebhook(ctx context.Context, id int) (*models.Webhook, error) {
+	rows, err := n.conn(ctx).Query(ctx, WebhookSelectByID, id)
+	if err != nil {
+		return nil, err
+	}
+	webhooks, err := getWebhooksFromRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(webhooks) == 0 {
+		return nil, ErrNotFound
+	}
+	return webhooks[0], nil
+}
+
+// SearchWebhooks returns webhooks of the workspace or, for zero workspaceID, personal webhooks of the owner.
+func (n *NGDB) SearchWebhooks(ctx context.Context, ownerID, workspaceID int) ([]*models.Webhook, error) {
+	query, arg := WebhookSelectByOwner, ownerID
+	if workspaceID != 0 {
+		query, arg = WebhookSelectByWorkspace, workspaceID
+	}
+	rows, err := n.conn(ctx).Query(ctx, query, arg)
+	if err != nil {
+		return nil, err
+	}
+	return getWebhooksFromRows(rows)
+}
+
+func (n *NGDB) UpdateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	res, err := n.conn(ctx).Exec(ctx, WebhookUpdate, webhook.URL, webhook.Events, webhook.Disabled, webhook.Secret, webhook.ID)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffectedNG(res, "update", models.WebhookType)
+}
+
+func (n *NGDB) DeleteWebhook(ctx context.Context, id int) error {
+	res, err := n.conn(ctx).Exec(ctx, WebhookDeleteByID, id)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffectedNG(res, "delete", models.WebhookType)
+}
+
+// EnqueueWebhookDeliveries creates pending deliveries of the event for all subscribed webhooks
+// and returns their number.
+func (n *NGDB) EnqueueWebhookDeliveries(ctx context.Context, event, payload string, workspaceID, ownerID int) (int64, error) {
+	res, err := n.conn(ctx).Exec(ctx, WebhookDeliveriesEnqueue, event, payload, workspaceID, ownerID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+// CreateWebhookDelivery stores an already attempted delivery.
+func (n *NGDB) CreateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	return n.conn(ctx).QueryRow(ctx, WebhookDeliveryCreate, delivery.WebhookID, delivery.Event, string(delivery.Payload),
+		delivery.Status, delivery.Attempts, delivery.StatusCode, delivery.Error).
+		Scan(&delivery.ID, &delivery.CreatedAt, &delivery.LastAttemptAt)
+}
+
+// ClaimWebhookDeliveries returns up to limit due pending deliveries with URLs and secrets of their webhooks
+// and postpones them by lease.
+func (n *NGDB) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error) {
+	rows, err := n.conn(ctx).Query(ctx, WebhookDeliveriesClaim, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]*models.WebhookDelivery, 0)
+	for rows.Next() {
+		var (
+			delivery = models.WebhookDelivery{Status: models.DeliveryPending}
+			payload  string
+		)
+		if err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Event, &payload, &delivery.Attempts,
+			&delivery.CreatedAt, &delivery.URL, &delivery.Secret); err != nil {
+			return nil, err
+		}
+		delivery.Payload = []byte(payload)
+		deliveries = append(deliveries, &delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// SetWebhookDeliveryResult stores the result of an attempt, pending deliveries are retried at NextAttemptAt.
+func (n *NGDB) SetWebhookDeliveryResult(ctx context.Context, delivery *models.WebhookDelivery) error {
+	nextAttemptAt := time.Now()
+	if delivery.NextAttemptAt != nil {
+		nextAttemptAt = *delivery.NextAttemptAt
+	}
+	res, err := n.conn(ctx).Exec(ctx, WebhookDeliveryUpdate, delivery.Status, delivery.Attempts, delivery.StatusCode,
+		delivery.Error, nextAttemptAt, delivery.ID)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffectedNG(res, "update delivery of", models.WebhookType)
+}
+
+// SearchWebhookDeliveries returns deliveries of the webhook, newest first.
+func (n *NGDB) SearchWebhookDeliveries(ctx context.Context, webhookID, limit, offset int) ([]*models.WebhookDelivery, error) {
+	if limit <= 0 {
+		limit = WebhookDeliveriesDefaultLimit
+	}
+	if limit > WebhookDeliveriesMaxLimit {
+		limit = WebhookDeliveriesMaxLimit
+	}
+	rows, err := n.conn(ctx).Query(ctx, WebhookDeliveriesSelect, webhookID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]*models.WebhookDelivery, 0)
+	for rows.Next() {
+		var (
+			delivery      models.WebhookDelivery
+			payload       string
+			nextAttemptAt time.Time
+		)
+		if err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Event, &payload, &delivery.Status,
+			&delivery.Attempts, &delivery.StatusCode, &delivery.Error, &delivery.CreatedAt, &nextAttemptAt,
+			&delivery.LastAttemptAt); err != nil {
+			return nil, err
+		}
+		delivery.Payload = []byte(payload)
+		if delivery.Status == models.DeliveryPending {
+			delivery.NextAttemptAt = &nextAttemptAt
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// PurgeWebhookDeliveries deletes finished deliveries created before the given time.
+func (n *NGDB) PurgeWebhookDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	res, err := n.conn(ctx).Exec(ctx, WebhookDeliveriesPurge, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+func getWebhooksFromRows(rows pgx.Rows) ([]*models.Webhook, error) {
+	defer rows.Close()
+	webhooks := make([]*models.Webhook, 0)
+	for rows.Next() {
+		var webhook models.Webhook
+		if err := rows.Scan(&webhook.ID, &webhook.OwnerID, &webhook.WorkspaceID, &webhook.URL, &webhook.Secret,
+			&webhook.Events, &webhook.Disabled, &webhook.CreatedAt); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
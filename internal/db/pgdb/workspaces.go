@@ -0,0 +1,209 @@
+package pgdb
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+	"github.com/ptsypyshev/shortlink/internal/repositories/objrepo"
+)
+
+const (
+	WorkspaceCreate        = `INSERT INTO workspaces(name) VALUES ($1) RETURNING id;`
+	WorkspaceSelectColumns = `
+SELECT workspaces.id, workspaces.name, workspaces.personal_user_id IS NOT NULL, workspace_members.role,
+       (SELECT COUNT(*) FROM links WHERE links.workspace_id = workspaces.id AND links.deleted_at IS NULL)
+FROM workspaces JOIN workspace_members ON workspace_members.workspace_id = workspaces.id`
+	WorkspaceSelectByID = WorkspaceSelectColumns + `
+WHERE workspaces.id = $1 AND workspace_members.user_id = $2;`
+	WorkspaceSelectByUser = WorkspaceSelectColumns + `
+WHERE workspace_members.user_id = $1 ORDER BY workspaces.personal_user_id IS NULL, workspaces.name;`
+	WorkspaceSelectPersonal = `SELECT id FROM workspaces WHERE personal_user_id = $1;`
+	WorkspaceUpdate         = `UPDATE workspaces SET name = $1 WHERE id = $2;`
+	// Personal workspaces and workspaces with links (including the trash) are not deleted
+	WorkspaceDeleteByID = `
+DELETE FROM workspaces WHERE id = $1 AND personal_user_id IS NULL
+    AND NOT EXISTS (SELECT 1 FROM links WHERE workspace_id = $1);`
+
+	WorkspaceMemberRole    = `SELECT role FROM workspace_members WHERE workspace_id = $1 AND user_id = $2;`
+	WorkspaceMembersSelect = `
+SELECT workspace_members.workspace_id, workspace_members.user_id, users.username, workspace_members.role
+FROM workspace_members JOIN users ON users.id = workspace_members.user_id
+WHERE workspace_members.workspace_id = $1 AND users.deleted_at IS NULL ORDER BY users.username;`
+	// Members of personal workspaces are not changed
+	WorkspaceMemberUpsert = `
+INSERT INTO workspace_members(workspace_id, user_id, role)
+SELECT id, $2, $3 FROM workspaces WHERE id = $1 AND personal_user_id IS NULL
+ON CONFLICT (workspace_id, user_id) DO UPDATE SET role = EXCLUDED.role;`
+	WorkspaceMemberDelete = `
+DELETE FROM workspace_members USING workspaces
+WHERE workspace_members.workspace_id = workspaces.id AND workspaces.personal_user_id IS NULL
+  AND workspace_id = $1 AND user_id = $2;`
+	WorkspaceOwnersCount = `SELECT COUNT(*) FROM workspace_members WHERE workspace_id = $1 AND role = 'owner';`
+)
+
+// CreateWorkspace creates a shared workspace with the user ownerID as its owner.
+func (n *NGDB) CreateWorkspace(ctx context.Context, workspace *models.Workspace, ownerID int) (id int, err error) {
+	err = n.conn(ctx).BeginFunc(ctx, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx, WorkspaceCreate, workspace.Name).Scan(&id); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, WorkspaceMemberUpsert, id, ownerID, models.WorkspaceOwner)
+		return err
+	})
+	return
+}
+
+// ReadWorkspace returns the workspace with the role of the user, ErrNotFound if the user is not a member.
+func (n *NGDB) ReadWorkspace(ctx context.Context, id, userID int) (*models.Workspace, error) {
+	rows, err := n.conn(ctx).Query(ctx, WorkspaceSelectByID, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	workspaces, err := getWorkspacesFromRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(workspaces) == 0 {
+		return nil, ErrNotFound
+	}
+	return workspaces[0], nil
+}
+
+// SearchWorkspaces returns workspaces of the user, the personal workspace goes first.
+func (n *NGDB) SearchWorkspaces(ctx context.Context, userID int) ([]*models.Workspace, error) {
+	rows, err := n.conn(ctx).Query(ctx, WorkspaceSelectByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	return getWorkspacesFromRows(rows)
+}
+
+func (n *NGDB) PersonalWorkspace(ctx context.Context, userID int) (id int, err error) {
+	err = n.conn(ctx).QueryRow(ctx, WorkspaceSelectPersonal, userID).Scan(&id)
+	if err == pgx.ErrNoRows {
+		err = ErrNotFound
+	}
+	return
+}
+
+func (n *NGDB) UpdateWorkspace(ctx context.Context, workspace *models.Workspace) error {
+	res, err := n.conn(ctx).Exec(ctx, WorkspaceUpdate, workspace.Name, workspace.ID)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffectedNG(res, "update", models.WorkspaceType)
+}
+
+func (n *NGDB) DeleteWorkspace(ctx context.Context, id int) error {
+	res, err := n.conn(ctx).Exec(ctx, WorkspaceDeleteByID, id)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() != 1 {
+		return objrepo.ErrWorkspaceInUse
+	}
+	return nil
+}
+
+// WorkspaceRole returns the role of the user in the workspace, empty if the user is not a member.
+func (n *NGDB) WorkspaceRole(ctx context.Context, id, userID int) (role string, err error) {
+	err = n.conn(ctx).QueryRow(ctx, WorkspaceMemberRole, id, userID).Scan(&role)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	return
+}
+
+func (n *NGDB) WorkspaceMembers(ctx context.Context, id int) ([]*models.WorkspaceMember, error) {
+	rows, err := n.conn(ctx).Query(ctx, WorkspaceMembersSelect, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := make([]*models.WorkspaceMember, 0)
+	for rows.Next() {
+		var member models.WorkspaceMember
+		if err := rows.Scan(&member.WorkspaceID, &member.UserID, &member.Username, &member.Role); err != nil {
+			return nil, err
+		}
+		members = append(members, &member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// SetWorkspaceMember adds the member or changes the role, the workspace must keep at least one owner.
+func (n *NGDB) SetWorkspaceMember(ctx context.Context, member *models.WorkspaceMember) error {
+	return n.conn(ctx).BeginFunc(ctx, func(tx pgx.Tx) error {
+		res, err := tx.Exec(ctx, WorkspaceMemberUpsert, member.WorkspaceID, member.UserID, member.Role)
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() != 1 {
+			return objrepo.ErrPersonalWorkspace
+		}
+		return checkWorkspaceOwners(ctx, tx, member.WorkspaceID)
+	})
+}
+
+// DeleteWorkspaceMember removes the member, the workspace must keep at least one owner.
+func (n *NGDB) DeleteWorkspaceMember(ctx context.Context, id, userID int) error {
+	return n.conn(ctx).BeginFunc(ctx, func(tx pgx.Tx) error {
+		res, err := tx.Exec(ctx, WorkspaceMemberDelete, id, userID)
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() != 1 {
+			return ErrNotFound
+		}
+		return checkWorkspaceOwners(ctx, tx, id)
+	})
+}
+
+func checkWorkspaceOwners(ctx context.Context, tx pgx.Tx, id int) error {
+	var owners int
+	if err := tx.QueryRow(ctx, WorkspaceOwnersCount, id).Scan(&owners); err != nil {
+		return err
+	}
+	if owners == 0 {
+		return objrepo.ErrLastOwner
+	}
+	return nil
+}
+
+func getWorkspacesFromRows(rows pgx.Rows) ([]*models.Workspace, error) {
+	defer rows.Close()
+
+	sliceWorkspaces := make([]*models.Workspace, 0)
+	for rows.Next() {
+		var (
+			id, linkCount int
+			name, role    string
+			personal      bool
+			workspace     models.Workspace
+		)
+		if err := rows.Scan(&id, &name, &personal, &role, &linkCount); err != nil {
+			return nil, err
+		}
+		mWorkspaceFields := map[string]interface{}{
+			"id":         id,
+			"name":       name,
+			"personal":   personal,
+			"role":       role,
+			"link_count": linkCount,
+		}
+		if err := workspace.Set(mWorkspaceFields); err != nil {
+			return nil, err
+		}
+		sliceWorkspaces = append(sliceWorkspaces, &workspace)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sliceWorkspaces, nil
+}
@@ -0,0 +1,191 @@
+// Package health periodically probes destinations of active links in background,
+// records the status code and latency of the last check and marks links broken after consecutive failures.
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const (
+	DefaultInterval     = time.Hour
+	DefaultTimeout      = 10 * time.Second
+	DefaultWorkers      = 4
+	DefaultBatch        = 500
+	DefaultHostInterval = time.Second
+	DefaultFailures     = 3
+)
+
+type Store interface {
+	HealthCheckLinks(ctx context.Context, limit int) ([]*models.Link, error)
+	SetHealth(ctx context.Context, linkID int, destination string, health *models.LinkHealth) error
+}
+
+type Options struct {
+	// A batch of links checked longest ago is probed every Interval
+	Interval time.Duration
+	Batch    int
+	// Workers bounds concurrent probes, requests to one host are sent at most once per HostInterval
+	Workers      int
+	HostInterval time.Duration
+	Timeout      time.Duration
+	// A link is broken after Failures consecutive failed checks
+	Failures int
+}
+
+type Checker struct {
+	prober Prober
+	store  Store
+	logger *zap.Logger
+	opts   Options
+}
+
+func CheckerNew(p Prober, s Store, l *zap.Logger, opts Options) *Checker {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	if opts.Failures < 1 {
+		opts.Failures = 1
+	}
+	return &Checker{prober: p, store: s, logger: l, opts: opts}
+}
+
+// Start checks a batch of links every Interval until ctx is done.
+func (c *Checker) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(c.opts.Interval)
+		defer ticker.Stop()
+		for {
+			if err := c.CheckBatch(ctx); err != nil {
+				c.logger.Error(fmt.Sprintf(`cannot check health of links: %s`, err))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// CheckBatch probes one batch of links and stores the results.
+func (c *Checker) CheckBatch(ctx context.Context) error {
+	links, err := c.store.HealthCheckLinks(ctx, c.opts.Batch)
+	if err != nil {
+		return err
+	}
+	limiter := newHostLimiter(c.opts.HostInterval)
+	jobs := make(chan *models.Link)
+	var wg sync.WaitGroup
+	for i := 0; i < c.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for link := range jobs {
+				c.check(ctx, limiter, link)
+			}
+		}()
+	}
+loop:
+	for _, link := range links {
+		select {
+		case <-ctx.Done():
+			break loop
+		case jobs <- link:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return nil
+}
+
+func (c *Checker) check(ctx context.Context, limiter *hostLimiter, link *models.Link) {
+	if err := limiter.Wait(ctx, hostOf(link.LongLink)); err != nil {
+		return
+	}
+	probeCtx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+	result := c.prober.Probe(probeCtx, link.LongLink)
+	cancel()
+	if ctx.Err() != nil {
+		// Probes interrupted by shutdown say nothing about the destination
+		return
+	}
+	health := Next(link.Health, result, c.opts.Failures, time.Now())
+	if health.Broken && (link.Health == nil || !link.Health.Broken) {
+		c.logger.Info(fmt.Sprintf(`destination of link %d is broken: %s`, link.ID, link.LongLink))
+	}
+	_ = c.store.SetHealth(ctx, link.ID, link.LongLink, health)
+}
+
+// Next returns the health of the link after the probe result, prev is the health after the previous check.
+func Next(prev *models.LinkHealth, result Result, failures int, now time.Time) *models.LinkHealth {
+	health := &models.LinkHealth{
+		StatusCode: result.StatusCode,
+		LatencyMs:  result.Latency.Milliseconds(),
+		CheckedAt:  now,
+	}
+	if !result.OK() {
+		health.Failures = 1
+		if prev != nil {
+			health.Failures = prev.Failures + 1
+		}
+		health.Error = fmt.Sprintf("status %d", result.StatusCode)
+		if result.Err != nil {
+			health.Error = result.Err.Error()
+		}
+	}
+	health.Broken = health.Failures >= failures
+	return health
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// hostLimiter spaces requests to the same host by interval.
+type hostLimiter struct {
+	interval time.Duration
+	mu       sync.Mutex
+	next     map[string]time.Time
+}
+
+func newHostLimiter(interval time.Duration) *hostLimiter {
+	return &hostLimiter{interval: interval, next: make(map[string]time.Time)}
+}
+
+// Wait blocks until a request to the host is allowed or ctx is done.
+func (l *hostLimiter) Wait(ctx context.Context, host string) error {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	l.next[host] = at.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := at.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
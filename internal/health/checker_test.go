@@ -0,0 +1,129 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+func TestNext(t *testing.T) {
+	now := time.Now()
+	failed := Result{StatusCode: http.StatusBadGateway, Latency: 20 * time.Millisecond}
+	var health *models.LinkHealth
+	for i := 1; i <= 3; i++ {
+		health = Next(health, failed, 3, now)
+		if health.Failures != i || health.Broken != (i == 3) || health.Error != "status 502" || health.LatencyMs != 20 {
+			t.Fatalf("after %d failures: %+v", i, health)
+		}
+	}
+
+	health = Next(health, Result{Err: errors.New("connection refused")}, 3, now)
+	if health.Failures != 4 || !health.Broken || health.Error != "connection refused" {
+		t.Errorf("after an error: %+v", health)
+	}
+
+	// One successful check repairs the link
+	health = Next(health, Result{StatusCode: http.StatusOK}, 3, now)
+	if health.Failures != 0 || health.Broken || health.Error != "" || !health.CheckedAt.Equal(now) {
+		t.Errorf("after a success: %+v", health)
+	}
+}
+
+// healthStore serves the links and keeps the stored health of each of them.
+type healthStore struct {
+	mu    sync.Mutex
+	links []*models.Link
+}
+
+func (s *healthStore) HealthCheckLinks(context.Context, int) ([]*models.Link, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	links := make([]*models.Link, 0, len(s.links))
+	for _, link := range s.links {
+		copied := *link
+		links = append(links, &copied)
+	}
+	return links, nil
+}
+
+func (s *healthStore) SetHealth(_ context.Context, linkID int, destination string, health *models.LinkHealth) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, link := range s.links {
+		if link.ID == linkID && link.LongLink == destination {
+			link.Health = health
+		}
+	}
+	return nil
+}
+
+func TestCheckBatchMarksBroken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ok" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	store := &healthStore{links: []*models.Link{
+		{ID: 1, LongLink: srv.URL + "/ok"},
+		{ID: 2, LongLink: srv.URL + "/fails"},
+	}}
+	checker := CheckerNew(&HTTPProber{Client: srv.Client()}, store, zap.NewNop(), Options{
+		Workers:  2,
+		Timeout:  time.Second,
+		Failures: 2,
+	})
+	for i := 1; i <= 2; i++ {
+		if err := checker.CheckBatch(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		ok, fails := store.links[0].Health, store.links[1].Health
+		if ok == nil || ok.Broken || ok.StatusCode != http.StatusOK {
+			t.Errorf("check %d: healthy link %+v", i, ok)
+		}
+		if fails == nil || fails.Failures != i || fails.Broken != (i == 2) || fails.StatusCode != http.StatusInternalServerError {
+			t.Errorf("check %d: failing link %+v", i, fails)
+		}
+	}
+}
+
+func TestCheckBatchSpacesHostRequests(t *testing.T) {
+	var mu sync.Mutex
+	var times []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	store := &healthStore{links: []*models.Link{
+		{ID: 1, LongLink: srv.URL + "/a"},
+		{ID: 2, LongLink: srv.URL + "/b"},
+		{ID: 3, LongLink: srv.URL + "/c"},
+	}}
+	interval := 50 * time.Millisecond
+	checker := CheckerNew(&HTTPProber{Client: srv.Client()}, store, zap.NewNop(), Options{
+		Workers:      3,
+		HostInterval: interval,
+		Timeout:      time.Second,
+	})
+	if err := checker.CheckBatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(times) != 3 {
+		t.Fatalf("%d requests, want 3", len(times))
+	}
+	if spent := times[2].Sub(times[0]); spent < 2*interval-10*time.Millisecond {
+		t.Errorf("3 requests to one host within %s, want at least %s", spent, 2*interval)
+	}
+}
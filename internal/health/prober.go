@@ -0,0 +1,71 @@
+package health
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ptsypyshev/shortlink/internal/netguard"
+)
+
+const (
+	UserAgent        = "ShortlinkBot/1.0 (+health)"
+	DefaultRedirects = 5
+	// Some servers answer GET requests with a small body, it is read to let the connection be reused
+	maxDrainSize = 64 << 10
+)
+
+// Result is the outcome of probing a destination.
+type Result struct {
+	// StatusCode of the final response after redirects, zero if there was no response
+	StatusCode int
+	Latency    time.Duration
+	Err        error
+}
+
+// OK reports whether the destination responded with a non-error status.
+func (r Result) OK() bool {
+	return r.Err == nil && r.StatusCode > 0 && r.StatusCode < http.StatusBadRequest
+}
+
+// Prober sends one request to a destination and reports its status and latency,
+// errors are returned in the Result so that every probe counts as a check of the link.
+type Prober interface {
+	Probe(ctx context.Context, rawURL string) Result
+}
+
+type HTTPProber struct {
+	Client *http.Client
+}
+
+// NewHTTPProber returns a prober which refuses private network destinations.
+func NewHTTPProber(timeout time.Duration) *HTTPProber {
+	return &HTTPProber{Client: netguard.NewClient(timeout, DefaultRedirects)}
+}
+
+// Probe sends a HEAD request and repeats it with GET if the server does not support HEAD.
+func (p *HTTPProber) Probe(ctx context.Context, rawURL string) Result {
+	start := time.Now()
+	status, err := p.do(ctx, http.MethodHead, rawURL)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		start = time.Now()
+		status, err = p.do(ctx, http.MethodGet, rawURL)
+	}
+	return Result{StatusCode: status, Latency: time.Since(start), Err: err}
+}
+
+func (p *HTTPProber) do(ctx context.Context, method, rawURL string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainSize))
+	return resp.StatusCode, nil
+}
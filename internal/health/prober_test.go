@@ -0,0 +1,78 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ptsypyshev/shortlink/internal/netguard"
+)
+
+func TestProbe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			if r.Method != http.MethodHead {
+				t.Errorf("%s /ok, want HEAD", r.Method)
+			}
+		case "/no-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		case "/moved":
+			http.Redirect(w, r, "/gone", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	prober := &HTTPProber{Client: srv.Client()}
+	tests := []struct {
+		path   string
+		status int
+		ok     bool
+	}{
+		{"/ok", http.StatusOK, true},
+		{"/no-head", http.StatusOK, true},
+		{"/moved", http.StatusNotFound, false},
+	}
+	for _, tt := range tests {
+		result := prober.Probe(context.Background(), srv.URL+tt.path)
+		if result.StatusCode != tt.status || result.OK() != tt.ok || result.Err != nil {
+			t.Errorf("Probe(%s) = %+v, want status %d", tt.path, result, tt.status)
+		}
+	}
+}
+
+func TestProbeTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	result := (&HTTPProber{Client: srv.Client()}).Probe(ctx, srv.URL)
+	if result.OK() || !errors.Is(result.Err, context.DeadlineExceeded) {
+		t.Errorf("Probe() = %+v, want %v", result, context.DeadlineExceeded)
+	}
+}
+
+func TestProbeDeniesPrivateNetworks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("request to %s reached the loopback server", r.URL)
+	}))
+	defer srv.Close()
+
+	result := NewHTTPProber(time.Second).Probe(context.Background(), srv.URL)
+	if result.OK() || !errors.Is(result.Err, netguard.ErrDeniedAddress) {
+		t.Errorf("Probe() = %+v, want %v", result, netguard.ErrDeniedAddress)
+	}
+}
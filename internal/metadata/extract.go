@@ -0,0 +1,130 @@
+package metadata
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const (
+	maxTitleLength       = 300
+	maxDescriptionLength = 1000
+	maxURLLength         = 2000
+)
+
+// Extract parses the head of an HTML document and returns its title, description, Open Graph image and favicon.
+// Relative URLs are resolved against pageURL.
+func Extract(body []byte, pageURL *url.URL) *models.LinkMetadata {
+	var (
+		meta                 models.LinkMetadata
+		ogTitle, ogDesc      string
+		inTitle, titleParsed bool
+		title                strings.Builder
+	)
+	base := pageURL
+
+	z := html.NewTokenizer(bytes.NewReader(body))
+loop:
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			break loop
+		case html.TextToken:
+			if inTitle {
+				title.Write(z.Text())
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle, titleParsed = false, true
+			case "head":
+				break loop
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			attrs := map[string]string{}
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				attrs[string(key)] = string(val)
+			}
+			switch string(name) {
+			case "body":
+				break loop
+			case "title":
+				inTitle = !titleParsed && tt == html.StartTagToken
+			case "base":
+				if href, err := base.Parse(attrs["href"]); err == nil && attrs["href"] != "" {
+					base = href
+				}
+			case "meta":
+				content := attrs["content"]
+				switch strings.ToLower(attrs["name"] + attrs["property"]) {
+				case "description":
+					meta.Description = content
+				case "og:description":
+					ogDesc = content
+				case "og:title":
+					ogTitle = content
+				case "og:image", "og:image:url", "og:image:secure_url":
+					if meta.ImageURL == "" {
+						meta.ImageURL = resolve(base, content)
+					}
+				}
+			case "link":
+				for _, rel := range strings.Fields(strings.ToLower(attrs["rel"])) {
+					if (rel == "icon" || rel == "apple-touch-icon") && meta.FaviconURL == "" {
+						meta.FaviconURL = resolve(base, attrs["href"])
+					}
+				}
+			}
+		}
+	}
+
+	meta.Title = clean(title.String(), maxTitleLength)
+	if meta.Title == "" {
+		meta.Title = clean(ogTitle, maxTitleLength)
+	}
+	meta.Description = clean(meta.Description, maxDescriptionLength)
+	if meta.Description == "" {
+		meta.Description = clean(ogDesc, maxDescriptionLength)
+	}
+	if meta.FaviconURL == "" {
+		meta.FaviconURL = resolve(base, "/favicon.ico")
+	}
+	return &meta
+}
+
+func resolve(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	u, err := base.Parse(ref)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	s := u.String()
+	if len(s) > maxURLLength {
+		return ""
+	}
+	return s
+}
+
+func clean(s string, maxLength int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if !utf8.ValidString(s) {
+		s = strings.ToValidUTF8(s, "")
+	}
+	if runes := []rune(s); len(runes) > maxLength {
+		s = string(runes[:maxLength])
+	}
+	return s
+}
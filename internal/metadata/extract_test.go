@@ -0,0 +1,79 @@
+package metadata
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+func TestExtract(t *testing.T) {
+	pageURL, _ := url.Parse("https://example.com/blog/post")
+	tests := []struct {
+		name string
+		body string
+		want models.LinkMetadata
+	}{
+		{
+			name: "title and description",
+			body: `<html><head><title> Hello
+				World </title><meta name="description" content="About the world"></head></html>`,
+			want: models.LinkMetadata{
+				Title:       "Hello World",
+				Description: "About the world",
+				FaviconURL:  "https://example.com/favicon.ico",
+			},
+		},
+		{
+			name: "open graph",
+			body: `<head><meta property="og:title" content="OG title"><meta property="og:description" content="OG description">
+				<meta property="og:image" content="/img/cover.png"><link rel="shortcut icon" href="icons/fav.png"></head>`,
+			want: models.LinkMetadata{
+				Title:       "OG title",
+				Description: "OG description",
+				ImageURL:    "https://example.com/img/cover.png",
+				FaviconURL:  "https://example.com/blog/icons/fav.png",
+			},
+		},
+		{
+			name: "title wins over open graph",
+			body: `<head><title>Title</title><meta property="og:title" content="OG title"></head>`,
+			want: models.LinkMetadata{Title: "Title", FaviconURL: "https://example.com/favicon.ico"},
+		},
+		{
+			name: "base href",
+			body: `<head><base href="https://cdn.example.com/assets/"><link rel="icon" href="fav.ico">
+				<meta property="og:image" content="cover.jpg"></head>`,
+			want: models.LinkMetadata{
+				ImageURL:   "https://cdn.example.com/assets/cover.jpg",
+				FaviconURL: "https://cdn.example.com/assets/fav.ico",
+			},
+		},
+		{
+			name: "only head is parsed",
+			body: `<head></head><body><title>Body title</title></body>`,
+			want: models.LinkMetadata{FaviconURL: "https://example.com/favicon.ico"},
+		},
+		{
+			name: "non-http image",
+			body: `<head><meta property="og:image" content="javascript:alert(1)"></head>`,
+			want: models.LinkMetadata{FaviconURL: "https://example.com/favicon.ico"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Extract([]byte(tt.body), pageURL); *got != tt.want {
+				t.Errorf("Extract() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractTruncatesTitle(t *testing.T) {
+	pageURL, _ := url.Parse("https://example.com/")
+	body := "<title>" + strings.Repeat("я", maxTitleLength+10) + "</title>"
+	if got := Extract([]byte(body), pageURL).Title; got != strings.Repeat("я", maxTitleLength) {
+		t.Errorf("title of %d runes, want %d", len([]rune(got)), maxTitleLength)
+	}
+}
@@ -0,0 +1,215 @@
+package metadata
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ptsypyshev/shortlink/internal/netguard"
+)
+
+const (
+	UserAgent        = "ShortlinkBot/1.0 (+metadata)"
+	DefaultTimeout   = 5 * time.Second
+	DefaultMaxSize   = 1 << 20 // 1 MiB
+	DefaultRedirects = 5
+	robotsMaxSize    = 64 << 10
+	robotsCacheTTL   = time.Hour
+)
+
+var (
+	ErrNotHTML          = errors.New("destination is not an HTML page")
+	ErrDisallowedRobots = errors.New("destination is disallowed by robots.txt")
+)
+
+// Page is the result of fetching a destination URL.
+type Page struct {
+	URL  *url.URL // final URL after redirects
+	Body []byte
+}
+
+// Fetcher downloads the HTML page of a link destination for Extract,
+// the page URL is the final one so relative links of the page resolve correctly.
+type Fetcher interface {
+	Fetch(ctx context.Context, rawURL string) (*Page, error)
+}
+
+type HTTPFetcher struct {
+	Client        *http.Client
+	MaxSize       int64
+	RespectRobots bool
+
+	mu     sync.Mutex
+	robots map[string]robotsEntry
+}
+
+type robotsEntry struct {
+	rules   []robotsRule
+	fetched time.Time
+}
+
+type robotsRule struct {
+	allow  bool
+	prefix string
+}
+
+// NewHTTPFetcher returns a fetcher which respects robots.txt and refuses private network destinations.
+func NewHTTPFetcher(timeout time.Duration, maxSize int64) *HTTPFetcher {
+	return &HTTPFetcher{
+		Client:        netguard.NewClient(timeout, DefaultRedirects),
+		MaxSize:       maxSize,
+		RespectRobots: true,
+		robots:        make(map[string]robotsEntry),
+	}
+}
+
+func (f *HTTPFetcher) Fetch(ctx context.Context, rawURL string) (*Page, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if f.RespectRobots && !f.allowedByRobots(ctx, u) {
+		return nil, ErrDisallowedRobots
+	}
+
+	resp, err := f.get(ctx, u.String(), "text/html,application/xhtml+xml")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, ErrNotHTML
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.maxSize()))
+	if err != nil {
+		return nil, err
+	}
+	return &Page{URL: resp.Request.URL, Body: body}, nil
+}
+
+func (f *HTTPFetcher) get(ctx context.Context, rawURL, accept string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("Accept", accept)
+	return f.Client.Do(req)
+}
+
+func (f *HTTPFetcher) maxSize() int64 {
+	if f.MaxSize <= 0 {
+		return DefaultMaxSize
+	}
+	return f.MaxSize
+}
+
+func (f *HTTPFetcher) allowedByRobots(ctx context.Context, u *url.URL) bool {
+	origin := u.Scheme + "://" + u.Host
+
+	f.mu.Lock()
+	if f.robots == nil {
+		f.robots = make(map[string]robotsEntry)
+	}
+	entry, ok := f.robots[origin]
+	f.mu.Unlock()
+
+	if !ok || time.Since(entry.fetched) > robotsCacheTTL {
+		entry = robotsEntry{rules: f.fetchRobots(ctx, origin), fetched: time.Now()}
+		f.mu.Lock()
+		f.robots[origin] = entry
+		f.mu.Unlock()
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	// The longest matching rule wins, Allow wins over Disallow of the same length
+	allowed, matched := true, -1
+	for _, rule := range entry.rules {
+		if !strings.HasPrefix(path, rule.prefix) {
+			continue
+		}
+		if len(rule.prefix) > matched || (len(rule.prefix) == matched && rule.allow) {
+			allowed, matched = rule.allow, len(rule.prefix)
+		}
+	}
+	return allowed
+}
+
+// fetchRobots returns the rules applicable to our user agent. A missing or broken robots.txt allows everything.
+func (f *HTTPFetcher) fetchRobots(ctx context.Context, origin string) []robotsRule {
+	resp, err := f.get(ctx, origin+"/robots.txt", "text/plain")
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	return parseRobots(io.LimitReader(resp.Body, robotsMaxSize), "shortlinkbot")
+}
+
+func parseRobots(r io.Reader, agent string) []robotsRule {
+	var (
+		specific, wildcard []robotsRule
+		groupAgents        []string
+		inRules            bool
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if inRules {
+				groupAgents, inRules = nil, false
+			}
+			groupAgents = append(groupAgents, strings.ToLower(value))
+		case "allow", "disallow":
+			inRules = true
+			if key == "disallow" && value == "" {
+				continue
+			}
+			rule := robotsRule{allow: key == "allow", prefix: strings.TrimSuffix(value, "*")}
+			for _, groupAgent := range groupAgents {
+				switch {
+				case groupAgent == "*":
+					wildcard = append(wildcard, rule)
+				case strings.Contains(agent, groupAgent):
+					specific = append(specific, rule)
+				}
+			}
+		}
+	}
+	if specific != nil {
+		return specific
+	}
+	return wildcard
+}
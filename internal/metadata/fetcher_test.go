@@ -0,0 +1,176 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+	"github.com/ptsypyshev/shortlink/internal/netguard"
+)
+
+// newTestFetcher returns a fetcher of the test server, netguard would refuse its loopback address.
+func newTestFetcher(srv *httptest.Server, maxSize int64) *HTTPFetcher {
+	return &HTTPFetcher{Client: srv.Client(), MaxSize: maxSize, RespectRobots: true}
+}
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/page", http.StatusMovedPermanently)
+		case "/page":
+			if r.Header.Get("User-Agent") != UserAgent {
+				http.Error(w, "unexpected user agent", http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte(`<title>Page</title>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	page, err := newTestFetcher(srv, 0).Fetch(context.Background(), srv.URL+"/old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.URL.Path != "/page" || string(page.Body) != `<title>Page</title>` {
+		t.Errorf("Fetch() = %s %q", page.URL, page.Body)
+	}
+}
+
+func TestFetchLimitsSize(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<title>Page</title>" + strings.Repeat("x", 1000)))
+	}))
+	defer srv.Close()
+
+	page, err := newTestFetcher(srv, 19).Fetch(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(page.Body) != "<title>Page</title>" {
+		t.Errorf("body = %q, want the first 19 bytes", page.Body)
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := newTestFetcher(srv, 0).Fetch(ctx, srv.URL); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("fetch took %s after the deadline", elapsed)
+	}
+}
+
+func TestFetchRejects(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			_, _ = w.Write([]byte("User-agent: *\nDisallow: /private\n\nUser-agent: ShortlinkBot\nDisallow: /hidden\n"))
+		case "/image.png":
+			w.Header().Set("Content-Type", "image/png")
+		case "/gone":
+			http.NotFound(w, r)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+		}
+	}))
+	defer srv.Close()
+
+	fetcher := newTestFetcher(srv, 0)
+	tests := []struct {
+		path string
+		want error
+	}{
+		{"/hidden/page", ErrDisallowedRobots},
+		{"/image.png", ErrNotHTML},
+	}
+	for _, tt := range tests {
+		if _, err := fetcher.Fetch(context.Background(), srv.URL+tt.path); !errors.Is(err, tt.want) {
+			t.Errorf("Fetch(%s) err = %v, want %v", tt.path, err, tt.want)
+		}
+	}
+	// Rules for all agents are ignored when there is a group for ours
+	if _, err := fetcher.Fetch(context.Background(), srv.URL+"/private"); err != nil {
+		t.Errorf("Fetch(/private) err = %v", err)
+	}
+	if _, err := fetcher.Fetch(context.Background(), srv.URL+"/gone"); err == nil {
+		t.Error("Fetch(/gone) accepts 404")
+	}
+	if _, err := fetcher.Fetch(context.Background(), "ftp://example.com/"); err == nil {
+		t.Error("Fetch() accepts ftp scheme")
+	}
+}
+
+func TestFetchDeniesPrivateNetworks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("request to %s reached the loopback server", r.URL)
+	}))
+	defer srv.Close()
+
+	fetcher := NewHTTPFetcher(time.Second, 0)
+	if _, err := fetcher.Fetch(context.Background(), srv.URL); !errors.Is(err, netguard.ErrDeniedAddress) {
+		t.Errorf("err = %v, want %v", err, netguard.ErrDeniedAddress)
+	}
+}
+
+type metadataStore struct {
+	mu   sync.Mutex
+	meta map[int]*models.LinkMetadata
+	done chan struct{}
+}
+
+func (s *metadataStore) SetMetadata(_ context.Context, linkID int, meta *models.LinkMetadata) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.meta[linkID] = meta
+	s.done <- struct{}{}
+	return nil
+}
+
+func TestWorker(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<head><title>Worker</title><link rel="icon" href="/i.png"></head>`))
+	}))
+	defer srv.Close()
+
+	store := &metadataStore{meta: make(map[int]*models.LinkMetadata), done: make(chan struct{}, 1)}
+	worker := WorkerNew(newTestFetcher(srv, 0), store, zap.NewNop(), time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	worker.Start(ctx, 1)
+	worker.Enqueue(5, srv.URL)
+	select {
+	case <-store.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("metadata is not stored")
+	}
+	cancel()
+	worker.Wait()
+
+	if meta := store.meta[5]; meta == nil || meta.Title != "Worker" || meta.FaviconURL != srv.URL+"/i.png" {
+		t.Errorf("stored metadata %+v", meta)
+	}
+}
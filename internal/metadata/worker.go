@@ -0,0 +1,96 @@
+// Package metadata fetches link destinations in background and extracts
+// the page title, description, Open Graph image and favicon for display and search.
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const (
+	DefaultWorkers   = 2
+	DefaultQueueSize = 100
+)
+
+type Store interface {
+	SetMetadata(ctx context.Context, linkID int, meta *models.LinkMetadata) error
+}
+
+type job struct {
+	linkID int
+	url    string
+}
+
+type Worker struct {
+	fetcher Fetcher
+	store   Store
+	logger  *zap.Logger
+	timeout time.Duration
+	queue   chan job
+	wg      sync.WaitGroup
+}
+
+func WorkerNew(f Fetcher, s Store, l *zap.Logger, timeout time.Duration) *Worker {
+	return &Worker{
+		fetcher: f,
+		store:   s,
+		logger:  l,
+		timeout: timeout,
+		queue:   make(chan job, DefaultQueueSize),
+	}
+}
+
+// Start runs n fetching goroutines until ctx is done.
+func (w *Worker) Start(ctx context.Context, n int) {
+	for i := 0; i < n; i++ {
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case j := <-w.queue:
+					w.process(ctx, j)
+				}
+			}
+		}()
+	}
+}
+
+func (w *Worker) Wait() {
+	w.wg.Wait()
+}
+
+// Enqueue schedules metadata extraction for the link. It never blocks: when the queue is full the job is dropped.
+func (w *Worker) Enqueue(linkID int, url string) {
+	if w == nil {
+		return
+	}
+	select {
+	case w.queue <- job{linkID: linkID, url: url}:
+	default:
+		w.logger.Warn(fmt.Sprintf(`metadata queue is full, skip link %d`, linkID))
+	}
+}
+
+func (w *Worker) process(ctx context.Context, j job) {
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	page, err := w.fetcher.Fetch(ctx, j.url)
+	if err != nil {
+		w.logger.Info(fmt.Sprintf(`cannot fetch metadata for link %d: %s`, j.linkID, err))
+		return
+	}
+	meta := Extract(page.Body, page.URL)
+	if err := w.store.SetMetadata(ctx, j.linkID, meta); err != nil {
+		w.logger.Error(fmt.Sprintf(`cannot save metadata for link %d: %s`, j.linkID, err))
+	}
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+const AuditEntryType = "audit"
+
+// AuditChange is the old and new value of a changed field.
+type AuditChange struct {
+	Old any `json:"old,omitempty"`
+	New any `json:"new,omitempty"`
+}
+
+// AuditEntry is an append-only record of a mutation or an authentication event.
+type AuditEntry struct {
+	ID         int64                  `json:"id"`
+	CreatedAt  time.Time              `json:"created_at"`
+	ActorID    int                    `json:"actor_id,omitempty"`
+	ActorName  string                 `json:"actor_name,omitempty"`
+	Action     string                 `json:"action"`
+	TargetType string                 `json:"target_type"`
+	TargetID   int                    `json:"target_id"`
+	Changes    map[string]AuditChange `json:"changes,omitempty"`
+	IP         string                 `json:"ip,omitempty"`
+}
+
+// AuditFilter selects audit entries, zero values match everything.
+type AuditFilter struct {
+	ActorID    int
+	Action     string
+	TargetType string
+	TargetID   int
+	From       time.Time
+	To         time.Time
+	Limit      int
+	Offset     int
+}
+
+func (e *AuditEntry) GetType() string {
+	return AuditEntryType
+}
+
+func (e *AuditEntry) String() string {
+	return fmt.Sprintf("{\nID: %d\nCreatedAt: %s\nActor: %d %s\nAction: %s\nTarget: %s %d\nIP: %s\n}",
+		e.ID, e.CreatedAt, e.ActorID, e.ActorName, e.Action, e.TargetType, e.TargetID, e.IP)
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+const CollectionType = "collection"
+
+type Collection struct {
+	ID           int     `json:"id,omitempty" mapstructure:"id"`
+	Name         string  `json:"name" mapstructure:"name"`
+	Description  string  `json:"description" mapstructure:"description"`
+	OwnerID      int     `json:"owner_id" mapstructure:"owner_id"`
+	LinkCount    int     `json:"link_count" mapstructure:"link_count"`
+	ClickCounter int     `json:"click_counter" mapstructure:"click_counter"`
+	Links        []*Link `json:"links,omitempty" mapstructure:"links"`
+}
+
+func (c *Collection) GetType() string {
+	return CollectionType
+}
+
+func (c *Collection) GetList() (lst []interface{}) {
+	lst = append(lst, c.Name, c.Description, c.OwnerID)
+	return
+}
+
+func (c *Collection) Set(m map[string]interface{}) error {
+	if err := mapstructure.Decode(m, &c); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Collection) Get() map[string]interface{} {
+	mCollectionFields := map[string]interface{}{
+		"id":            c.ID,
+		"name":          c.Name,
+		"description":   c.Description,
+		"owner_id":      c.OwnerID,
+		"link_count":    c.LinkCount,
+		"click_counter": c.ClickCounter,
+	}
+	return mCollectionFields
+}
+
+func (c *Collection) String() string {
+	return fmt.Sprintf("{\nID: %d\nName: %s\nDescription: %s\nOwnerID: %d\nLinkCount: %d\nClickCounter: %d\n}",
+		c.ID, c.Name, c.Description, c.OwnerID, c.LinkCount, c.ClickCounter)
+}
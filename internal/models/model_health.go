@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// LinkHealth is the result of the latest background check of the link destination.
+// It is reset when the destination changes.
+type LinkHealth struct {
+	// StatusCode is zero if no response was received
+	StatusCode int    `json:"status_code" mapstructure:"status_code"`
+	LatencyMs  int64  `json:"latency_ms" mapstructure:"latency_ms"`
+	Error      string `json:"error,omitempty" mapstructure:"error"`
+	// Failures counts consecutive failed checks, the link is Broken after too many of them
+	Failures  int       `json:"failures" mapstructure:"failures"`
+	Broken    bool      `json:"broken" mapstructure:"broken"`
+	CheckedAt time.Time `json:"checked_at" mapstructure:"checked_at"`
+}
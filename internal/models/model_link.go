@@ -2,11 +2,27 @@ package models
 
 import (
 	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
 
 	"github.com/mitchellh/mapstructure"
 )
 
-const LinkType = "link"
+const (
+	LinkType = "link"
+
+	// Links of a deleted user are transferred to another user, deactivated or deleted with the user
+	LinksTransfer   = "transfer"
+	LinksDeactivate = "deactivate"
+	LinksDelete     = "delete"
+
+	// Passthrough forwards query parameters or also the path after the token to the destination
+	PassthroughOff   = "off"
+	PassthroughQuery = "query"
+	PassthroughPath  = "path"
+)
 
 type Link struct {
 	ID           int    `json:"id,omitempty" mapstructure:"id"`
@@ -15,6 +31,40 @@ type Link struct {
 	OwnerID      int    `json:"owner_id" mapstructure:"owner_id"`
 	IsActive     bool   `json:"is_active" mapstructure:"is_active"`
 	ShortLink    string `json:"short_link,omitempty" mapstructure:"short_link"`
+	// Domain is the short domain of the link, empty for the default domain
+	Domain      string   `json:"domain,omitempty" mapstructure:"domain"`
+	Tags        []string `json:"tags,omitempty" mapstructure:"tags"`
+	Title       string   `json:"title,omitempty" mapstructure:"title"`
+	Description string   `json:"description,omitempty" mapstructure:"description"`
+	ImageURL    string   `json:"image_url,omitempty" mapstructure:"image_url"`
+	FaviconURL  string   `json:"favicon_url,omitempty" mapstructure:"favicon_url"`
+	WorkspaceID int      `json:"workspace_id,omitempty" mapstructure:"workspace_id"`
+	UTM         *UTM     `json:"utm,omitempty" mapstructure:"utm"`
+	Passthrough string   `json:"passthrough,omitempty" mapstructure:"passthrough"`
+	// Targeting rules are evaluated in order, clicks matching none of them go to LongLink
+	Targeting []TargetRule `json:"targeting,omitempty" mapstructure:"targeting"`
+	// Variants split clicks not matched by targeting rules between several destinations
+	Variants []Variant `json:"variants,omitempty" mapstructure:"variants"`
+	// Schedule delays activation of the link and changes its destination in the future
+	Schedule *Schedule `json:"schedule,omitempty" mapstructure:"schedule"`
+	// Health is set by the background checker of destinations, nil until the first check
+	Health *LinkHealth `json:"health,omitempty" mapstructure:"health"`
+	// Password is only accepted from clients: nil keeps the passphrase, empty removes it.
+	// Protected links ask for the passphrase before redirecting
+	Password  *string `json:"password,omitempty" mapstructure:"-"`
+	Protected bool    `json:"protected,omitempty" mapstructure:"protected"`
+	// PasswordHash is set by the repository when a link is created with a passphrase
+	PasswordHash string `json:"-" mapstructure:"-"`
+	// DeletedAt is set for links in the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty" mapstructure:"-"`
+}
+
+// LinkMetadata is extracted from the destination page in background.
+type LinkMetadata struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	ImageURL    string `json:"image_url"`
+	FaviconURL  string `json:"favicon_url"`
 }
 
 func (l *Link) GetType() string {
@@ -22,7 +72,7 @@ func (l *Link) GetType() string {
 }
 
 func (l *Link) GetList() (lst []interface{}) {
-	lst = append(lst, l.LongLink, l.ClickCounter, l.OwnerID, l.IsActive)
+	lst = append(lst, l.LongLink, l.ClickCounter, l.OwnerID, l.IsActive, l.WorkspaceID, l.Passthrough, l.PasswordHash)
 	return
 }
 
@@ -40,6 +90,19 @@ func (l *Link) Get() map[string]interface{} {
 		"click_counter": l.ClickCounter,
 		"owner_id":      l.OwnerID,
 		"is_active":     l.IsActive,
+		"tags":          l.Tags,
+		"title":         l.Title,
+		"description":   l.Description,
+		"image_url":     l.ImageURL,
+		"favicon_url":   l.FaviconURL,
+		"workspace_id":  l.WorkspaceID,
+		"utm":           l.UTM,
+		"passthrough":   l.Passthrough,
+		"targeting":     l.Targeting,
+		"variants":      l.Variants,
+		"schedule":      l.Schedule,
+		"protected":     l.Protected,
+		"health":        l.Health,
 	}
 	return mLinkFields
 }
@@ -48,3 +111,43 @@ func (l *Link) String() string {
 	return fmt.Sprintf("{\nID: %d\nLongLink: %s\nClickCounter: %d\nOwnerID: %v\nIsActive: %t\n}",
 		l.ID, l.LongLink, l.ClickCounter, l.OwnerID, l.IsActive)
 }
+
+// ValidPassthrough reports whether mode is one of the passthrough modes, empty mode keeps the default.
+func ValidPassthrough(mode string) bool {
+	switch mode {
+	case "", PassthroughOff, PassthroughQuery, PassthroughPath:
+		return true
+	}
+	return false
+}
+
+// Destination returns the long link with the path after the token and query parameters of the request
+// forwarded according to the passthrough mode. Parameters of the long link win over forwarded ones.
+func (l *Link) Destination(extraPath string, query url.Values) (string, error) {
+	if l.Passthrough != PassthroughQuery && l.Passthrough != PassthroughPath {
+		return l.LongLink, nil
+	}
+	dest, err := url.Parse(l.LongLink)
+	if err != nil {
+		return "", err
+	}
+	if l.Passthrough == PassthroughPath && strings.Trim(extraPath, "/") != "" {
+		// Cleaning the rooted path drops ".." segments, so the suffix cannot climb above the long link path
+		suffix := path.Clean("/" + extraPath)
+		if strings.HasSuffix(extraPath, "/") {
+			suffix += "/"
+		}
+		dest.Path = strings.TrimSuffix(dest.Path, "/") + suffix
+		dest.RawPath = ""
+	}
+	if len(query) > 0 {
+		merged := dest.Query()
+		for name, values := range query {
+			if !merged.Has(name) {
+				merged[name] = values
+			}
+		}
+		dest.RawQuery = merged.Encode()
+	}
+	return dest.String(), nil
+}
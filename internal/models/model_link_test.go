@@ -0,0 +1,56 @@
+package models
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestLinkDestination(t *testing.T) {
+	query := url.Values{"q": {"go"}, "page": {"2"}}
+	tests := []struct {
+		name        string
+		longLink    string
+		passthrough string
+		extraPath   string
+		query       url.Values
+		want        string
+	}{
+		{"default", "https://example.com/docs", "", "/guide", query, "https://example.com/docs"},
+		{"off", "https://example.com/docs", PassthroughOff, "/guide", query, "https://example.com/docs"},
+		{"query", "https://example.com/docs", PassthroughQuery, "/guide", query, "https://example.com/docs?page=2&q=go"},
+		{"query of long link wins", "https://example.com/docs?q=rust", PassthroughQuery, "", query,
+			"https://example.com/docs?page=2&q=rust"},
+		{"no query", "https://example.com/docs?b=2&a=1", PassthroughQuery, "", nil, "https://example.com/docs?b=2&a=1"},
+		{"path", "https://example.com/docs", PassthroughPath, "/guide/intro", nil, "https://example.com/docs/guide/intro"},
+		{"path with slashes", "https://example.com/docs/", PassthroughPath, "/guide/", nil, "https://example.com/docs/guide/"},
+		{"path and query", "https://example.com/docs", PassthroughPath, "/guide", query,
+			"https://example.com/docs/guide?page=2&q=go"},
+		{"empty path", "https://example.com/docs", PassthroughPath, "/", nil, "https://example.com/docs"},
+		{"path cannot climb", "https://example.com/docs", PassthroughPath, "/../../admin", nil,
+			"https://example.com/docs/admin"},
+		{"path is escaped", "https://example.com/docs", PassthroughPath, "/a b", nil, "https://example.com/docs/a%20b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link := &Link{LongLink: tt.longLink, Passthrough: tt.passthrough}
+			got, err := link.Destination(tt.extraPath, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Destination(%q, %v) = %q, want %q", tt.extraPath, tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidPassthrough(t *testing.T) {
+	for _, mode := range []string{"", PassthroughOff, PassthroughQuery, PassthroughPath} {
+		if !ValidPassthrough(mode) {
+			t.Errorf("mode %q is rejected", mode)
+		}
+	}
+	if ValidPassthrough("all") {
+		t.Error("unknown mode is accepted")
+	}
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+)
+
+// scheduleLocalLayouts are accepted for schedule times without a zone offset, such times are in the configured timezone
+var scheduleLocalLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// Schedule holds the activation time of the link and future changes of its destination.
+// Times are stored in RFC 3339 with the offset of the configured timezone.
+type Schedule struct {
+	// The link does not redirect before ActivateAt
+	ActivateAt string            `json:"activate_at,omitempty" mapstructure:"activate_at"`
+	Changes    []ScheduledChange `json:"changes,omitempty" mapstructure:"changes"`
+}
+
+// ScheduledChange replaces the destination of the link starting from At.
+type ScheduledChange struct {
+	At          string `json:"at" mapstructure:"at"`
+	Destination string `json:"destination" mapstructure:"destination"`
+}
+
+// ParseScheduleTime parses the time in RFC 3339 or, without a zone offset, in the location.
+func ParseScheduleTime(value string, loc *time.Location) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+	for _, layout := range scheduleLocalLayouts {
+		if t, localErr := time.ParseInLocation(layout, value, loc); localErr == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// Active reports whether the link is activated at the moment, links without a schedule are always activated.
+func (s *Schedule) Active(now time.Time) bool {
+	if s == nil || s.ActivateAt == "" {
+		return true
+	}
+	activateAt, err := time.Parse(time.RFC3339, s.ActivateAt)
+	return err == nil && !now.Before(activateAt)
+}
+
+// Destination returns the destination of the latest change due at the moment, empty if no change is due.
+func (s *Schedule) Destination(now time.Time) string {
+	if s == nil {
+		return ""
+	}
+	var (
+		destination string
+		latest      time.Time
+	)
+	for _, change := range s.Changes {
+		at, err := time.Parse(time.RFC3339, change.At)
+		if err != nil || now.Before(at) || (destination != "" && at.Before(latest)) {
+			continue
+		}
+		destination, latest = change.Destination, at
+	}
+	return destination
+}
+
+// IsZero reports whether neither activation nor changes are scheduled.
+func (s *Schedule) IsZero() bool {
+	return s == nil || s.ActivateAt == "" && len(s.Changes) == 0
+}
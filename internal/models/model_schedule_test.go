@@ -0,0 +1,79 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseScheduleTime(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	tests := []struct {
+		value string
+		want  time.Time
+		ok    bool
+	}{
+		{"2024-05-01T10:00:00Z", time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), true},
+		{"2024-05-01T10:00:00+01:00", time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC), true},
+		{"2024-05-01T10:00", time.Date(2024, 5, 1, 10, 0, 0, 0, loc), true},
+		{"2024-05-01 10:00:30", time.Date(2024, 5, 1, 10, 0, 30, 0, loc), true},
+		{"2024-05-01", time.Date(2024, 5, 1, 0, 0, 0, 0, loc), true},
+		{"01.05.2024", time.Time{}, false},
+		{"", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseScheduleTime(tt.value, loc)
+		if (err == nil) != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("ParseScheduleTime(%q) = %s, %v, want %s, ok = %t", tt.value, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestScheduleActive(t *testing.T) {
+	activateAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		schedule *Schedule
+		now      time.Time
+		want     bool
+	}{
+		{"no schedule", nil, activateAt.Add(-time.Hour), true},
+		{"no activation", &Schedule{}, activateAt.Add(-time.Hour), true},
+		{"before activation", &Schedule{ActivateAt: "2024-05-01T13:00:00+03:00"}, activateAt.Add(-time.Second), false},
+		{"at activation", &Schedule{ActivateAt: "2024-05-01T13:00:00+03:00"}, activateAt, true},
+		{"after activation", &Schedule{ActivateAt: "2024-05-01T10:00:00Z"}, activateAt.Add(time.Hour), true},
+		{"bad activation time", &Schedule{ActivateAt: "soon"}, activateAt, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.Active(tt.now); got != tt.want {
+				t.Errorf("Active(%s) = %t, want %t", tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleDestination(t *testing.T) {
+	schedule := &Schedule{Changes: []ScheduledChange{
+		{At: "2024-06-01T00:00:00Z", Destination: "https://example.com/june"},
+		{At: "2024-05-01T00:00:00Z", Destination: "https://example.com/may"},
+		{At: "bad time", Destination: "https://example.com/never"},
+	}}
+	tests := []struct {
+		name     string
+		schedule *Schedule
+		now      time.Time
+		want     string
+	}{
+		{"no schedule", nil, time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), ""},
+		{"no change is due", schedule, time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC), ""},
+		{"at the change", schedule, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), "https://example.com/may"},
+		{"latest due change", schedule, time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), "https://example.com/june"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.Destination(tt.now); got != tt.want {
+				t.Errorf("Destination(%s) = %q, want %q", tt.now, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+const SessionType = "session"
+
+// Session is the metadata of a server-side login session, the session data and token are never exposed.
+type Session struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"user_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	Current    bool      `json:"current,omitempty"`
+}
+
+func (s *Session) GetType() string {
+	return SessionType
+}
+
+func (s *Session) String() string {
+	return fmt.Sprintf("{\nID: %d\nUserID: %d\nCreatedAt: %s\nLastSeenAt: %s\nIP: %s\nUserAgent: %s\n}",
+		s.ID, s.UserID, s.CreatedAt, s.LastSeenAt, s.IP, s.UserAgent)
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/mitchellh/mapstructure"
 )
@@ -12,6 +13,16 @@ type ShortLink struct {
 	ID         int    `json:"id,omitempty" mapstructure:"id"`
 	Token      string `json:"token" mapstructure:"token"`
 	LongLinkID int    `json:"long_link_id" mapstructure:"long_link_id"`
+	// Tokens are unique per short domain, the default domain is stored as empty
+	Domain string `json:"domain,omitempty" mapstructure:"domain"`
+	// A link may have several tokens (e.g. one per campaign channel) distinguished by labels
+	Label        string `json:"label,omitempty" mapstructure:"label"`
+	ClickCounter int    `json:"click_counter" mapstructure:"click_counter"`
+	// Retired tokens do not redirect but stay reserved
+	RetiredAt *time.Time `json:"retired_at,omitempty" mapstructure:"retired_at"`
+	// UTM parameters of the token override parameters of the link
+	UTM      *UTM   `json:"utm,omitempty" mapstructure:"utm"`
+	ShortURL string `json:"short_url,omitempty" mapstructure:"-"`
 }
 
 func (s *ShortLink) GetType() string {
@@ -19,7 +30,7 @@ func (s *ShortLink) GetType() string {
 }
 
 func (s *ShortLink) GetList() (lst []interface{}) {
-	lst = append(lst, s.Token, s.LongLinkID)
+	lst = append(lst, s.Token, s.LongLinkID, s.Domain, s.Label)
 	return
 }
 
@@ -32,14 +43,19 @@ func (s *ShortLink) Set(m map[string]interface{}) error {
 
 func (s *ShortLink) Get() map[string]interface{} {
 	mShortLinkFields := map[string]interface{}{
-		"id":           s.ID,
-		"token":        s.Token,
-		"long_link_id": s.LongLinkID,
+		"id":            s.ID,
+		"token":         s.Token,
+		"long_link_id":  s.LongLinkID,
+		"domain":        s.Domain,
+		"label":         s.Label,
+		"click_counter": s.ClickCounter,
+		"retired_at":    s.RetiredAt,
+		"utm":           s.UTM,
 	}
 	return mShortLinkFields
 }
 
 func (s *ShortLink) String() string {
-	return fmt.Sprintf("{\nID: %d\nToken: %s\nLongLinkID: %d\n}",
-		s.ID, s.Token, s.LongLinkID)
+	return fmt.Sprintf("{\nID: %d\nToken: %s\nLongLinkID: %d\nDomain: %s\nLabel: %s\nClickCounter: %d\n}",
+		s.ID, s.Token, s.LongLinkID, s.Domain, s.Label, s.ClickCounter)
 }
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+const TagType = "tag"
+
+type Tag struct {
+	ID        int    `json:"id,omitempty" mapstructure:"id"`
+	Name      string `json:"name" mapstructure:"name"`
+	OwnerID   int    `json:"owner_id" mapstructure:"owner_id"`
+	LinkCount int    `json:"link_count" mapstructure:"link_count"`
+}
+
+func (t *Tag) GetType() string {
+	return TagType
+}
+
+func (t *Tag) GetList() (lst []interface{}) {
+	lst = append(lst, t.Name, t.OwnerID)
+	return
+}
+
+func (t *Tag) Set(m map[string]interface{}) error {
+	if err := mapstructure.Decode(m, &t); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (t *Tag) Get() map[string]interface{} {
+	mTagFields := map[string]interface{}{
+		"id":         t.ID,
+		"name":       t.Name,
+		"owner_id":   t.OwnerID,
+		"link_count": t.LinkCount,
+	}
+	return mTagFields
+}
+
+func (t *Tag) String() string {
+	return fmt.Sprintf("{\nID: %d\nName: %s\nOwnerID: %d\nLinkCount: %d\n}",
+		t.ID, t.Name, t.OwnerID, t.LinkCount)
+}
@@ -0,0 +1,27 @@
+package models
+
+const (
+	// Device classes detected from the User-Agent header
+	DeviceIOS     = "ios"
+	DeviceAndroid = "android"
+	DeviceDesktop = "desktop"
+)
+
+// TargetRule sends clicks matching all of its conditions to the destination. A condition matches
+// if any of its values matches, empty conditions match every click. Languages match by prefix,
+// so "en" matches "en-US" while "en-GB" matches only "en-GB".
+type TargetRule struct {
+	Countries   []string `json:"countries,omitempty" mapstructure:"countries"`
+	Languages   []string `json:"languages,omitempty" mapstructure:"languages"`
+	Devices     []string `json:"devices,omitempty" mapstructure:"devices"`
+	Destination string   `json:"destination" mapstructure:"destination"`
+}
+
+// ValidDevice reports whether device is one of the device classes.
+func ValidDevice(device string) bool {
+	switch device {
+	case DeviceIOS, DeviceAndroid, DeviceDesktop:
+		return true
+	}
+	return false
+}
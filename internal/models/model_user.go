@@ -2,21 +2,36 @@ package models
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/mitchellh/mapstructure"
 )
 
-const UserType = "user"
+const (
+	UserType = "user"
+
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
 
 type User struct {
-	ID         int    `json:"id,omitempty" mapstructure:"id"`
-	Username   string `json:"username,omitempty" mapstructure:"username" form:"username"`
-	Password   string `json:"password,omitempty" mapstructure:"password" form:"password"`
-	FirstName  string `json:"first_name,omitempty" mapstructure:"first_name"`
-	LastName   string `json:"last_name,omitempty" mapstructure:"last_name"`
-	Email      string `json:"email,omitempty" mapstructure:"email"`
-	Phone      string `json:"phone,omitempty" mapstructure:"phone"`
-	UserStatus bool   `json:"user_status" mapstructure:"user_status"`
+	ID       int    `json:"id,omitempty" mapstructure:"id"`
+	Username string `json:"username,omitempty" mapstructure:"username" form:"username"`
+	// Password is only accepted from clients, the repository replaces it with PasswordHash
+	Password string `json:"password,omitempty" mapstructure:"-" form:"password"`
+	// PasswordHash is empty for users provisioned by single sign-on
+	PasswordHash string `json:"-" mapstructure:"password"`
+	FirstName    string `json:"first_name,omitempty" mapstructure:"first_name"`
+	LastName     string `json:"last_name,omitempty" mapstructure:"last_name"`
+	Email        string `json:"email,omitempty" mapstructure:"email"`
+	Phone        string `json:"phone,omitempty" mapstructure:"phone"`
+	UserStatus   bool   `json:"user_status" mapstructure:"user_status"`
+	// PendingVerification is set for self-registered users until they confirm their email
+	PendingVerification bool   `json:"pending_verification,omitempty" mapstructure:"pending_verification"`
+	TOTPEnabled         bool   `json:"totp_enabled,omitempty" mapstructure:"totp_enabled"`
+	Role                string `json:"role,omitempty" mapstructure:"role"`
+	// DeletedAt is set for users in the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty" mapstructure:"-"`
 }
 
 func (u *User) GetType() string {
@@ -24,7 +39,7 @@ func (u *User) GetType() string {
 }
 
 func (u *User) GetList() (lst []interface{}) {
-	lst = append(lst, u.Username, u.Password, u.FirstName, u.LastName, u.Email, u.Phone, u.UserStatus)
+	lst = append(lst, u.Username, u.PasswordHash, u.FirstName, u.LastName, u.Email, u.Phone, u.UserStatus, u.PendingVerification, u.Role)
 	return
 }
 
@@ -37,19 +52,22 @@ func (u *User) Set(m map[string]interface{}) error {
 
 func (u *User) Get() map[string]interface{} {
 	mUserFields := map[string]interface{}{
-		"id":          u.ID,
-		"username":    u.Username,
-		"password":    u.Password,
-		"first_name":  u.FirstName,
-		"last_name":   u.LastName,
-		"email":       u.Email,
-		"phone":       u.Phone,
-		"user_status": u.UserStatus,
+		"id":                   u.ID,
+		"username":             u.Username,
+		"password":             u.PasswordHash,
+		"first_name":           u.FirstName,
+		"last_name":            u.LastName,
+		"email":                u.Email,
+		"phone":                u.Phone,
+		"user_status":          u.UserStatus,
+		"pending_verification": u.PendingVerification,
+		"totp_enabled":         u.TOTPEnabled,
 	}
 	return mUserFields
 }
 
 func (u *User) String() string {
-	return fmt.Sprintf("{\nID: %d\nUsername: %s\nPassword: %s\nFirstName: %s\nLastName: %s\nEmail: %s\nPhone: %s\nUserStatus: %t\n}",
-		u.ID, u.Username, u.Password, u.FirstName, u.LastName, u.Email, u.Phone, u.UserStatus)
+	return fmt.Sprintf("{\nID: %d\nUsername: %s\nFirstName: %s\nLastName: %s\nEmail: %s\nPhone: %s\nUserStatus: %t\nPendingVerification: %t\nTOTPEnabled: %t\n}",
+		u.ID, u.Username, u.FirstName, u.LastName, u.Email, u.Phone, u.UserStatus, u.PendingVerification,
+		u.TOTPEnabled)
 }
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"net/url"
+)
+
+// UTM holds campaign parameters added to the destination at redirect time.
+// Override replaces UTM parameters already present in the destination, otherwise they are preserved.
+type UTM struct {
+	Source   string `json:"source,omitempty" mapstructure:"source"`
+	Medium   string `json:"medium,omitempty" mapstructure:"medium"`
+	Campaign string `json:"campaign,omitempty" mapstructure:"campaign"`
+	Term     string `json:"term,omitempty" mapstructure:"term"`
+	Content  string `json:"content,omitempty" mapstructure:"content"`
+	Override bool   `json:"override,omitempty" mapstructure:"override"`
+}
+
+// Merge returns the parameters of u overridden by non-empty parameters of token,
+// Override of the token wins if the token has own settings.
+func (u *UTM) Merge(token *UTM) *UTM {
+	if u == nil {
+		return token
+	}
+	if token == nil {
+		return u
+	}
+	merged := *u
+	for _, field := range []struct {
+		dst *string
+		src string
+	}{
+		{&merged.Source, token.Source},
+		{&merged.Medium, token.Medium},
+		{&merged.Campaign, token.Campaign},
+		{&merged.Term, token.Term},
+		{&merged.Content, token.Content},
+	} {
+		if field.src != "" {
+			*field.dst = field.src
+		}
+	}
+	merged.Override = token.Override
+	return &merged
+}
+
+// Apply adds the parameters to the query string of the destination.
+func (u *UTM) Apply(destination string) (string, error) {
+	if u == nil {
+		return destination, nil
+	}
+	dest, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+	query := dest.Query()
+	changed := false
+	for _, param := range []struct{ name, value string }{
+		{"utm_source", u.Source},
+		{"utm_medium", u.Medium},
+		{"utm_campaign", u.Campaign},
+		{"utm_term", u.Term},
+		{"utm_content", u.Content},
+	} {
+		if param.value == "" || (!u.Override && query.Has(param.name)) {
+			continue
+		}
+		query.Set(param.name, param.value)
+		changed = true
+	}
+	if !changed {
+		return destination, nil
+	}
+	dest.RawQuery = query.Encode()
+	return dest.String(), nil
+}
+
+// IsZero reports whether no parameter is set.
+func (u *UTM) IsZero() bool {
+	return u == nil || u.Source == "" && u.Medium == "" && u.Campaign == "" && u.Term == "" && u.Content == ""
+}
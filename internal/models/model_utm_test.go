@@ -0,0 +1,70 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUTMMerge(t *testing.T) {
+	link := &UTM{Source: "newsletter", Medium: "email", Campaign: "spring"}
+	tests := []struct {
+		name  string
+		link  *UTM
+		token *UTM
+		want  *UTM
+	}{
+		{"no settings", nil, nil, nil},
+		{"link only", link, nil, link},
+		{"token only", nil, &UTM{Source: "ads"}, &UTM{Source: "ads"}},
+		{"token wins", link, &UTM{Source: "ads", Term: "shoes", Override: true},
+			&UTM{Source: "ads", Medium: "email", Campaign: "spring", Term: "shoes", Override: true}},
+		{"token override is used", &UTM{Source: "newsletter", Override: true}, &UTM{Medium: "cpc"},
+			&UTM{Source: "newsletter", Medium: "cpc"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.link.Merge(tt.token); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Merge = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	if link.Source != "newsletter" || link.Override {
+		t.Errorf("link settings are changed: %+v", link)
+	}
+}
+
+func TestUTMApply(t *testing.T) {
+	tests := []struct {
+		name        string
+		utm         *UTM
+		destination string
+		want        string
+	}{
+		{"no settings", nil, "https://example.com/?a=1", "https://example.com/?a=1"},
+		{"empty settings", &UTM{}, "https://example.com/?b=2&a=1", "https://example.com/?b=2&a=1"},
+		{"added", &UTM{Source: "news letter", Medium: "email"}, "https://example.com/page?a=1",
+			"https://example.com/page?a=1&utm_medium=email&utm_source=news+letter"},
+		{"present are kept", &UTM{Source: "newsletter", Campaign: "spring"}, "https://example.com/?utm_source=ads",
+			"https://example.com/?utm_campaign=spring&utm_source=ads"},
+		{"present are overridden", &UTM{Source: "newsletter", Override: true}, "https://example.com/?utm_source=ads",
+			"https://example.com/?utm_source=newsletter"},
+		{"fragment is kept", &UTM{Term: "shoes"}, "https://example.com/#top", "https://example.com/?utm_term=shoes#top"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.utm.Apply(tt.destination)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Apply(%q) = %q, want %q", tt.destination, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUTMApplyBadDestination(t *testing.T) {
+	if _, err := (&UTM{Source: "newsletter"}).Apply("http://exa mple.com/%zz"); err == nil {
+		t.Error("bad destination is accepted")
+	}
+}
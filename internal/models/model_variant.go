@@ -0,0 +1,44 @@
+package models
+
+// Variant is one of the weighted destinations of a link split between several landing pages.
+// Clicks are distributed in proportion to weights, a variant with zero weight gets no new clicks.
+type Variant struct {
+	ID           int    `json:"id,omitempty" mapstructure:"id"`
+	Name         string `json:"name" mapstructure:"name"`
+	Destination  string `json:"destination" mapstructure:"destination"`
+	Weight       int    `json:"weight" mapstructure:"weight"`
+	ClickCounter int    `json:"click_counter" mapstructure:"click_counter"`
+}
+
+// TotalWeight returns the sum of weights of the variants.
+func TotalWeight(variants []Variant) int {
+	total := 0
+	for _, variant := range variants {
+		total += variant.Weight
+	}
+	return total
+}
+
+// PickVariant returns the variant owning the roll in [0, TotalWeight) or nil if the roll is out of range.
+func PickVariant(variants []Variant, roll int) *Variant {
+	if roll < 0 {
+		return nil
+	}
+	for i := range variants {
+		if roll < variants[i].Weight {
+			return &variants[i]
+		}
+		roll -= variants[i].Weight
+	}
+	return nil
+}
+
+// VariantByID returns the variant with the ID or nil if the link has no such variant.
+func (l *Link) VariantByID(id int) *Variant {
+	for i := range l.Variants {
+		if l.Variants[i].ID == id {
+			return &l.Variants[i]
+		}
+	}
+	return nil
+}
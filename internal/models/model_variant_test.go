@@ -0,0 +1,44 @@
+package models
+
+import "testing"
+
+func TestPickVariant(t *testing.T) {
+	variants := []Variant{
+		{Name: "A", Weight: 2},
+		{Name: "B", Weight: 0},
+		{Name: "C", Weight: 1},
+	}
+	if total := TotalWeight(variants); total != 3 {
+		t.Fatalf("TotalWeight = %d, want 3", total)
+	}
+	tests := []struct {
+		roll int
+		want string
+	}{
+		{-1, ""},
+		{0, "A"},
+		{1, "A"},
+		// Variants with zero weight own no rolls
+		{2, "C"},
+		{3, ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if variant := PickVariant(variants, tt.roll); variant != nil {
+			got = variant.Name
+		}
+		if got != tt.want {
+			t.Errorf("PickVariant(%d) = %q, want %q", tt.roll, got, tt.want)
+		}
+	}
+}
+
+func TestVariantByID(t *testing.T) {
+	link := &Link{Variants: []Variant{{ID: 7, Name: "A"}, {ID: 9, Name: "B"}}}
+	if variant := link.VariantByID(9); variant == nil || variant.Name != "B" {
+		t.Errorf("VariantByID(9) = %+v, want B", variant)
+	}
+	if variant := link.VariantByID(8); variant != nil {
+		t.Errorf("VariantByID(8) = %+v, want nil", variant)
+	}
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	WebhookType = "webhook"
+
+	EventLinkCreated = "link.created"
+	EventLinkUpdated = "link.updated"
+	EventLinkDeleted = "link.deleted"
+	EventLinkClicked = "link.clicked"
+	// EventWebhookTest is sent by test deliveries regardless of subscribed events
+	EventWebhookTest = "webhook.test"
+
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookEvents are the events a webhook may subscribe to.
+var WebhookEvents = []string{EventLinkCreated, EventLinkUpdated, EventLinkDeleted, EventLinkClicked}
+
+// Webhook is a subscription of an URL to link events. Workspace webhooks receive events of all links
+// of the workspace, personal webhooks (without a workspace) receive events of links of the owner.
+type Webhook struct {
+	ID          int      `json:"id,omitempty"`
+	OwnerID     int      `json:"owner_id"`
+	WorkspaceID int      `json:"workspace_id,omitempty"`
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	// Secret signs payloads, it is only returned when the webhook is created or the secret is changed
+	Secret    string    `json:"secret,omitempty"`
+	Disabled  bool      `json:"disabled"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is an event sent or to be sent to a webhook, failed attempts are retried with backoff.
+type WebhookDelivery struct {
+	ID         int64           `json:"id"`
+	WebhookID  int             `json:"webhook_id"`
+	Event      string          `json:"event"`
+	Payload    json.RawMessage `json:"payload"`
+	Status     string          `json:"status"`
+	Attempts   int             `json:"attempts"`
+	StatusCode int             `json:"status_code,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	// NextAttemptAt is the time of the next attempt of pending deliveries
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	LastAttemptAt *time.Time `json:"last_attempt_at,omitempty"`
+	// URL and Secret of the webhook are filled for sending only
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// ValidWebhookEvent reports whether the webhook may subscribe to the event.
+func ValidWebhookEvent(event string) bool {
+	for _, e := range WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Webhook) GetType() string {
+	return WebhookType
+}
+
+func (w *Webhook) String() string {
+	return fmt.Sprintf("{\nID: %d\nOwnerID: %d\nWorkspaceID: %d\nURL: %s\nEvents: %v\nDisabled: %t\n}",
+		w.ID, w.OwnerID, w.WorkspaceID, w.URL, w.Events, w.Disabled)
+}
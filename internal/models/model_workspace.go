@@ -0,0 +1,83 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	WorkspaceType = "workspace"
+
+	// Viewers read links of the workspace, editors also manage them, owners also manage members
+	WorkspaceOwner  = "owner"
+	WorkspaceEditor = "editor"
+	WorkspaceViewer = "viewer"
+)
+
+var workspaceRoleRanks = map[string]int{
+	WorkspaceViewer: 1,
+	WorkspaceEditor: 2,
+	WorkspaceOwner:  3,
+}
+
+// WorkspaceRoleAllows reports whether role grants the permissions of required role.
+func WorkspaceRoleAllows(role, required string) bool {
+	rank, ok := workspaceRoleRanks[role]
+	return ok && rank >= workspaceRoleRanks[required]
+}
+
+// ValidWorkspaceRole reports whether role is one of the workspace roles.
+func ValidWorkspaceRole(role string) bool {
+	_, ok := workspaceRoleRanks[role]
+	return ok
+}
+
+type Workspace struct {
+	ID   int    `json:"id,omitempty" mapstructure:"id"`
+	Name string `json:"name" mapstructure:"name"`
+	// Personal workspace is created for every user and has no other members
+	Personal bool `json:"personal" mapstructure:"personal"`
+	// Role is the role of the current user in the workspace
+	Role      string `json:"role,omitempty" mapstructure:"role"`
+	LinkCount int    `json:"link_count" mapstructure:"link_count"`
+}
+
+type WorkspaceMember struct {
+	WorkspaceID int    `json:"workspace_id"`
+	UserID      int    `json:"user_id"`
+	Username    string `json:"username,omitempty"`
+	Role        string `json:"role"`
+}
+
+func (w *Workspace) GetType() string {
+	return WorkspaceType
+}
+
+func (w *Workspace) GetList() (lst []interface{}) {
+	lst = append(lst, w.Name)
+	return
+}
+
+func (w *Workspace) Set(m map[string]interface{}) error {
+	if err := mapstructure.Decode(m, &w); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (w *Workspace) Get() map[string]interface{} {
+	mWorkspaceFields := map[string]interface{}{
+		"id":         w.ID,
+		"name":       w.Name,
+		"personal":   w.Personal,
+		"role":       w.Role,
+		"link_count": w.LinkCount,
+	}
+	return mWorkspaceFields
+}
+
+func (w *Workspace) String() string {
+	return fmt.Sprintf("{\nID: %d\nName: %s\nPersonal: %t\nRole: %s\nLinkCount: %d\n}",
+		w.ID, w.Name, w.Personal, w.Role, w.LinkCount)
+}
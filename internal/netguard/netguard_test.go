@@ -0,0 +1,71 @@
+package netguard
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIsDenied(t *testing.T) {
+	tests := []struct {
+		ip     string
+		denied bool
+	}{
+		{"93.184.216.34", false},
+		{"2606:2800:220:1:248:1893:25c8:1946", false},
+		{"127.0.0.1", true},
+		{"10.1.2.3", true},
+		{"172.31.255.255", true},
+		{"172.32.0.1", false},
+		{"192.168.0.1", true},
+		{"169.254.169.254", true},
+		{"100.64.0.1", true},
+		{"0.0.0.0", true},
+		{"::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"fd00::1", true},
+		{"fe80::1", true},
+		{"ff02::1", true},
+	}
+	for _, tt := range tests {
+		if got := IsDenied(net.ParseIP(tt.ip)); got != tt.denied {
+			t.Errorf("IsDenied(%s) = %t, want %t", tt.ip, got, tt.denied)
+		}
+	}
+}
+
+func TestControl(t *testing.T) {
+	tests := []struct {
+		address string
+		denied  bool
+	}{
+		{"93.184.216.34:443", false},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", false},
+		{"127.0.0.1:80", true},
+		{"[::1]:80", true},
+		// Addresses are resolved before dialing, host names are not expected
+		{"example.com:80", true},
+	}
+	for _, tt := range tests {
+		err := Control("tcp", tt.address, nil)
+		if denied := errors.Is(err, ErrDeniedAddress); denied != tt.denied {
+			t.Errorf("Control(%s) = %v, want denied = %t", tt.address, err, tt.denied)
+		}
+	}
+	if err := Control("tcp", "no port", nil); err == nil {
+		t.Error("address without port is accepted")
+	}
+}
+
+func TestNewClientRefusesLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	_, err := NewClient(time.Second, 3).Get(server.URL)
+	if !errors.Is(err, ErrDeniedAddress) {
+		t.Errorf("err = %v, want %v", err, ErrDeniedAddress)
+	}
+}
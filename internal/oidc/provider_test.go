@@ -0,0 +1,153 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const (
+	testClientID     = "shortlink"
+	testClientSecret = "secret"
+	testRedirectURL  = "http://app.example.loc/login/oidc/callback"
+)
+
+var testUsers = []StubUser{
+	{Subject: "sub-alice", Username: "alice", Email: "alice@example.loc", EmailVerified: true, Groups: []string{"admins", "staff"}},
+	{Subject: "sub-bob", Username: "bob", Email: "bob@example.loc"},
+}
+
+// newTestIdP starts the stub IdP and returns a provider configured for it.
+func newTestIdP(t *testing.T) (*StubIdP, *Provider) {
+	t.Helper()
+	var idp *StubIdP
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idp.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	var err error
+	if idp, err = NewStubIdP(srv.URL, testClientID, testClientSecret, testUsers...); err != nil {
+		t.Fatal(err)
+	}
+	provider := NewProvider(Config{
+		IssuerURL:    srv.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+	}, srv.Client())
+	return idp, provider
+}
+
+// authorize signs in the user with the username at the IdP and returns the code and state of the redirect.
+func authorize(t *testing.T, p *Provider, state, nonce, challenge, username string) (string, string) {
+	t.Helper()
+	authURL, err := p.AuthCodeURL(context.Background(), state, nonce, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := *p.client
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(authURL + "&login_hint=" + url.QueryEscape(username))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize status = %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestExchange(t *testing.T) {
+	_, p := newTestIdP(t)
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := authorize(t, p, "state-1", "nonce-1", challenge, "alice")
+	if state != "state-1" {
+		t.Errorf("state = %q, want %q", state, "state-1")
+	}
+	claims, err := p.Exchange(context.Background(), code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "sub-alice" || claims.Email != "alice@example.loc" || !claims.EmailVerified ||
+		claims.PreferredUsername != "alice" {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+	groups := claims.Strings("groups")
+	if len(groups) != 2 || groups[0] != "admins" || groups[1] != "staff" {
+		t.Errorf("groups = %v, want [admins staff]", groups)
+	}
+
+	// Codes are redeemed once
+	if _, err := p.Exchange(context.Background(), code, verifier, "nonce-1"); err == nil {
+		t.Error("reused code is accepted")
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	_, p := newTestIdP(t)
+	_, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherVerifier, _, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := authorize(t, p, "state", "nonce", challenge, "alice")
+	if _, err := p.Exchange(context.Background(), code, otherVerifier, "nonce"); err == nil {
+		t.Error("code is redeemed with a wrong PKCE verifier")
+	}
+}
+
+func TestExchangeRejectsWrongNonce(t *testing.T) {
+	_, p := newTestIdP(t)
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := authorize(t, p, "state", "nonce", challenge, "alice")
+	_, err = p.Exchange(context.Background(), code, verifier, "another-nonce")
+	if !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("err = %v, want %v", err, ErrInvalidIDToken)
+	}
+}
+
+func TestExchangeRejectsWrongClientSecret(t *testing.T) {
+	idp, p := newTestIdP(t)
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := authorize(t, p, "state", "nonce", challenge, "alice")
+	idp.ClientSecret = "rotated"
+	if _, err := p.Exchange(context.Background(), code, verifier, "nonce"); err == nil {
+		t.Error("code is redeemed with a wrong client secret")
+	}
+}
+
+func TestVerifyIDTokenRejectsForeignSignature(t *testing.T) {
+	_, p := newTestIdP(t)
+	other, err := NewStubIdP(p.config.IssuerURL, testClientID, testClientSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := other.sign(map[string]any{"iss": p.config.IssuerURL, "sub": "sub-alice", "aud": testClientID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.VerifyIDToken(context.Background(), token, "")
+	if !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("err = %v, want %v", err, ErrInvalidIDToken)
+	}
+}
@@ -0,0 +1,70 @@
+// Package ratelimit provides an in-memory fixed window rate limiter keyed by arbitrary strings
+// (client IP, account name, etc.).
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type window struct {
+	start time.Time
+	count int
+}
+
+type Limiter struct {
+	limit  int
+	period time.Duration
+
+	mu      sync.Mutex
+	windows map[string]*window
+	cleaned time.Time
+}
+
+// New returns a limiter allowing limit events per period for every key.
+func New(limit int, period time.Duration) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		period:  period,
+		windows: make(map[string]*window),
+		cleaned: time.Now(),
+	}
+}
+
+// Allow registers an event for the key and reports whether it fits into the limit.
+func (l *Limiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.cleanup(now)
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.period {
+		w = &window{start: now}
+		l.windows[key] = w
+	}
+	if w.count >= l.limit {
+		return false
+	}
+	w.count++
+	return true
+}
+
+// Reset forgets all events of the key (e.g. after a successful login).
+func (l *Limiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.windows, key)
+}
+
+func (l *Limiter) cleanup(now time.Time) {
+	if now.Sub(l.cleaned) < l.period {
+		return
+	}
+	for key, w := range l.windows {
+		if now.Sub(w.start) >= l.period {
+			delete(l.windows, key)
+		}
+	}
+	l.cleaned = now
+}
@@ -0,0 +1,69 @@
+package objrepo
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/ptsypyshev/shortlink/internal/audit"
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+type AuditStorage interface {
+	CreateAuditEntry(ctx context.Context, entry *models.AuditEntry) error
+	SearchAuditEntries(ctx context.Context, filter models.AuditFilter) ([]*models.AuditEntry, int, error)
+}
+
+type Audit struct {
+	store  AuditStorage
+	logger *zap.Logger
+}
+
+func AuditNew(s AuditStorage, l *zap.Logger) *Audit {
+	return &Audit{
+		store:  s,
+		logger: l,
+	}
+}
+
+// Record stores an audit entry for the actor from ctx, before and after are the object states
+// (nil for created and deleted objects). Updates without recorded changes are skipped.
+// A failure to record is logged and does not fail the audited operation.
+func (a Audit) Record(ctx context.Context, action, targetType string, targetID int, before, after any) {
+	entry := a.Entry(ctx, action, targetType, targetID, before, after)
+	if action == audit.ActionUpdate && len(entry.Changes) == 0 {
+		return
+	}
+	if err := a.store.CreateAuditEntry(ctx, entry); err != nil {
+		a.logger.Error(fmt.Sprintf(`cannot record audit entry %s %s %d: %s`, action, targetType, targetID, err))
+	}
+}
+
+// Entry builds an audit entry for the actor from ctx without storing it,
+// it is used when the entry is stored in the transaction of the audited change.
+func (a Audit) Entry(ctx context.Context, action, targetType string, targetID int, before, after any) *models.AuditEntry {
+	changes, err := audit.Diff(before, after)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf(`cannot diff %s %d for audit: %s`, targetType, targetID, err))
+	}
+	actor := audit.ActorFrom(ctx)
+	return &models.AuditEntry{
+		ActorID:    actor.UserID,
+		ActorName:  actor.Username,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Changes:    changes,
+		IP:         actor.IP,
+	}
+}
+
+func (a Audit) Search(ctx context.Context, filter models.AuditFilter) ([]*models.AuditEntry, int, error) {
+	entries, total, err := a.store.SearchAuditEntries(ctx, filter)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf(`cannot search audit entries: %s`, err))
+		return nil, 0, fmt.Errorf("cannot search audit entries: %w", err)
+	}
+	return entries, total, nil
+}
@@ -0,0 +1,113 @@
+package objrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+var ErrBadCollection = errors.New("bad collection")
+
+type CollectionStorage interface {
+	CreateCollection(ctx context.Context, collection *models.Collection) (int, error)
+	ReadCollection(ctx context.Context, id, ownerID int) (*models.Collection, error)
+	SearchCollections(ctx context.Context, ownerID int) ([]*models.Collection, error)
+	SearchCollectionLinks(ctx context.Context, id int) ([]*models.Link, error)
+	UpdateCollection(ctx context.Context, collection *models.Collection) error
+	DeleteCollection(ctx context.Context, id, ownerID int) error
+	AddCollectionLink(ctx context.Context, id, linkID, ownerID int) error
+	RemoveCollectionLink(ctx context.Context, id, linkID, ownerID int) error
+}
+
+type Collections struct {
+	store  CollectionStorage
+	logger *zap.Logger
+}
+
+func CollectionsNew(s CollectionStorage, l *zap.Logger) *Collections {
+	return &Collections{
+		store:  s,
+		logger: l,
+	}
+}
+
+func (c Collections) Create(ctx context.Context, collection *models.Collection) (*models.Collection, error) {
+	collection.Name = strings.TrimSpace(collection.Name)
+	if collection.Name == "" {
+		return nil, fmt.Errorf("cannot create collection: %w: empty name", ErrBadCollection)
+	}
+	id, err := c.store.CreateCollection(ctx, collection)
+	if err != nil {
+		c.logger.Error(fmt.Sprintf(`cannot create collection: %s`, err))
+		return nil, fmt.Errorf("cannot create collection: %w", err)
+	}
+	collection.ID = id
+	return collection, nil
+}
+
+// Read returns the collection with aggregated counters and all its links.
+func (c Collections) Read(ctx context.Context, id, ownerID int) (*models.Collection, error) {
+	collection, err := c.store.ReadCollection(ctx, id, ownerID)
+	if err != nil {
+		c.logger.Error(fmt.Sprintf(`cannot read collection: %s`, err))
+		return nil, fmt.Errorf("cannot read collection: %w", err)
+	}
+	links, err := c.store.SearchCollectionLinks(ctx, id)
+	if err != nil {
+		c.logger.Error(fmt.Sprintf(`cannot read links of collection %d: %s`, id, err))
+		return nil, fmt.Errorf("cannot read links of collection %d: %w", id, err)
+	}
+	collection.Links = links
+	return collection, nil
+}
+
+func (c Collections) Search(ctx context.Context, ownerID int) ([]*models.Collection, error) {
+	collections, err := c.store.SearchCollections(ctx, ownerID)
+	if err != nil {
+		c.logger.Error(fmt.Sprintf(`cannot search collections: %s`, err))
+		return nil, fmt.Errorf("cannot search collections: %w", err)
+	}
+	return collections, nil
+}
+
+func (c Collections) Update(ctx context.Context, collection *models.Collection) (*models.Collection, error) {
+	collection.Name = strings.TrimSpace(collection.Name)
+	if collection.Name == "" {
+		return nil, fmt.Errorf("cannot update collection: %w: empty name", ErrBadCollection)
+	}
+	if err := c.store.UpdateCollection(ctx, collection); err != nil {
+		c.logger.Error(fmt.Sprintf(`cannot update collection: %s`, err))
+		return nil, fmt.Errorf("cannot update collection: %w", err)
+	}
+	return c.store.ReadCollection(ctx, collection.ID, collection.OwnerID)
+}
+
+func (c Collections) Delete(ctx context.Context, id, ownerID int) (*models.Collection, error) {
+	collection, err := c.store.ReadCollection(ctx, id, ownerID)
+	if err != nil {
+		c.logger.Error(fmt.Sprintf(`search collection error: %s`, err))
+		return nil, fmt.Errorf("search collection error: %w", err)
+	}
+	return collection, c.store.DeleteCollection(ctx, id, ownerID)
+}
+
+func (c Collections) AddLink(ctx context.Context, id, linkID, ownerID int) (*models.Collection, error) {
+	if err := c.store.AddCollectionLink(ctx, id, linkID, ownerID); err != nil {
+		c.logger.Error(fmt.Sprintf(`cannot add link %d to collection %d: %s`, linkID, id, err))
+		return nil, fmt.Errorf("cannot add link %d to collection %d: %w", linkID, id, err)
+	}
+	return c.Read(ctx, id, ownerID)
+}
+
+func (c Collections) RemoveLink(ctx context.Context, id, linkID, ownerID int) (*models.Collection, error) {
+	if err := c.store.RemoveCollectionLink(ctx, id, linkID, ownerID); err != nil {
+		c.logger.Error(fmt.Sprintf(`cannot remove link %d from collection %d: %s`, linkID, id, err))
+		return nil, fmt.Errorf("cannot remove link %d from collection %d: %w", linkID, id, err)
+	}
+	return c.Read(ctx, id, ownerID)
+}
@@ -0,0 +1,95 @@
+package objrepo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/ptsypyshev/shortlink/internal/audit"
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+type LinkDedup interface {
+	CreateLinkDedup(ctx context.Context, link *models.Link, urlHash string) (int, bool, error)
+}
+
+// CreateDeduplicated creates the link or, if the owner already has an active link to the same destination
+// in the workspace, returns that link with reused set to true.
+func (l Links) CreateDeduplicated(ctx context.Context, link *models.Link) (_ *models.Link, reused bool, err error) {
+	// Protected links are never shared with other requests
+	if link.Password != nil && *link.Password != "" {
+		created, err := l.Create(ctx, link)
+		return created, false, err
+	}
+	urlHash, err := URLHash(link.LongLink)
+	if err != nil {
+		return nil, false, fmt.Errorf("cannot create link: %w", err)
+	}
+	var id int
+	err = l.ngstore.InTx(ctx, func(ctx context.Context) error {
+		id, reused, err = l.ngstore.CreateLinkDedup(ctx, link, urlHash)
+		if err != nil {
+			l.logger.Error(fmt.Sprintf(`cannot create link: %s`, err))
+			return fmt.Errorf("cannot create link: %w", err)
+		}
+		if reused {
+			return nil
+		}
+		link.ID = id
+		return l.setSettings(ctx, link)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if reused {
+		existing, err := l.ReadWithTags(ctx, id)
+		return existing, true, err
+	}
+	l.audit.Record(ctx, audit.ActionCreate, models.LinkType, id, nil, link)
+	return link, false, nil
+}
+
+// URLHash returns the hex SHA-256 of the normalized URL.
+func URLHash(raw string) (string, error) {
+	normalized, err := NormalizeURL(raw)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// NormalizeURL brings equivalent URLs to one form: lower-case scheme and host without the default port,
+// "/" for an empty path, sorted query parameters and no fragment.
+func NormalizeURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("url %q is not absolute", raw)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	u.Host = host
+	if strings.Contains(host, ":") {
+		// IPv6 literal
+		u.Host = "[" + host + "]"
+	}
+	if port != "" {
+		u.Host += ":" + port
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.RawQuery = u.Query().Encode()
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String(), nil
+}
@@ -0,0 +1,33 @@
+package objrepo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+type LinkHealth interface {
+	SearchHealthCheckLinks(ctx context.Context, limit int) ([]*models.Link, error)
+	SetLinkHealth(ctx context.Context, linkID int, destination string, health *models.LinkHealth) error
+}
+
+// HealthCheckLinks returns up to limit active links whose destinations were checked longest ago.
+// Only the ID, destination and health of the links are filled.
+func (l Links) HealthCheckLinks(ctx context.Context, limit int) ([]*models.Link, error) {
+	links, err := l.ngstore.SearchHealthCheckLinks(ctx, limit)
+	if err != nil {
+		l.logger.Error(fmt.Sprintf(`cannot search links for health check: %s`, err))
+		return nil, fmt.Errorf("cannot search links for health check: %w", err)
+	}
+	return links, nil
+}
+
+// SetHealth stores the result of checking the destination of the link.
+func (l Links) SetHealth(ctx context.Context, linkID int, destination string, health *models.LinkHealth) error {
+	if err := l.ngstore.SetLinkHealth(ctx, linkID, destination, health); err != nil {
+		l.logger.Error(fmt.Sprintf(`cannot set health of link %d: %s`, linkID, err))
+		return fmt.Errorf("cannot set health of link %d: %w", linkID, err)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package objrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ptsypyshev/shortlink/internal/audit"
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+// maxUsernameSuffix limits attempts to find a free username for a provisioned user
+const maxUsernameSuffix = 100
+
+var (
+	ErrIdentityConflict = errors.New("the account cannot be linked: its email is not verified")
+	ErrBadRole          = errors.New("unknown role")
+)
+
+type UserIdentities interface {
+	FindUserByIdentity(ctx context.Context, issuer, subject string) (*models.User, error)
+	CreateUserWithIdentity(ctx context.Context, user *models.User, issuer, subject string) (int, error)
+	LinkUserIdentity(ctx context.Context, id int, issuer, subject string) error
+	SetUserRole(ctx context.Context, id int, role string) error
+	HasUserIdentity(ctx context.Context, id int) (bool, error)
+}
+
+// ExternalIdentity is a user authenticated by an external identity provider.
+type ExternalIdentity struct {
+	Issuer        string
+	Subject       string
+	Username      string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+	// Role is applied on every login, so the IdP stays the source of truth
+	Role string
+}
+
+// LoginExternal returns the user bound to the identity. An unknown identity is linked to the local account
+// with the same email if both sides have verified it, otherwise a new user is provisioned just in time.
+func (u Users) LoginExternal(ctx context.Context, identity ExternalIdentity) (*models.User, error) {
+	user, err := u.ngstore.FindUserByIdentity(ctx, identity.Issuer, identity.Subject)
+	if err != nil {
+		u.logger.Error(fmt.Sprintf(`cannot find user by identity %s: %s`, identity.Subject, err))
+		return nil, fmt.Errorf("cannot find user by identity: %w", err)
+	}
+	if user == nil {
+		if user, err = u.linkByEmail(ctx, identity); err != nil {
+			return nil, err
+		}
+	}
+	if user == nil {
+		if user, err = u.provision(ctx, identity); err != nil {
+			return nil, err
+		}
+	}
+	if identity.Role != "" && user.Role != identity.Role {
+		if err := u.ngstore.SetUserRole(ctx, user.ID, identity.Role); err != nil {
+			u.logger.Error(fmt.Sprintf(`cannot set role of user %d: %s`, user.ID, err))
+			return nil, fmt.Errorf("cannot set role of user %d: %w", user.ID, err)
+		}
+		user.Role = identity.Role
+	}
+	return user, nil
+}
+
+// updateRole checks the role given for the user. Roles of users signing in with the identity provider
+// are set by it on every login, so the stored role is kept for them.
+func (u Users) updateRole(ctx context.Context, user, updateUser *models.User) error {
+	if updateUser.Role == "" || updateUser.Role == user.Role {
+		updateUser.Role = user.Role
+		return nil
+	}
+	if updateUser.Role != models.RoleUser && updateUser.Role != models.RoleAdmin {
+		return fmt.Errorf("cannot update user %d: %w %q", user.ID, ErrBadRole, updateUser.Role)
+	}
+	external, err := u.ngstore.HasUserIdentity(ctx, user.ID)
+	if err != nil {
+		u.logger.Error(fmt.Sprintf(`cannot find identities of user %d: %s`, user.ID, err))
+		return fmt.Errorf("cannot find identities of user %d: %w", user.ID, err)
+	}
+	if external {
+		updateUser.Role = user.Role
+	}
+	return nil
+}
+
+func (u Users) linkByEmail(ctx context.Context, identity ExternalIdentity) (*models.User, error) {
+	if identity.Email == "" {
+		return nil, nil
+	}
+	users, err := u.ngstore.SearchUsers(ctx, "email", identity.Email)
+	if err != nil || len(users) == 0 {
+		return nil, nil
+	}
+	// An unverified email on either side could be used to take over the account
+	if !identity.EmailVerified || users[0].PendingVerification {
+		return nil, ErrIdentityConflict
+	}
+	user := users[0]
+	if err := u.ngstore.LinkUserIdentity(ctx, user.ID, identity.Issuer, identity.Subject); err != nil {
+		u.logger.Error(fmt.Sprintf(`cannot link identity to user %d: %s`, user.ID, err))
+		return nil, fmt.Errorf("cannot link identity to user %d: %w", user.ID, err)
+	}
+	u.logger.Info(fmt.Sprintf(`identity %s is linked to user %s`, identity.Subject, user.Username))
+	return user, nil
+}
+
+func (u Users) provision(ctx context.Context, identity ExternalIdentity) (*models.User, error) {
+	username, err := u.freeUsername(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+	role := identity.Role
+	if role == "" {
+		role = models.RoleUser
+	}
+	user := &models.User{
+		Username:   username,
+		FirstName:  identity.FirstName,
+		LastName:   identity.LastName,
+		UserStatus: true,
+		Role:       role,
+	}
+	if identity.EmailVerified {
+		user.Email = identity.Email
+	}
+	id, err := u.ngstore.CreateUserWithIdentity(ctx, user, identity.Issuer, identity.Subject)
+	if err != nil {
+		u.logger.Error(fmt.Sprintf(`cannot provision user %s: %s`, username, err))
+		return nil, fmt.Errorf("cannot provision user %s: %w", username, err)
+	}
+	user.ID = id
+	u.audit.Record(ctx, audit.ActionCreate, models.UserType, id, nil, user)
+	u.logger.Info(fmt.Sprintf(`user %s is provisioned for identity %s`, username, identity.Subject))
+	return user, nil
+}
+
+// freeUsername derives the username from the identity and adds a numeric suffix if it is taken.
+func (u Users) freeUsername(ctx context.Context, identity ExternalIdentity) (string, error) {
+	base := identity.Username
+	if base == "" {
+		base = strings.Split(identity.Email, "@")[0]
+	}
+	if base == "" {
+		base = "user"
+	}
+	if len(base) > 90 {
+		base = base[:90]
+	}
+	for i := 1; i <= maxUsernameSuffix; i++ {
+		username := base
+		if i > 1 {
+			username += strconv.Itoa(i)
+		}
+		users, err := u.ngstore.SearchUsers(ctx, "username", username)
+		if err != nil {
+			return "", fmt.Errorf("cannot check username %s: %w", username, err)
+		}
+		if len(users) == 0 {
+			return username, nil
+		}
+	}
+	return "", fmt.Errorf("cannot find a free username for %s", base)
+}
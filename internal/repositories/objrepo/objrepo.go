@@ -2,11 +2,15 @@ package objrepo
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
-	"github.com/speps/go-hashids/v2"
 	"go.uber.org/zap"
 
+	"github.com/ptsypyshev/shortlink/internal/audit"
+	"github.com/ptsypyshev/shortlink/internal/auth"
 	"github.com/ptsypyshev/shortlink/internal/models"
 )
 
@@ -44,17 +48,12 @@ type Delete[T Modelable] interface {
 	Delete(ctx context.Context, id int) error
 }
 
-type Check[T Modelable] interface {
-	Check(ctx context.Context, obj T) (T, bool)
-}
-
 type Storage[T Modelable] interface {
 	Create[T]
 	Read[T]
 	Search[T]
 	Update[T]
 	Delete[T]
-	Check[T]
 }
 
 type SearchUsers interface {
@@ -65,32 +64,112 @@ type SearchLinks interface {
 	SearchLinks(ctx context.Context, field any, value any) ([]*models.Link, error)
 }
 
+type LinkTags interface {
+	SetLinkTags(ctx context.Context, linkID, ownerID int, tags []string) error
+	GetLinkTags(ctx context.Context, linkID int) ([]string, error)
+	SearchLinksByFilter(ctx context.Context, workspaceID int, tag, text string) ([]*models.Link, error)
+}
+
+type ShortLinkDomains interface {
+	ResolveShortLink(ctx context.Context, domain, token string) (*models.ShortLink, error)
+}
+
+type ShortLinkTokens interface {
+	SearchLinkShortLinks(ctx context.Context, linkID int) ([]*models.ShortLink, error)
+	RetireShortLink(ctx context.Context, linkID, id int) error
+	CountShortLinkClick(ctx context.Context, id int) error
+}
+
+type LinkUTM interface {
+	SetLinkUTM(ctx context.Context, linkID int, utm *models.UTM) error
+	SetShortLinkUTM(ctx context.Context, linkID, id int, utm *models.UTM) error
+}
+
+type LinkMetadata interface {
+	SetLinkMetadata(ctx context.Context, linkID int, meta *models.LinkMetadata) error
+}
+
+type LinkClicks interface {
+	CountLinkClick(ctx context.Context, id int) error
+}
+
+type UserPasswords interface {
+	SetUserPassword(ctx context.Context, id int, hash string) error
+	VerifyUserEmail(ctx context.Context, id int, email string) error
+}
+
+type PasswordResets interface {
+	CreatePasswordReset(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error
+	FindPasswordReset(ctx context.Context, tokenHash string) (int, error)
+	ResetPassword(ctx context.Context, tokenHash string, userID int, passwordHash string) error
+	SessionsRevokedAt(ctx context.Context, username string) (time.Time, error)
+}
+
+// Transactor runs fn in one transaction of the storage, both storages use it with the context passed to fn.
+type Transactor interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
 type NonGenericStorage interface {
+	Transactor
 	SearchUsers
+	UserPasswords
+	PasswordResets
+	UserTOTP
+	UserIdentities
+	UserSessions
+	AuditStorage
+	Trash
+	LinkOwnership
 	SearchLinks
+	LinkTags
+	LinkMetadata
+	LinkClicks
+	LinkDedup
+	LinkUTM
+	LinkTargeting
+	LinkVariants
+	LinkProtection
+	LinkSchedule
+	LinkHealth
+	ShortLinkDomains
+	ShortLinkTokens
 }
 
 type Users struct {
 	store   Storage[*models.User]
 	ngstore NonGenericStorage
+	hasher  *auth.MultiHasher
+	policy  auth.PasswordPolicy
+	audit   Audit
 	logger  *zap.Logger
 }
 
-func UsersNew(s Storage[*models.User], ns NonGenericStorage, l *zap.Logger) *Users {
+func UsersNew(s Storage[*models.User], ns NonGenericStorage, h *auth.MultiHasher, p auth.PasswordPolicy, l *zap.Logger) *Users {
 	return &Users{
 		store:   s,
 		ngstore: ns,
+		hasher:  h,
+		policy:  p,
+		audit:   Audit{store: ns, logger: l},
 		logger:  l,
 	}
 }
 
 func (u Users) Create(ctx context.Context, user *models.User) (*models.User, error) {
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	if err := u.hashPassword(user); err != nil {
+		return nil, err
+	}
 	id, err := u.store.Create(ctx, user)
 	if err != nil {
 		u.logger.Error(fmt.Sprintf(`cannot read user: %s`, err))
 		return nil, fmt.Errorf("cannot create user: %w", err)
 	}
 	user.ID = id
+	u.audit.Record(ctx, audit.ActionCreate, models.UserType, id, nil, auditUser(user))
 	return user, nil
 }
 
@@ -118,56 +197,259 @@ func (u Users) Update(ctx context.Context, id int, updateUser *models.User) (*mo
 		u.logger.Error(fmt.Sprintf(`cannot find user with id %d: %s`, id, err))
 		return nil, fmt.Errorf("cannot find user with id %d: %w", id, err)
 	}
+	// 2FA can be turned on only by the user itself
+	updateUser.TOTPEnabled = user.TOTPEnabled
+	if err := u.updateRole(ctx, user, updateUser); err != nil {
+		return nil, err
+	}
+	// Users are moved to and from the trash only by Delete and Restore
+	updateUser.DeletedAt = nil
+	if updateUser.Password != "" {
+		if updateUser.Username == "" {
+			updateUser.Username = user.Username
+		}
+		if err := u.hashPassword(updateUser); err != nil {
+			return nil, err
+		}
+	}
 	err = u.store.Update(ctx, user, updateUser)
 	if err != nil {
 		u.logger.Error(fmt.Sprintf(`cannot update user: %s`, err))
 		return nil, fmt.Errorf("cannot update user: %w", err)
 	}
-	return u.store.Read(ctx, id, &models.User{})
-}
-
-func (u Users) Delete(ctx context.Context, id int) (*models.User, error) {
+	// The password hash is not a part of the JSON representation compared by Update
+	if updateUser.PasswordHash != "" {
+		if err := u.ngstore.SetUserPassword(ctx, id, updateUser.PasswordHash); err != nil {
+			u.logger.Error(fmt.Sprintf(`cannot set password of user %d: %s`, id, err))
+			return nil, fmt.Errorf("cannot set password of user %d: %w", id, err)
+		}
+	}
+	updatedUser, err := u.store.Read(ctx, id, &models.User{})
+	if err != nil {
+		return nil, err
+	}
+	u.audit.Record(ctx, audit.ActionUpdate, models.UserType, id, auditUser(user), auditUser(updatedUser))
+	return updatedUser, nil
+}
+
+// Delete moves the user to the trash, links of the user are transferred to the user newOwnerID,
+// deactivated or deleted depending on linksAction in the same transaction.
+func (u Users) Delete(ctx context.Context, id int, linksAction string, newOwnerID int) (*models.User, error) {
+	switch linksAction {
+	case models.LinksTransfer:
+		if newOwnerID == id {
+			return nil, ErrSameOwner
+		}
+	case models.LinksDeactivate, models.LinksDelete:
+	default:
+		return nil, ErrBadLinksAction
+	}
 	user, err := u.store.Read(ctx, id, &models.User{})
 	if err != nil {
 		u.logger.Error(fmt.Sprintf(`search user error: %s`, err))
 		return nil, fmt.Errorf("search user error: %w", err)
 	}
-	return user, u.store.Delete(ctx, id)
+	err = u.ngstore.OffboardUser(ctx, id, newOwnerID, linksAction, func(linkIDs []int) []*models.AuditEntry {
+		entries := linkOwnershipEntries(ctx, u.audit, linksAction, id, newOwnerID, linkIDs)
+		entry := u.audit.Entry(ctx, audit.ActionDelete, models.UserType, id, user, nil)
+		if entry.Changes == nil {
+			entry.Changes = make(map[string]models.AuditChange)
+		}
+		entry.Changes["links"] = models.AuditChange{New: linksAction}
+		return append(entries, entry)
+	})
+	if err != nil {
+		u.logger.Error(fmt.Sprintf(`cannot delete user %d: %s`, id, err))
+		return nil, fmt.Errorf("cannot delete user %d: %w", id, err)
+	}
+	if _, err := u.RevokeSessions(ctx, id, 0); err != nil {
+		return user, err
+	}
+	return user, nil
 }
 
+// VerifyEmail activates a self-registered user whose email is still the same as in the verification token.
+func (u Users) VerifyEmail(ctx context.Context, id int, email string) (*models.User, error) {
+	if err := u.ngstore.VerifyUserEmail(ctx, id, email); err != nil {
+		u.logger.Error(fmt.Sprintf(`cannot verify email of user %d: %s`, id, err))
+		return nil, fmt.Errorf("cannot verify email of user %d: %w", id, err)
+	}
+	return u.Read(ctx, id)
+}
+
+// RequestPasswordReset stores a hash of a new single-use reset token and returns the token itself.
+func (u Users) RequestPasswordReset(ctx context.Context, user *models.User, ttl time.Duration) (string, error) {
+	token, hash, err := auth.NewRandomToken()
+	if err != nil {
+		return "", fmt.Errorf("cannot generate reset token: %w", err)
+	}
+	if err := u.ngstore.CreatePasswordReset(ctx, user.ID, hash, time.Now().Add(ttl)); err != nil {
+		u.logger.Error(fmt.Sprintf(`cannot create password reset for user %d: %s`, user.ID, err))
+		return "", fmt.Errorf("cannot create password reset for user %d: %w", user.ID, err)
+	}
+	return token, nil
+}
+
+// PasswordResetUser returns the owner of a valid (unused and unexpired) reset token.
+func (u Users) PasswordResetUser(ctx context.Context, token string) (*models.User, error) {
+	userID, err := u.ngstore.FindPasswordReset(ctx, auth.HashToken(token))
+	if err != nil {
+		return nil, fmt.Errorf("cannot find password reset: %w", err)
+	}
+	return u.Read(ctx, userID)
+}
+
+// ResetPassword sets a new password by the reset token and revokes all sessions of the user.
+func (u Users) ResetPassword(ctx context.Context, token, password string) (*models.User, error) {
+	user, err := u.PasswordResetUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = password
+	if err := u.hashPassword(user); err != nil {
+		return nil, err
+	}
+	if err := u.ngstore.ResetPassword(ctx, auth.HashToken(token), user.ID, user.PasswordHash); err != nil {
+		u.logger.Error(fmt.Sprintf(`cannot reset password of user %d: %s`, user.ID, err))
+		return nil, fmt.Errorf("cannot reset password of user %d: %w", user.ID, err)
+	}
+	return user, nil
+}
+
+func (u Users) SessionsRevokedAt(ctx context.Context, username string) (time.Time, error) {
+	return u.ngstore.SessionsRevokedAt(ctx, username)
+}
+
+// Check verifies the user's password. Hashes made by an outdated algorithm
+// (e.g. pgcrypto's crypt in the SQL init scripts) are replaced on success.
 func (u Users) Check(ctx context.Context, checkUser *models.User) (*models.User, bool) {
-	user, ok := u.store.Check(ctx, checkUser)
-	if !ok {
+	users, err := u.ngstore.SearchUsers(ctx, "username", checkUser.Username)
+	if err != nil || len(users) != 1 {
+		// Spend the same time as for an existing user to not reveal usernames
+		u.hasher.VerifyDummy(checkUser.Password)
+		u.logger.Error(fmt.Sprintf(`check failed for user: %s`, checkUser.Username))
+		return nil, false
+	}
+	user := users[0]
+	if user.PasswordHash == "" {
+		// Users provisioned by single sign-on have no local password
+		u.hasher.VerifyDummy(checkUser.Password)
+		u.logger.Error(fmt.Sprintf(`check failed for user without password: %s`, checkUser.Username))
+		return nil, false
+	}
+	ok, rehash, err := u.hasher.Verify(user.PasswordHash, checkUser.Password)
+	if err != nil || !ok {
 		u.logger.Error(fmt.Sprintf(`check failed for user: %s`, checkUser.Username))
 		return nil, false
 	}
+	if rehash {
+		if hash, err := u.hasher.Hash(checkUser.Password); err != nil {
+			u.logger.Error(fmt.Sprintf(`cannot rehash password of user %s: %s`, user.Username, err))
+		} else if err := u.ngstore.SetUserPassword(ctx, user.ID, hash); err != nil {
+			u.logger.Error(fmt.Sprintf(`cannot rehash password of user %s: %s`, user.Username, err))
+		} else {
+			user.PasswordHash = hash
+		}
+	}
 	return user, true
 }
 
+func (u Users) hashPassword(user *models.User) error {
+	if err := u.policy.Validate(user.Username, user.Password); err != nil {
+		return err
+	}
+	hash, err := u.hasher.Hash(user.Password)
+	if err != nil {
+		u.logger.Error(fmt.Sprintf(`cannot hash password: %s`, err))
+		return fmt.Errorf("cannot hash password: %w", err)
+	}
+	user.Password, user.PasswordHash = "", hash
+	return nil
+}
+
+// auditUser shows the password hash to the audit diff, which records it only as changed.
+func auditUser(user *models.User) any {
+	return struct {
+		*models.User
+		Password string `json:"password,omitempty"`
+	}{user, user.PasswordHash}
+}
+
 type Links struct {
 	store   Storage[*models.Link]
 	ngstore NonGenericStorage
+	hasher  auth.PasswordHasher
+	audit   Audit
 	logger  *zap.Logger
 }
 
-func LinksNew(s Storage[*models.Link], ns NonGenericStorage, l *zap.Logger) *Links {
+func LinksNew(s Storage[*models.Link], ns NonGenericStorage, h auth.PasswordHasher, l *zap.Logger) *Links {
 	return &Links{
 		store:   s,
 		ngstore: ns,
+		hasher:  h,
+		audit:   Audit{store: ns, logger: l},
 		logger:  l,
 	}
 }
 
 func (l Links) Create(ctx context.Context, link *models.Link) (*models.Link, error) {
-	id, err := l.store.Create(ctx, link)
+	// The passphrase is stored with the link, so it is never reachable without it
+	if link.Password != nil {
+		hash, err := l.hashLinkPassword(*link.Password)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create link: %w", err)
+		}
+		link.PasswordHash, link.Protected, link.Password = hash, hash != "", nil
+	}
+	// A link is never left without its settings if one of them cannot be stored
+	err := l.ngstore.InTx(ctx, func(ctx context.Context) error {
+		id, err := l.store.Create(ctx, link)
+		if err != nil {
+			l.logger.Error(fmt.Sprintf(`cannot create link: %s`, err))
+			return fmt.Errorf("cannot create link: %w", err)
+		}
+		link.ID = id
+		return l.setSettings(ctx, link)
+	})
 	if err != nil {
-		l.logger.Error(fmt.Sprintf(`cannot create link: %s`, err))
-		return nil, fmt.Errorf("cannot create link: %w", err)
+		return nil, err
 	}
-	link.ID = id
+	l.audit.Record(ctx, audit.ActionCreate, models.LinkType, link.ID, nil, link)
 	return link, nil
 }
 
+// setSettings stores tags, UTM parameters, targeting rules, variants and the schedule of the new link.
+func (l Links) setSettings(ctx context.Context, link *models.Link) error {
+	if link.Tags != nil {
+		if err := l.SetTags(ctx, link); err != nil {
+			return err
+		}
+	}
+	if err := l.SetUTM(ctx, link.ID, link.UTM); err != nil {
+		return err
+	}
+	if err := l.SetTargeting(ctx, link.ID, link.Targeting); err != nil {
+		return err
+	}
+	if err := l.SetVariants(ctx, link.ID, link.Variants); err != nil {
+		return err
+	}
+	return l.SetSchedule(ctx, link.ID, link.Schedule)
+}
+
+// SetUTM stores campaign parameters of the link, nil keeps them unchanged and empty parameters remove them.
+func (l Links) SetUTM(ctx context.Context, linkID int, utm *models.UTM) error {
+	if utm == nil {
+		return nil
+	}
+	if err := l.ngstore.SetLinkUTM(ctx, linkID, utm); err != nil {
+		l.logger.Error(fmt.Sprintf(`cannot set utm of link %d: %s`, linkID, err))
+		return fmt.Errorf("cannot set utm of link %d: %w", linkID, err)
+	}
+	return nil
+}
+
 func (l Links) Read(ctx context.Context, id int) (*models.Link, error) {
 	link, err := l.store.Read(ctx, id, &models.Link{})
 	if err != nil {
@@ -177,6 +459,58 @@ func (l Links) Read(ctx context.Context, id int) (*models.Link, error) {
 	return link, nil
 }
 
+func (l Links) ReadWithTags(ctx context.Context, id int) (*models.Link, error) {
+	link, err := l.Read(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := l.ngstore.GetLinkTags(ctx, id)
+	if err != nil {
+		l.logger.Error(fmt.Sprintf(`cannot read tags of link %d: %s`, id, err))
+		return nil, fmt.Errorf("cannot read tags of link %d: %w", id, err)
+	}
+	link.Tags = tags
+	return link, nil
+}
+
+func (l Links) SetTags(ctx context.Context, link *models.Link) error {
+	tags := NormalizeTags(link.Tags)
+	if err := l.ngstore.SetLinkTags(ctx, link.ID, link.OwnerID, tags); err != nil {
+		l.logger.Error(fmt.Sprintf(`cannot set tags of link %d: %s`, link.ID, err))
+		return fmt.Errorf("cannot set tags of link %d: %w", link.ID, err)
+	}
+	link.Tags = tags
+	return nil
+}
+
+// SearchByFilter returns workspace links with the tag (if any) containing the text (if any)
+// in the destination URL, title or description.
+func (l Links) SearchByFilter(ctx context.Context, workspaceID int, tag, text string) ([]*models.Link, error) {
+	links, err := l.ngstore.SearchLinksByFilter(ctx, workspaceID, NormalizeTag(tag), strings.TrimSpace(text))
+	if err != nil {
+		l.logger.Error(fmt.Sprintf(`cannot search links by filter: %s`, err))
+		return nil, fmt.Errorf("cannot search links by filter: %w", err)
+	}
+	return links, nil
+}
+
+func (l Links) SetMetadata(ctx context.Context, linkID int, meta *models.LinkMetadata) error {
+	if err := l.ngstore.SetLinkMetadata(ctx, linkID, meta); err != nil {
+		l.logger.Error(fmt.Sprintf(`cannot set metadata of link %d: %s`, linkID, err))
+		return fmt.Errorf("cannot set metadata of link %d: %w", linkID, err)
+	}
+	return nil
+}
+
+// IncrementClicks counts a redirect by the link in the database, so concurrent clicks and edits are not lost.
+func (l Links) IncrementClicks(ctx context.Context, id int) error {
+	if err := l.ngstore.CountLinkClick(ctx, id); err != nil {
+		l.logger.Error(fmt.Sprintf(`cannot count click of link %d: %s`, id, err))
+		return fmt.Errorf("cannot count click of link %d: %w", id, err)
+	}
+	return nil
+}
+
 func (l Links) Search(ctx context.Context, field any, value any) ([]*models.Link, error) {
 	links, err := l.ngstore.SearchLinks(ctx, field, value)
 	if err != nil {
@@ -192,12 +526,49 @@ func (l Links) Update(ctx context.Context, id int, updateLink *models.Link) (*mo
 		l.logger.Error(fmt.Sprintf(`cannot find link with id %d: %s`, id, err))
 		return nil, fmt.Errorf("cannot find link with id %d: %w", id, err)
 	}
-	err = l.store.Update(ctx, link, updateLink)
+	// Links are moved to and from the trash only by Delete and Restore and stay in their workspace
+	updateLink.DeletedAt = nil
+	updateLink.WorkspaceID = link.WorkspaceID
+	updateLink.Domain = link.Domain
+	// The passphrase is changed only by SetPassword
+	password := updateLink.Password
+	updateLink.Password = nil
+	updateLink.Protected = link.Protected
+	var updatedLink *models.Link
+	err = l.ngstore.InTx(ctx, func(ctx context.Context) error {
+		if err := l.store.Update(ctx, link, updateLink); err != nil {
+			l.logger.Error(fmt.Sprintf(`cannot update link: %s`, err))
+			return fmt.Errorf("cannot update link: %w", err)
+		}
+		if err := l.SetUTM(ctx, id, updateLink.UTM); err != nil {
+			return err
+		}
+		if err := l.SetTargeting(ctx, id, updateLink.Targeting); err != nil {
+			return err
+		}
+		if err := l.SetVariants(ctx, id, updateLink.Variants); err != nil {
+			return err
+		}
+		if err := l.SetPassword(ctx, id, password); err != nil {
+			return err
+		}
+		if err := l.SetSchedule(ctx, id, updateLink.Schedule); err != nil {
+			return err
+		}
+		if updatedLink, err = l.store.Read(ctx, id, &models.Link{}); err != nil {
+			return err
+		}
+		if updateLink.Tags != nil {
+			updatedLink.Tags = updateLink.Tags
+			return l.SetTags(ctx, updatedLink)
+		}
+		return nil
+	})
 	if err != nil {
-		l.logger.Error(fmt.Sprintf(`cannot update link: %s`, err))
-		return nil, fmt.Errorf("cannot update link: %w", err)
+		return nil, err
 	}
-	return l.store.Read(ctx, id, &models.Link{})
+	l.audit.Record(ctx, audit.ActionUpdate, models.LinkType, id, link, updatedLink)
+	return updatedLink, nil
 }
 
 func (l Links) Delete(ctx context.Context, id int) (*models.Link, error) {
@@ -206,36 +577,65 @@ func (l Links) Delete(ctx context.Context, id int) (*models.Link, error) {
 		l.logger.Error(fmt.Sprintf(`search link error: %s`, err))
 		return nil, fmt.Errorf("search link error: %w", err)
 	}
-	return link, l.store.Delete(ctx, id)
+	if err := l.store.Delete(ctx, id); err != nil {
+		return link, err
+	}
+	l.audit.Record(ctx, audit.ActionDelete, models.LinkType, id, link, nil)
+	return link, nil
 }
 
 type ShortLinks struct {
-	store  Storage[*models.ShortLink]
-	logger *zap.Logger
+	store      Storage[*models.ShortLink]
+	ngstore    NonGenericStorage
+	generators TokenGenerators
+	audit      Audit
+	logger     *zap.Logger
 }
 
-func ShortLinksNew(s Storage[*models.ShortLink], l *zap.Logger) *ShortLinks {
+func ShortLinksNew(s Storage[*models.ShortLink], ns NonGenericStorage, g TokenGenerators, l *zap.Logger) *ShortLinks {
 	return &ShortLinks{
-		store:  s,
-		logger: l,
+		store:      s,
+		ngstore:    ns,
+		generators: g,
+		audit:      Audit{store: ns, logger: l},
+		logger:     l,
 	}
 }
 
-func (s ShortLinks) Create(ctx context.Context, longLinkID int) (*models.ShortLink, error) {
-	token, err := GenerateShortLinkToken(longLinkID)
-	if err != nil {
-		return nil, err
-	}
+// Create makes a shortlink for the link on the short domain, empty domain is the default one.
+// The token is generated again if it is already taken on the domain.
+func (s ShortLinks) Create(ctx context.Context, longLinkID int, domain, label string) (*models.ShortLink, error) {
+	generator := s.generators.For(domain)
 	shortlink := &models.ShortLink{
-		Token:      token,
 		LongLinkID: longLinkID,
+		Domain:     domain,
+		Label:      strings.TrimSpace(label),
 	}
-	id, err := s.store.Create(ctx, shortlink)
+	var (
+		id  int
+		err error
+	)
+	// Hashids tokens of additional tokens of the link differ by the attempt
+	tokens, err := s.ngstore.SearchLinkShortLinks(ctx, longLinkID)
 	if err != nil {
-		s.logger.Error(fmt.Sprintf(`cannot read shortlink: %s`, err))
+		return nil, fmt.Errorf("cannot create shortlink: %w", err)
+	}
+	for attempt := len(tokens); attempt < len(tokens)+MaxTokenAttempts; attempt++ {
+		shortlink.Token, err = generator.Generate(longLinkID, attempt)
+		if err != nil {
+			return nil, fmt.Errorf("cannot generate token: %w", err)
+		}
+		id, err = s.store.Create(ctx, shortlink)
+		if !errors.Is(err, ErrDuplicate) {
+			break
+		}
+	}
+	if err != nil {
+		s.logger.Error(fmt.Sprintf(`cannot create shortlink: %s`, err))
 		return nil, fmt.Errorf("cannot create shortlink: %w", err)
 	}
 	shortlink.ID = id
+	s.audit.Record(ctx, audit.ActionCreate, models.ShortLinkType, id, nil, shortlink)
 	return shortlink, nil
 }
 
@@ -257,6 +657,67 @@ func (s ShortLinks) Search(ctx context.Context, field any, value any) ([]*models
 	return shortLinks, nil
 }
 
+// Tokens returns tokens of the link, active tokens go first.
+func (s ShortLinks) Tokens(ctx context.Context, linkID int) ([]*models.ShortLink, error) {
+	tokens, err := s.ngstore.SearchLinkShortLinks(ctx, linkID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf(`cannot search tokens of link %d: %s`, linkID, err))
+		return nil, fmt.Errorf("cannot search tokens of link %d: %w", linkID, err)
+	}
+	return tokens, nil
+}
+
+// Retire stops redirects by the token, the token stays reserved and the link keeps its other tokens.
+func (s ShortLinks) Retire(ctx context.Context, linkID, id int) (*models.ShortLink, error) {
+	if err := s.ngstore.RetireShortLink(ctx, linkID, id); err != nil {
+		s.logger.Error(fmt.Sprintf(`cannot retire token %d of link %d: %s`, id, linkID, err))
+		return nil, fmt.Errorf("cannot retire token %d of link %d: %w", id, linkID, err)
+	}
+	shortlink, err := s.store.Read(ctx, id, &models.ShortLink{})
+	if err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, audit.ActionUpdate, models.ShortLinkType, id,
+		map[string]any{"retired_at": nil}, map[string]any{"retired_at": shortlink.RetiredAt})
+	return shortlink, nil
+}
+
+// SetUTM stores campaign parameters of the token which override parameters of the link.
+func (s ShortLinks) SetUTM(ctx context.Context, linkID, id int, utm *models.UTM) (*models.ShortLink, error) {
+	shortlink, err := s.store.Read(ctx, id, &models.ShortLink{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot set utm of token %d: %w", id, err)
+	}
+	if err := s.ngstore.SetShortLinkUTM(ctx, linkID, id, utm); err != nil {
+		s.logger.Error(fmt.Sprintf(`cannot set utm of token %d: %s`, id, err))
+		return nil, fmt.Errorf("cannot set utm of token %d: %w", id, err)
+	}
+	updated, err := s.store.Read(ctx, id, &models.ShortLink{})
+	if err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, audit.ActionUpdate, models.ShortLinkType, id, shortlink, updated)
+	return updated, nil
+}
+
+// CountClick counts a redirect by the token, the link counts redirects by all its tokens.
+func (s ShortLinks) CountClick(ctx context.Context, id int) error {
+	if err := s.ngstore.CountShortLinkClick(ctx, id); err != nil {
+		s.logger.Error(fmt.Sprintf(`cannot count click of token %d: %s`, id, err))
+		return fmt.Errorf("cannot count click of token %d: %w", id, err)
+	}
+	return nil
+}
+
+// Resolve finds the shortlink by the token on the short domain.
+func (s ShortLinks) Resolve(ctx context.Context, domain, token string) (*models.ShortLink, error) {
+	shortlink, err := s.ngstore.ResolveShortLink(ctx, domain, token)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve shortlink %s on domain %q: %w", token, domain, err)
+	}
+	return shortlink, nil
+}
+
 func (s ShortLinks) Update(ctx context.Context, id int, updateShortLink *models.ShortLink) (*models.ShortLink, error) {
 	shortlink, err := s.store.Read(ctx, id, &models.ShortLink{})
 	if err != nil {
@@ -268,7 +729,12 @@ func (s ShortLinks) Update(ctx context.Context, id int, updateShortLink *models.
 		s.logger.Error(fmt.Sprintf(`cannot update shortlink: %s`, err))
 		return nil, fmt.Errorf("cannot update shortlink: %w", err)
 	}
-	return s.store.Read(ctx, id, &models.ShortLink{})
+	updatedShortLink, err := s.store.Read(ctx, id, &models.ShortLink{})
+	if err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, audit.ActionUpdate, models.ShortLinkType, id, shortlink, updatedShortLink)
+	return updatedShortLink, nil
 }
 
 func (s ShortLinks) Delete(ctx context.Context, id int) (*models.ShortLink, error) {
@@ -277,17 +743,9 @@ func (s ShortLinks) Delete(ctx context.Context, id int) (*models.ShortLink, erro
 		s.logger.Error(fmt.Sprintf(`search shortlink error: %s`, err))
 		return nil, fmt.Errorf("search shortlink error: %w", err)
 	}
-	return shortlink, s.store.Delete(ctx, id)
-}
-
-func GenerateShortLinkToken(id int) (string, error) {
-	hd := hashids.NewData()
-	hd.Alphabet = HashSmallAlphabet
-	hd.Salt = HashSalt
-	hd.MinLength = HashMinLength
-	h, err := hashids.NewWithData(hd)
-	if err != nil {
-		return "", err
+	if err := s.store.Delete(ctx, id); err != nil {
+		return shortlink, err
 	}
-	return h.Encode([]int{id})
+	s.audit.Record(ctx, audit.ActionDelete, models.ShortLinkType, id, shortlink, nil)
+	return shortlink, nil
 }
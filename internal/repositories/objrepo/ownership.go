@@ -0,0 +1,64 @@
+package objrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ptsypyshev/shortlink/internal/audit"
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+var (
+	ErrLinksNotOwned    = errors.New("some links do not belong to the user")
+	ErrNewOwnerNotFound = errors.New("new owner is not found")
+	ErrSameOwner        = errors.New("links cannot be transferred to the same user")
+	ErrBadLinksAction   = errors.New("links of the user must be transferred, deactivated or deleted")
+)
+
+type LinkOwnership interface {
+	TransferLinks(ctx context.Context, fromID, toID int, linkIDs []int,
+		record func(linkIDs []int) []*models.AuditEntry) ([]int, error)
+	OffboardUser(ctx context.Context, id, toID int, linksAction string,
+		record func(linkIDs []int) []*models.AuditEntry) error
+}
+
+// Transfer moves links with linkIDs (all links including the trash if linkIDs is empty) from one user to another,
+// either all of them are moved or none.
+func (l Links) Transfer(ctx context.Context, fromID, toID int, linkIDs []int) (int, error) {
+	if fromID == toID {
+		return 0, ErrSameOwner
+	}
+	if len(linkIDs) == 0 {
+		linkIDs = nil
+	}
+	transferred, err := l.ngstore.TransferLinks(ctx, fromID, toID, linkIDs, func(ids []int) []*models.AuditEntry {
+		return linkOwnershipEntries(ctx, l.audit, models.LinksTransfer, fromID, toID, ids)
+	})
+	if err != nil {
+		l.logger.Error(fmt.Sprintf(`cannot transfer links from user %d to user %d: %s`, fromID, toID, err))
+		return 0, fmt.Errorf("cannot transfer links from user %d to user %d: %w", fromID, toID, err)
+	}
+	return len(transferred), nil
+}
+
+// linkOwnershipEntries builds audit entries for links affected by linksAction on links of the user ownerID.
+func linkOwnershipEntries(ctx context.Context, a Audit, linksAction string, ownerID, newOwnerID int,
+	linkIDs []int) []*models.AuditEntry {
+	entries := make([]*models.AuditEntry, 0, len(linkIDs)+1)
+	for _, id := range linkIDs {
+		var entry *models.AuditEntry
+		switch linksAction {
+		case models.LinksTransfer:
+			entry = a.Entry(ctx, audit.ActionUpdate, models.LinkType, id,
+				map[string]int{"owner_id": ownerID}, map[string]int{"owner_id": newOwnerID})
+		case models.LinksDeactivate:
+			entry = a.Entry(ctx, audit.ActionUpdate, models.LinkType, id,
+				map[string]bool{"is_active": true}, map[string]bool{"is_active": false})
+		default:
+			entry = a.Entry(ctx, audit.ActionDelete, models.LinkType, id, nil, nil)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
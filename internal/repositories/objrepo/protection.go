@@ -0,0 +1,78 @@
+package objrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// MaxLinkPasswordLength limits passphrases of links, they are hashed on every unlock attempt
+const MaxLinkPasswordLength = 128
+
+var ErrBadLinkPassword = errors.New("link password is too long")
+
+type LinkProtection interface {
+	SetLinkPasswordHash(ctx context.Context, linkID int, hash string) error
+	GetLinkPasswordHash(ctx context.Context, linkID int) (string, error)
+}
+
+// ValidateLinkPassword checks the passphrase given for a link, nil and empty passphrases are valid.
+func ValidateLinkPassword(password *string) error {
+	if password != nil && len(*password) > MaxLinkPasswordLength {
+		return ErrBadLinkPassword
+	}
+	return nil
+}
+
+// SetPassword protects the link with the passphrase, nil keeps the passphrase and empty one makes the link public.
+func (l Links) SetPassword(ctx context.Context, linkID int, password *string) error {
+	if password == nil {
+		return nil
+	}
+	hash, err := l.hashLinkPassword(*password)
+	if err != nil {
+		return err
+	}
+	if err := l.ngstore.SetLinkPasswordHash(ctx, linkID, hash); err != nil {
+		l.logger.Error(fmt.Sprintf(`cannot set password of link %d: %s`, linkID, err))
+		return fmt.Errorf("cannot set password of link %d: %w", linkID, err)
+	}
+	return nil
+}
+
+// PasswordHash returns the passphrase hash of the link, empty for public links.
+func (l Links) PasswordHash(ctx context.Context, linkID int) (string, error) {
+	hash, err := l.ngstore.GetLinkPasswordHash(ctx, linkID)
+	if err != nil {
+		l.logger.Error(fmt.Sprintf(`cannot read password of link %d: %s`, linkID, err))
+		return "", fmt.Errorf("cannot read password of link %d: %w", linkID, err)
+	}
+	return hash, nil
+}
+
+// VerifyPassword reports whether the passphrase matches the hash of the link.
+func (l Links) VerifyPassword(hash, password string) bool {
+	if hash == "" || len(password) > MaxLinkPasswordLength {
+		return false
+	}
+	ok, _, err := l.hasher.Verify(hash, password)
+	if err != nil {
+		l.logger.Error(fmt.Sprintf(`cannot verify link password: %s`, err))
+	}
+	return ok
+}
+
+func (l Links) hashLinkPassword(password string) (string, error) {
+	if err := ValidateLinkPassword(&password); err != nil {
+		return "", err
+	}
+	if password == "" {
+		return "", nil
+	}
+	hash, err := l.hasher.Hash(password)
+	if err != nil {
+		l.logger.Error(fmt.Sprintf(`cannot hash link password: %s`, err))
+		return "", fmt.Errorf("cannot hash link password: %w", err)
+	}
+	return hash, nil
+}
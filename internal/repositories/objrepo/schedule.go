@@ -0,0 +1,91 @@
+package objrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+// MaxScheduledChanges limits scheduled destination changes of a link
+const MaxScheduledChanges = 50
+
+var ErrBadSchedule = errors.New("bad schedule")
+
+type LinkSchedule interface {
+	SetLinkSchedule(ctx context.Context, linkID int, schedule *models.Schedule) error
+}
+
+// SetSchedule stores the schedule of the link normalized by NormalizeSchedule,
+// nil keeps it unchanged and an empty schedule removes it.
+func (l Links) SetSchedule(ctx context.Context, linkID int, schedule *models.Schedule) error {
+	if schedule == nil {
+		return nil
+	}
+	// Times without a zone offset would be read in a wrong timezone
+	times := []string{schedule.ActivateAt}
+	for _, change := range schedule.Changes {
+		times = append(times, change.At)
+	}
+	for _, t := range times {
+		if _, err := time.Parse(time.RFC3339, t); t != "" && err != nil {
+			return fmt.Errorf("cannot set schedule of link %d: %w: %s is not normalized", linkID, ErrBadSchedule, t)
+		}
+	}
+	if err := l.ngstore.SetLinkSchedule(ctx, linkID, schedule); err != nil {
+		l.logger.Error(fmt.Sprintf(`cannot set schedule of link %d: %s`, linkID, err))
+		return fmt.Errorf("cannot set schedule of link %d: %w", linkID, err)
+	}
+	return nil
+}
+
+// NormalizeSchedule parses times of the schedule (without a zone offset they are in loc), brings them to RFC 3339
+// in loc and orders changes by time. Nil schedule stays nil.
+func NormalizeSchedule(schedule *models.Schedule, loc *time.Location) (*models.Schedule, error) {
+	if schedule == nil {
+		return nil, nil
+	}
+	if len(schedule.Changes) > MaxScheduledChanges {
+		return nil, fmt.Errorf("%w: no more than %d changes are allowed", ErrBadSchedule, MaxScheduledChanges)
+	}
+	normalized := &models.Schedule{Changes: make([]models.ScheduledChange, 0, len(schedule.Changes))}
+	if activateAt := strings.TrimSpace(schedule.ActivateAt); activateAt != "" {
+		t, err := models.ParseScheduleTime(activateAt, loc)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad activation time %q", ErrBadSchedule, activateAt)
+		}
+		normalized.ActivateAt = t.In(loc).Format(time.RFC3339)
+	}
+	changeTimes := make(map[int64]bool, len(schedule.Changes))
+	for _, change := range schedule.Changes {
+		at := strings.TrimSpace(change.At)
+		t, err := models.ParseScheduleTime(at, loc)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad change time %q", ErrBadSchedule, at)
+		}
+		if changeTimes[t.Unix()] {
+			return nil, fmt.Errorf("%w: several changes at %s", ErrBadSchedule, at)
+		}
+		changeTimes[t.Unix()] = true
+		destination := strings.TrimSpace(change.Destination)
+		if dest, err := url.Parse(destination); err != nil || dest.Host == "" ||
+			(dest.Scheme != "http" && dest.Scheme != "https") {
+			return nil, fmt.Errorf("%w: destination of the change at %s must be an http(s) URL", ErrBadSchedule, at)
+		}
+		normalized.Changes = append(normalized.Changes, models.ScheduledChange{
+			At:          t.In(loc).Format(time.RFC3339),
+			Destination: destination,
+		})
+	}
+	sort.Slice(normalized.Changes, func(i, j int) bool {
+		ti, _ := time.Parse(time.RFC3339, normalized.Changes[i].At)
+		tj, _ := time.Parse(time.RFC3339, normalized.Changes[j].At)
+		return ti.Before(tj)
+	})
+	return normalized, nil
+}
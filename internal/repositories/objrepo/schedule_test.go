@@ -0,0 +1,62 @@
+package objrepo
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+func TestNormalizeSchedule(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	tests := []struct {
+		name     string
+		schedule *models.Schedule
+		want     *models.Schedule
+		ok       bool
+	}{
+		{"unchanged", nil, nil, true},
+		{"removed", &models.Schedule{}, &models.Schedule{Changes: []models.ScheduledChange{}}, true},
+		{"times are in the location and changes are ordered", &models.Schedule{
+			ActivateAt: " 2024-05-01 10:00 ",
+			Changes: []models.ScheduledChange{
+				{At: "2024-06-01T00:00:00Z", Destination: " https://example.com/june "},
+				{At: "2024-05-15", Destination: "http://example.com/may"},
+			},
+		}, &models.Schedule{
+			ActivateAt: "2024-05-01T10:00:00+03:00",
+			Changes: []models.ScheduledChange{
+				{At: "2024-05-15T00:00:00+03:00", Destination: "http://example.com/may"},
+				{At: "2024-06-01T03:00:00+03:00", Destination: "https://example.com/june"},
+			},
+		}, true},
+		{"bad activation time", &models.Schedule{ActivateAt: "tomorrow"}, nil, false},
+		{"bad change time", &models.Schedule{Changes: []models.ScheduledChange{
+			{At: "tomorrow", Destination: "https://example.com/"},
+		}}, nil, false},
+		{"several changes at once", &models.Schedule{Changes: []models.ScheduledChange{
+			{At: "2024-05-01T10:00:00+03:00", Destination: "https://example.com/a"},
+			{At: "2024-05-01T07:00:00Z", Destination: "https://example.com/b"},
+		}}, nil, false},
+		{"not http", &models.Schedule{Changes: []models.ScheduledChange{
+			{At: "2024-05-01", Destination: "ftp://example.com/"},
+		}}, nil, false},
+		{"too many changes", &models.Schedule{Changes: make([]models.ScheduledChange, MaxScheduledChanges+1)}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeSchedule(tt.schedule, loc)
+			if (err == nil) != tt.ok {
+				t.Fatalf("err = %v, want ok = %t", err, tt.ok)
+			}
+			if err != nil && !errors.Is(err, ErrBadSchedule) {
+				t.Errorf("err = %v does not wrap %v", err, ErrBadSchedule)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NormalizeSchedule = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package objrepo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+type UserSessions interface {
+	GetUserSessions(ctx context.Context, userID int) ([]*models.Session, error)
+	DeleteUserSession(ctx context.Context, userID, id int) error
+	DeleteUserSessions(ctx context.Context, userID, exceptID int) (int64, error)
+}
+
+func (u Users) Sessions(ctx context.Context, userID int) ([]*models.Session, error) {
+	sessions, err := u.ngstore.GetUserSessions(ctx, userID)
+	if err != nil {
+		u.logger.Error(fmt.Sprintf(`cannot get sessions of user %d: %s`, userID, err))
+		return nil, fmt.Errorf("cannot get sessions of user %d: %w", userID, err)
+	}
+	return sessions, nil
+}
+
+func (u Users) RevokeSession(ctx context.Context, userID, id int) error {
+	if err := u.ngstore.DeleteUserSession(ctx, userID, id); err != nil {
+		u.logger.Error(fmt.Sprintf(`cannot revoke session %d of user %d: %s`, id, userID, err))
+		return fmt.Errorf("cannot revoke session %d of user %d: %w", id, userID, err)
+	}
+	return nil
+}
+
+// RevokeSessions revokes all sessions of the user except the one with exceptID (0 revokes all).
+func (u Users) RevokeSessions(ctx context.Context, userID, exceptID int) (int64, error) {
+	count, err := u.ngstore.DeleteUserSessions(ctx, userID, exceptID)
+	if err != nil {
+		u.logger.Error(fmt.Sprintf(`cannot revoke sessions of user %d: %s`, userID, err))
+		return 0, fmt.Errorf("cannot revoke sessions of user %d: %w", userID, err)
+	}
+	return count, nil
+}
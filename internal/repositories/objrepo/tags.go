@@ -0,0 +1,109 @@
+package objrepo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const TagMaxLength = 50
+
+type TagStorage interface {
+	CreateTag(ctx context.Context, tag *models.Tag) (int, error)
+	ReadTag(ctx context.Context, id, ownerID int) (*models.Tag, error)
+	SearchTags(ctx context.Context, ownerID int) ([]*models.Tag, error)
+	UpdateTag(ctx context.Context, tag *models.Tag) error
+	DeleteTag(ctx context.Context, id, ownerID int) error
+}
+
+type Tags struct {
+	store  TagStorage
+	logger *zap.Logger
+}
+
+func TagsNew(s TagStorage, l *zap.Logger) *Tags {
+	return &Tags{
+		store:  s,
+		logger: l,
+	}
+}
+
+func (t Tags) Create(ctx context.Context, tag *models.Tag) (*models.Tag, error) {
+	tag.Name = NormalizeTag(tag.Name)
+	if tag.Name == "" {
+		return nil, fmt.Errorf("cannot create tag: empty name")
+	}
+	id, err := t.store.CreateTag(ctx, tag)
+	if err != nil {
+		t.logger.Error(fmt.Sprintf(`cannot create tag: %s`, err))
+		return nil, fmt.Errorf("cannot create tag: %w", err)
+	}
+	tag.ID = id
+	return tag, nil
+}
+
+func (t Tags) Read(ctx context.Context, id, ownerID int) (*models.Tag, error) {
+	tag, err := t.store.ReadTag(ctx, id, ownerID)
+	if err != nil {
+		t.logger.Error(fmt.Sprintf(`cannot read tag: %s`, err))
+		return nil, fmt.Errorf("cannot read tag: %w", err)
+	}
+	return tag, nil
+}
+
+func (t Tags) Search(ctx context.Context, ownerID int) ([]*models.Tag, error) {
+	tags, err := t.store.SearchTags(ctx, ownerID)
+	if err != nil {
+		t.logger.Error(fmt.Sprintf(`cannot search tags: %s`, err))
+		return nil, fmt.Errorf("cannot search tags: %w", err)
+	}
+	return tags, nil
+}
+
+func (t Tags) Update(ctx context.Context, tag *models.Tag) (*models.Tag, error) {
+	tag.Name = NormalizeTag(tag.Name)
+	if tag.Name == "" {
+		return nil, fmt.Errorf("cannot update tag: empty name")
+	}
+	if err := t.store.UpdateTag(ctx, tag); err != nil {
+		t.logger.Error(fmt.Sprintf(`cannot update tag: %s`, err))
+		return nil, fmt.Errorf("cannot update tag: %w", err)
+	}
+	return t.store.ReadTag(ctx, tag.ID, tag.OwnerID)
+}
+
+func (t Tags) Delete(ctx context.Context, id, ownerID int) (*models.Tag, error) {
+	tag, err := t.store.ReadTag(ctx, id, ownerID)
+	if err != nil {
+		t.logger.Error(fmt.Sprintf(`search tag error: %s`, err))
+		return nil, fmt.Errorf("search tag error: %w", err)
+	}
+	return tag, t.store.DeleteTag(ctx, id, ownerID)
+}
+
+// NormalizeTag makes tag names case-insensitive and trims them to TagMaxLength.
+func NormalizeTag(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if len([]rune(name)) > TagMaxLength {
+		name = string([]rune(name)[:TagMaxLength])
+	}
+	return name
+}
+
+func NormalizeTags(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	tags := make([]string, 0, len(names))
+	for _, name := range names {
+		name = NormalizeTag(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		tags = append(tags, name)
+	}
+	return tags
+}
@@ -0,0 +1,83 @@
+package objrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+// MaxTargetRules limits targeting rules of a link, they are evaluated on every click
+const MaxTargetRules = 50
+
+var ErrBadTargeting = errors.New("bad targeting rule")
+
+type LinkTargeting interface {
+	SetLinkTargeting(ctx context.Context, linkID int, rules []models.TargetRule) error
+}
+
+// SetTargeting stores targeting rules of the link, nil keeps them unchanged and empty rules remove them.
+func (l Links) SetTargeting(ctx context.Context, linkID int, rules []models.TargetRule) error {
+	if rules == nil {
+		return nil
+	}
+	rules, err := NormalizeTargeting(rules)
+	if err != nil {
+		return fmt.Errorf("cannot set targeting of link %d: %w", linkID, err)
+	}
+	if err := l.ngstore.SetLinkTargeting(ctx, linkID, rules); err != nil {
+		l.logger.Error(fmt.Sprintf(`cannot set targeting of link %d: %s`, linkID, err))
+		return fmt.Errorf("cannot set targeting of link %d: %w", linkID, err)
+	}
+	return nil
+}
+
+// NormalizeTargeting brings countries to upper case, languages and devices to lower case
+// and checks that every rule has a condition and an absolute http(s) destination. Nil rules stay nil.
+func NormalizeTargeting(rules []models.TargetRule) ([]models.TargetRule, error) {
+	if rules == nil {
+		return nil, nil
+	}
+	if len(rules) > MaxTargetRules {
+		return nil, fmt.Errorf("%w: no more than %d rules are allowed", ErrBadTargeting, MaxTargetRules)
+	}
+	normalized := make([]models.TargetRule, 0, len(rules))
+	for i, rule := range rules {
+		rule.Countries = normalizeValues(rule.Countries, strings.ToUpper)
+		rule.Languages = normalizeValues(rule.Languages, strings.ToLower)
+		rule.Devices = normalizeValues(rule.Devices, strings.ToLower)
+		rule.Destination = strings.TrimSpace(rule.Destination)
+		if len(rule.Countries) == 0 && len(rule.Languages) == 0 && len(rule.Devices) == 0 {
+			return nil, fmt.Errorf("%w %d: countries, languages or devices are required", ErrBadTargeting, i+1)
+		}
+		for _, country := range rule.Countries {
+			if len(country) != 2 {
+				return nil, fmt.Errorf("%w %d: country %q is not an ISO 3166 code", ErrBadTargeting, i+1, country)
+			}
+		}
+		for _, device := range rule.Devices {
+			if !models.ValidDevice(device) {
+				return nil, fmt.Errorf("%w %d: device must be ios, android or desktop", ErrBadTargeting, i+1)
+			}
+		}
+		if dest, err := url.Parse(rule.Destination); err != nil || dest.Host == "" ||
+			(dest.Scheme != "http" && dest.Scheme != "https") {
+			return nil, fmt.Errorf("%w %d: destination must be an http(s) URL", ErrBadTargeting, i+1)
+		}
+		normalized = append(normalized, rule)
+	}
+	return normalized, nil
+}
+
+func normalizeValues(values []string, convert func(string) string) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if value = convert(strings.TrimSpace(value)); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
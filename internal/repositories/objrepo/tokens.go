@@ -0,0 +1,153 @@
+package objrepo
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/speps/go-hashids/v2"
+)
+
+const (
+	TokenHashids = "hashids"
+	TokenRandom  = "random"
+	TokenWords   = "words"
+
+	DefaultTokenLength = 8
+	DefaultTokenWords  = 2
+	// MaxTokenAttempts limits retries of token generation after collisions with existing tokens
+	MaxTokenAttempts = 5
+
+	base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	// Words are made of consonant-vowel syllables, so they are easy to read out and type
+	wordConsonants = "bdfghjklmnprstvz"
+	wordVowels     = "aeiou"
+	wordSyllables  = 3
+)
+
+var (
+	ErrDuplicate = errors.New("already exists")
+	ErrLastToken = errors.New("the last active token of the link cannot be retired")
+)
+
+// TokenGenerator makes short tokens for links. The attempt differs for every token of the link
+// and grows if the generated token is already taken on the short domain.
+type TokenGenerator interface {
+	Generate(linkID, attempt int) (string, error)
+}
+
+// TokenOptions configures token generators created by NewTokenGenerator.
+type TokenOptions struct {
+	HashSalt string
+	Length   int
+	Words    int
+}
+
+// NewTokenGenerator returns the generator by its name: hashids, random or words.
+func NewTokenGenerator(name string, opts TokenOptions) (TokenGenerator, error) {
+	switch name {
+	case TokenHashids, "":
+		if opts.HashSalt == "" {
+			opts.HashSalt = HashSalt
+		}
+		return HashidsGenerator{Salt: opts.HashSalt}, nil
+	case TokenRandom:
+		if opts.Length <= 0 {
+			opts.Length = DefaultTokenLength
+		}
+		return RandomGenerator{Length: opts.Length}, nil
+	case TokenWords:
+		if opts.Words <= 0 {
+			opts.Words = DefaultTokenWords
+		}
+		return WordGenerator{Words: opts.Words}, nil
+	default:
+		return nil, fmt.Errorf("unknown token generator %q", name)
+	}
+}
+
+// TokenGenerators selects the token generator of a short domain, empty domain is the default one.
+type TokenGenerators struct {
+	Default  TokenGenerator
+	ByDomain map[string]TokenGenerator
+}
+
+func (t TokenGenerators) For(domain string) TokenGenerator {
+	if generator, ok := t.ByDomain[domain]; ok {
+		return generator
+	}
+	if t.Default == nil {
+		return HashidsGenerator{Salt: HashSalt}
+	}
+	return t.Default
+}
+
+// HashidsGenerator encodes the link ID, its tokens are short but reveal the order of links.
+type HashidsGenerator struct {
+	Salt string
+}
+
+func (g HashidsGenerator) Generate(linkID, attempt int) (string, error) {
+	hd := hashids.NewData()
+	hd.Alphabet = HashSmallAlphabet
+	hd.Salt = g.Salt
+	hd.MinLength = HashMinLength
+	h, err := hashids.NewWithData(hd)
+	if err != nil {
+		return "", err
+	}
+	numbers := []int{linkID}
+	if attempt > 0 {
+		numbers = append(numbers, attempt)
+	}
+	return h.Encode(numbers)
+}
+
+// RandomGenerator makes cryptographically random base62 tokens of the given length.
+type RandomGenerator struct {
+	Length int
+}
+
+func (g RandomGenerator) Generate(_, _ int) (string, error) {
+	return randomString(base62Alphabet, g.Length)
+}
+
+// WordGenerator makes pronounceable tokens of several generated words joined by dashes.
+type WordGenerator struct {
+	Words int
+}
+
+func (g WordGenerator) Generate(_, _ int) (string, error) {
+	words := make([]string, 0, g.Words)
+	for i := 0; i < g.Words; i++ {
+		var word strings.Builder
+		for j := 0; j < wordSyllables; j++ {
+			consonant, err := randomString(wordConsonants, 1)
+			if err != nil {
+				return "", err
+			}
+			vowel, err := randomString(wordVowels, 1)
+			if err != nil {
+				return "", err
+			}
+			word.WriteString(consonant + vowel)
+		}
+		words = append(words, word.String())
+	}
+	return strings.Join(words, "-"), nil
+}
+
+func randomString(alphabet string, length int) (string, error) {
+	max := big.NewInt(int64(len(alphabet)))
+	result := make([]byte, length)
+	for i := range result {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		result[i] = alphabet[n.Int64()]
+	}
+	return string(result), nil
+}
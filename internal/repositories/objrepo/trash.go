@@ -0,0 +1,105 @@
+package objrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ptsypyshev/shortlink/internal/audit"
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+var ErrNotInTrash = errors.New("not found in trash")
+
+type Trash interface {
+	SearchDeletedLinks(ctx context.Context, ownerID int) ([]*models.Link, error)
+	SearchDeletedUsers(ctx context.Context) ([]*models.User, error)
+	DeletedLinkWorkspace(ctx context.Context, id int) (int, error)
+	RestoreLink(ctx context.Context, id int) (int64, error)
+	RestoreUser(ctx context.Context, id int) (int64, error)
+	PurgeLinks(ctx context.Context, before time.Time) ([]int, error)
+	PurgeUsers(ctx context.Context, before time.Time) ([]int, error)
+}
+
+// Trash returns deleted links of the owner which are not purged yet.
+func (l Links) Trash(ctx context.Context, ownerID int) ([]*models.Link, error) {
+	links, err := l.ngstore.SearchDeletedLinks(ctx, ownerID)
+	if err != nil {
+		l.logger.Error(fmt.Sprintf(`cannot get trash of user %d: %s`, ownerID, err))
+		return nil, fmt.Errorf("cannot get trash of user %d: %w", ownerID, err)
+	}
+	return links, nil
+}
+
+// TrashWorkspace returns the workspace of the link in the trash.
+func (l Links) TrashWorkspace(ctx context.Context, id int) (int, error) {
+	workspaceID, err := l.ngstore.DeletedLinkWorkspace(ctx, id)
+	if err != nil {
+		l.logger.Error(fmt.Sprintf(`cannot get link %d from trash: %s`, id, err))
+		return 0, fmt.Errorf("cannot get link %d from trash: %w", id, err)
+	}
+	return workspaceID, nil
+}
+
+func (l Links) Restore(ctx context.Context, id int) (*models.Link, error) {
+	count, err := l.ngstore.RestoreLink(ctx, id)
+	if err != nil {
+		l.logger.Error(fmt.Sprintf(`cannot restore link %d: %s`, id, err))
+		return nil, fmt.Errorf("cannot restore link %d: %w", id, err)
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("cannot restore link %d: %w", id, ErrNotInTrash)
+	}
+	l.audit.Record(ctx, audit.ActionRestore, models.LinkType, id, nil, nil)
+	return l.ReadWithTags(ctx, id)
+}
+
+// Purge hard-deletes links which are in the trash since before, their tokens stay reserved.
+func (l Links) Purge(ctx context.Context, before time.Time) (int, error) {
+	ids, err := l.ngstore.PurgeLinks(ctx, before)
+	if err != nil {
+		l.logger.Error(fmt.Sprintf(`cannot purge links: %s`, err))
+		return 0, fmt.Errorf("cannot purge links: %w", err)
+	}
+	for _, id := range ids {
+		l.audit.Record(ctx, audit.ActionPurge, models.LinkType, id, nil, nil)
+	}
+	return len(ids), nil
+}
+
+// Trash returns deleted users which are not purged yet.
+func (u Users) Trash(ctx context.Context) ([]*models.User, error) {
+	users, err := u.ngstore.SearchDeletedUsers(ctx)
+	if err != nil {
+		u.logger.Error(fmt.Sprintf(`cannot get deleted users: %s`, err))
+		return nil, fmt.Errorf("cannot get deleted users: %w", err)
+	}
+	return users, nil
+}
+
+func (u Users) Restore(ctx context.Context, id int) (*models.User, error) {
+	count, err := u.ngstore.RestoreUser(ctx, id)
+	if err != nil {
+		u.logger.Error(fmt.Sprintf(`cannot restore user %d: %s`, id, err))
+		return nil, fmt.Errorf("cannot restore user %d: %w", id, err)
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("cannot restore user %d: %w", id, ErrNotInTrash)
+	}
+	u.audit.Record(ctx, audit.ActionRestore, models.UserType, id, nil, nil)
+	return u.Read(ctx, id)
+}
+
+// Purge hard-deletes users which are in the trash since before.
+func (u Users) Purge(ctx context.Context, before time.Time) (int, error) {
+	ids, err := u.ngstore.PurgeUsers(ctx, before)
+	if err != nil {
+		u.logger.Error(fmt.Sprintf(`cannot purge users: %s`, err))
+		return 0, fmt.Errorf("cannot purge users: %w", err)
+	}
+	for _, id := range ids {
+		u.audit.Record(ctx, audit.ActionPurge, models.UserType, id, nil, nil)
+	}
+	return len(ids), nil
+}
@@ -0,0 +1,129 @@
+package objrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ptsypyshev/shortlink/internal/auth"
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+var (
+	ErrTOTPNotEnrolled = errors.New("two-factor authentication is not set up")
+	ErrTOTPEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrBadTOTPCode     = errors.New("invalid two-factor authentication code")
+)
+
+type UserTOTP interface {
+	GetUserTOTP(ctx context.Context, id int) (secret string, enabled bool, lastCounter int64, err error)
+	SetUserTOTPSecret(ctx context.Context, id int, secret string) error
+	EnableUserTOTP(ctx context.Context, id int, counter int64, codeHashes []string) error
+	UseUserTOTPCounter(ctx context.Context, id int, counter int64) (bool, error)
+	ResetUserTOTP(ctx context.Context, id int) error
+	ReplaceRecoveryCodes(ctx context.Context, id int, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, id int, codeHash string) (bool, error)
+	CountRecoveryCodes(ctx context.Context, id int) (int, error)
+}
+
+// SetupTOTP generates a new TOTP secret for the user, it stays inactive until EnableTOTP confirms it with a code.
+func (u Users) SetupTOTP(ctx context.Context, user *models.User) (string, error) {
+	if user.TOTPEnabled {
+		return "", ErrTOTPEnabled
+	}
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		return "", fmt.Errorf("cannot generate totp secret: %w", err)
+	}
+	if err := u.ngstore.SetUserTOTPSecret(ctx, user.ID, secret); err != nil {
+		u.logger.Error(fmt.Sprintf(`cannot set totp secret of user %d: %s`, user.ID, err))
+		return "", fmt.Errorf("cannot set totp secret of user %d: %w", user.ID, err)
+	}
+	return secret, nil
+}
+
+// EnableTOTP activates the pending secret and returns new recovery codes to show to the user once.
+func (u Users) EnableTOTP(ctx context.Context, user *models.User, code string) ([]string, error) {
+	secret, enabled, _, err := u.ngstore.GetUserTOTP(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read totp of user %d: %w", user.ID, err)
+	}
+	if enabled {
+		return nil, ErrTOTPEnabled
+	}
+	if secret == "" {
+		return nil, ErrTOTPNotEnrolled
+	}
+	counter, ok := auth.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return nil, ErrBadTOTPCode
+	}
+	codes, hashes, err := auth.NewRecoveryCodes()
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate recovery codes: %w", err)
+	}
+	if err := u.ngstore.EnableUserTOTP(ctx, user.ID, counter, hashes); err != nil {
+		u.logger.Error(fmt.Sprintf(`cannot enable totp of user %d: %s`, user.ID, err))
+		return nil, fmt.Errorf("cannot enable totp of user %d: %w", user.ID, err)
+	}
+	return codes, nil
+}
+
+// VerifySecondFactor accepts either a TOTP code (each time step only once) or an unused recovery code.
+func (u Users) VerifySecondFactor(ctx context.Context, user *models.User, code string) error {
+	secret, enabled, _, err := u.ngstore.GetUserTOTP(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("cannot read totp of user %d: %w", user.ID, err)
+	}
+	if !enabled {
+		return ErrTOTPNotEnrolled
+	}
+	if counter, ok := auth.ValidateTOTP(secret, code, time.Now()); ok {
+		accepted, err := u.ngstore.UseUserTOTPCounter(ctx, user.ID, counter)
+		if err != nil {
+			return err
+		}
+		if accepted {
+			return nil
+		}
+		return ErrBadTOTPCode
+	}
+	used, err := u.ngstore.UseRecoveryCode(ctx, user.ID, auth.HashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrBadTOTPCode
+	}
+	u.logger.Info(fmt.Sprintf(`user %s used a recovery code`, user.Username))
+	return nil
+}
+
+func (u Users) RegenerateRecoveryCodes(ctx context.Context, user *models.User) ([]string, error) {
+	if !user.TOTPEnabled {
+		return nil, ErrTOTPNotEnrolled
+	}
+	codes, hashes, err := auth.NewRecoveryCodes()
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate recovery codes: %w", err)
+	}
+	if err := u.ngstore.ReplaceRecoveryCodes(ctx, user.ID, hashes); err != nil {
+		u.logger.Error(fmt.Sprintf(`cannot replace recovery codes of user %d: %s`, user.ID, err))
+		return nil, fmt.Errorf("cannot replace recovery codes of user %d: %w", user.ID, err)
+	}
+	return codes, nil
+}
+
+func (u Users) RecoveryCodesLeft(ctx context.Context, id int) (int, error) {
+	return u.ngstore.CountRecoveryCodes(ctx, id)
+}
+
+// ResetTOTP disables 2FA and removes the secret and recovery codes (used by user and by administrator).
+func (u Users) ResetTOTP(ctx context.Context, id int) (*models.User, error) {
+	if err := u.ngstore.ResetUserTOTP(ctx, id); err != nil {
+		u.logger.Error(fmt.Sprintf(`cannot reset totp of user %d: %s`, id, err))
+		return nil, fmt.Errorf("cannot reset totp of user %d: %w", id, err)
+	}
+	return u.Read(ctx, id)
+}
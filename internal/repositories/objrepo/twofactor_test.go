@@ -0,0 +1,67 @@
+package objrepo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ptsypyshev/shortlink/internal/auth"
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+// totpStore keeps the TOTP state of one user like the users table does.
+type totpStore struct {
+	NonGenericStorage
+	secret      string
+	lastCounter int64
+}
+
+func (s *totpStore) GetUserTOTP(context.Context, int) (string, bool, int64, error) {
+	return s.secret, true, s.lastCounter, nil
+}
+
+func (s *totpStore) UseUserTOTPCounter(_ context.Context, _ int, counter int64) (bool, error) {
+	if counter <= s.lastCounter {
+		return false, nil
+	}
+	s.lastCounter = counter
+	return true, nil
+}
+
+func (s *totpStore) UseRecoveryCode(context.Context, int, string) (bool, error) {
+	return false, nil
+}
+
+func TestVerifySecondFactorRejectsReusedCode(t *testing.T) {
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &totpStore{secret: secret}
+	users := UsersNew(nil, store, nil, auth.PasswordPolicy{}, zap.NewNop())
+	user := &models.User{ID: 1, Username: "alice", TOTPEnabled: true}
+
+	counter := time.Now().Unix() / int64(auth.TOTPPeriod.Seconds())
+	code, err := auth.TOTPCode(secret, counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.VerifySecondFactor(context.Background(), user, code); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := users.VerifySecondFactor(context.Background(), user, code); !errors.Is(err, ErrBadTOTPCode) {
+		t.Errorf("reuse: err = %v, want %v", err, ErrBadTOTPCode)
+	}
+
+	// A code of an earlier step within the skew is a replay as well
+	previous, err := auth.TOTPCode(secret, counter-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.VerifySecondFactor(context.Background(), user, previous); !errors.Is(err, ErrBadTOTPCode) {
+		t.Errorf("earlier step: err = %v, want %v", err, ErrBadTOTPCode)
+	}
+}
@@ -0,0 +1,89 @@
+package objrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const (
+	// MaxVariants limits destinations of a split link
+	MaxVariants       = 10
+	maxVariantName    = 50
+	variantNameLetter = 'A'
+)
+
+var ErrBadVariants = errors.New("bad variants")
+
+type LinkVariants interface {
+	SetLinkVariants(ctx context.Context, linkID int, variants []models.Variant) error
+	CountLinkVariantClick(ctx context.Context, id int) error
+}
+
+// SetVariants stores weighted destinations of the link, nil keeps them unchanged and empty variants remove them.
+// Variants are matched by names, so renaming a variant resets its click counter.
+func (l Links) SetVariants(ctx context.Context, linkID int, variants []models.Variant) error {
+	if variants == nil {
+		return nil
+	}
+	variants, err := NormalizeVariants(variants)
+	if err != nil {
+		return fmt.Errorf("cannot set variants of link %d: %w", linkID, err)
+	}
+	if err := l.ngstore.SetLinkVariants(ctx, linkID, variants); err != nil {
+		l.logger.Error(fmt.Sprintf(`cannot set variants of link %d: %s`, linkID, err))
+		return fmt.Errorf("cannot set variants of link %d: %w", linkID, err)
+	}
+	return nil
+}
+
+// CountVariantClick records that a click was sent to the variant.
+func (l Links) CountVariantClick(ctx context.Context, id int) error {
+	if err := l.ngstore.CountLinkVariantClick(ctx, id); err != nil {
+		l.logger.Error(fmt.Sprintf(`cannot count click of variant %d: %s`, id, err))
+		return fmt.Errorf("cannot count click of variant %d: %w", id, err)
+	}
+	return nil
+}
+
+// NormalizeVariants names unnamed variants by their position (A, B, ...) and checks names, weights
+// and destinations. Nil variants stay nil.
+func NormalizeVariants(variants []models.Variant) ([]models.Variant, error) {
+	if variants == nil {
+		return nil, nil
+	}
+	if len(variants) > MaxVariants {
+		return nil, fmt.Errorf("%w: no more than %d variants are allowed", ErrBadVariants, MaxVariants)
+	}
+	normalized := make([]models.Variant, 0, len(variants))
+	names := make(map[string]bool, len(variants))
+	for i, variant := range variants {
+		variant.Name = strings.TrimSpace(variant.Name)
+		if variant.Name == "" {
+			variant.Name = string(rune(variantNameLetter + i))
+		}
+		variant.Destination = strings.TrimSpace(variant.Destination)
+		switch {
+		case len(variant.Name) > maxVariantName:
+			return nil, fmt.Errorf("%w: variant name %q is too long", ErrBadVariants, variant.Name)
+		case names[variant.Name]:
+			return nil, fmt.Errorf("%w: variant name %q is repeated", ErrBadVariants, variant.Name)
+		case variant.Weight < 0:
+			return nil, fmt.Errorf("%w: weight of variant %q is negative", ErrBadVariants, variant.Name)
+		}
+		if dest, err := url.Parse(variant.Destination); err != nil || dest.Host == "" ||
+			(dest.Scheme != "http" && dest.Scheme != "https") {
+			return nil, fmt.Errorf("%w: destination of variant %q must be an http(s) URL", ErrBadVariants, variant.Name)
+		}
+		names[variant.Name] = true
+		normalized = append(normalized, variant)
+	}
+	if len(normalized) > 0 && models.TotalWeight(normalized) == 0 {
+		return nil, fmt.Errorf("%w: at least one variant must have a positive weight", ErrBadVariants)
+	}
+	return normalized, nil
+}
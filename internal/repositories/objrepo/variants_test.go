@@ -0,0 +1,59 @@
+package objrepo
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+func TestNormalizeVariants(t *testing.T) {
+	tooMany := make([]models.Variant, MaxVariants+1)
+	for i := range tooMany {
+		tooMany[i] = models.Variant{Name: fmt.Sprint(i), Destination: "https://example.com/", Weight: 1}
+	}
+	tests := []struct {
+		name     string
+		variants []models.Variant
+		want     []models.Variant
+		ok       bool
+	}{
+		{"unchanged", nil, nil, true},
+		{"removed", []models.Variant{}, []models.Variant{}, true},
+		{"names are given", []models.Variant{
+			{Destination: " https://example.com/a ", Weight: 1},
+			{Name: " blue ", Destination: "http://example.com/b", Weight: 0},
+			{Destination: "https://example.com/c", Weight: 3},
+		}, []models.Variant{
+			{Name: "A", Destination: "https://example.com/a", Weight: 1},
+			{Name: "blue", Destination: "http://example.com/b", Weight: 0},
+			{Name: "C", Destination: "https://example.com/c", Weight: 3},
+		}, true},
+		{"too many", tooMany, nil, false},
+		{"repeated name", []models.Variant{
+			{Name: "A", Destination: "https://example.com/a", Weight: 1},
+			{Destination: "https://example.com/b", Weight: 1},
+			{Name: "A", Destination: "https://example.com/c", Weight: 1},
+		}, nil, false},
+		{"negative weight", []models.Variant{{Destination: "https://example.com/", Weight: -1}}, nil, false},
+		{"all weights are zero", []models.Variant{{Destination: "https://example.com/"}}, nil, false},
+		{"not http", []models.Variant{{Destination: "javascript:alert(1)", Weight: 1}}, nil, false},
+		{"relative", []models.Variant{{Destination: "/landing", Weight: 1}}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeVariants(tt.variants)
+			if (err == nil) != tt.ok {
+				t.Fatalf("err = %v, want ok = %t", err, tt.ok)
+			}
+			if err != nil && !errors.Is(err, ErrBadVariants) {
+				t.Errorf("err = %v does not wrap %v", err, ErrBadVariants)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NormalizeVariants = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package objrepo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const (
+	// MinWebhookSecretLength keeps signatures of payloads hard to forge
+	MinWebhookSecretLength = 16
+	webhookSecretPrefix    = "whsec_"
+)
+
+var ErrBadWebhook = errors.New("bad webhook")
+
+type WebhookStorage interface {
+	CreateWebhook(ctx context.Context, webhook *models.Webhook) (int, error)
+	ReadWebhook(ctx context.Context, id int) (*models.Webhook, error)
+	SearchWebhooks(ctx context.Context, ownerID, workspaceID int) ([]*models.Webhook, error)
+	UpdateWebhook(ctx context.Context, webhook *models.Webhook) error
+	DeleteWebhook(ctx context.Context, id int) error
+	EnqueueWebhookDeliveries(ctx context.Context, event, payload string, workspaceID, ownerID int) (int64, error)
+	CreateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error)
+	SetWebhookDeliveryResult(ctx context.Context, delivery *models.WebhookDelivery) error
+	SearchWebhookDeliveries(ctx context.Context, webhookID, limit, offset int) ([]*models.WebhookDelivery, error)
+	PurgeWebhookDeliveries(ctx context.Context, before time.Time) (int64, error)
+}
+
+type Webhooks struct {
+	store  WebhookStorage
+	logger *zap.Logger
+}
+
+func WebhooksNew(s WebhookStorage, l *zap.Logger) *Webhooks {
+	return &Webhooks{
+		store:  s,
+		logger: l,
+	}
+}
+
+// Create stores the webhook with a generated secret unless the secret is given.
+// The secret is returned in the created webhook only.
+func (w Webhooks) Create(ctx context.Context, webhook *models.Webhook) (*models.Webhook, error) {
+	if err := NormalizeWebhook(webhook); err != nil {
+		return nil, fmt.Errorf("cannot create webhook: %w", err)
+	}
+	if webhook.Secret == "" {
+		secret, err := newWebhookSecret()
+		if err != nil {
+			return nil, fmt.Errorf("cannot create webhook: %w", err)
+		}
+		webhook.Secret = secret
+	}
+	id, err := w.store.CreateWebhook(ctx, webhook)
+	if err != nil {
+		w.logger.Error(fmt.Sprintf(`cannot create webhook: %s`, err))
+		return nil, fmt.Errorf("cannot create webhook: %w", err)
+	}
+	webhook.ID = id
+	return webhook, nil
+}
+
+// Read returns the webhook with its secret, callers hide it from responses.
+func (w Webhooks) Read(ctx context.Context, id int) (*models.Webhook, error) {
+	webhook, err := w.store.ReadWebhook(ctx, id)
+	if err != nil {
+		w.logger.Error(fmt.Sprintf(`cannot read webhook: %s`, err))
+		return nil, fmt.Errorf("cannot read webhook: %w", err)
+	}
+	return webhook, nil
+}
+
+// Search returns webhooks of the workspace or, for zero workspaceID, personal webhooks of the owner without secrets.
+func (w Webhooks) Search(ctx context.Context, ownerID, workspaceID int) ([]*models.Webhook, error) {
+	webhooks, err := w.store.SearchWebhooks(ctx, ownerID, workspaceID)
+	if err != nil {
+		w.logger.Error(fmt.Sprintf(`cannot search webhooks: %s`, err))
+		return nil, fmt.Errorf("cannot search webhooks: %w", err)
+	}
+	for _, webhook := range webhooks {
+		webhook.Secret = ""
+	}
+	return webhooks, nil
+}
+
+// Update replaces the URL, events and state of the webhook, an empty secret keeps the current one.
+// The secret is returned only if it was changed.
+func (w Webhooks) Update(ctx context.Context, webhook *models.Webhook) (*models.Webhook, error) {
+	if err := NormalizeWebhook(webhook); err != nil {
+		return nil, fmt.Errorf("cannot update webhook: %w", err)
+	}
+	if err := w.store.UpdateWebhook(ctx, webhook); err != nil {
+		w.logger.Error(fmt.Sprintf(`cannot update webhook: %s`, err))
+		return nil, fmt.Errorf("cannot update webhook: %w", err)
+	}
+	updated, err := w.Read(ctx, webhook.ID)
+	if err != nil {
+		return nil, err
+	}
+	if webhook.Secret == "" {
+		updated.Secret = ""
+	}
+	return updated, nil
+}
+
+// Delete removes the webhook with its delivery log.
+func (w Webhooks) Delete(ctx context.Context, id int) (*models.Webhook, error) {
+	webhook, err := w.Read(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	webhook.Secret = ""
+	return webhook, w.store.DeleteWebhook(ctx, id)
+}
+
+// Enqueue creates pending deliveries of the event for webhooks of the workspace and personal webhooks of the owner
+// subscribed to it and returns their number.
+func (w Webhooks) Enqueue(ctx context.Context, event, payload string, workspaceID, ownerID int) (int64, error) {
+	count, err := w.store.EnqueueWebhookDeliveries(ctx, event, payload, workspaceID, ownerID)
+	if err != nil {
+		w.logger.Error(fmt.Sprintf(`cannot enqueue %s deliveries: %s`, event, err))
+		return 0, fmt.Errorf("cannot enqueue %s deliveries: %w", event, err)
+	}
+	return count, nil
+}
+
+// AddDelivery stores a delivery which was already attempted, like a test delivery.
+func (w Webhooks) AddDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	if err := w.store.CreateWebhookDelivery(ctx, delivery); err != nil {
+		w.logger.Error(fmt.Sprintf(`cannot add delivery of webhook %d: %s`, delivery.WebhookID, err))
+		return fmt.Errorf("cannot add delivery of webhook %d: %w", delivery.WebhookID, err)
+	}
+	return nil
+}
+
+// ClaimDeliveries returns up to limit due deliveries and postpones them by lease,
+// so they are sent again if their results are not stored in time.
+func (w Webhooks) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error) {
+	deliveries, err := w.store.ClaimWebhookDeliveries(ctx, limit, lease)
+	if err != nil {
+		w.logger.Error(fmt.Sprintf(`cannot claim webhook deliveries: %s`, err))
+		return nil, fmt.Errorf("cannot claim webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+func (w Webhooks) SetDeliveryResult(ctx context.Context, delivery *models.WebhookDelivery) error {
+	if err := w.store.SetWebhookDeliveryResult(ctx, delivery); err != nil {
+		w.logger.Error(fmt.Sprintf(`cannot set result of webhook delivery %d: %s`, delivery.ID, err))
+		return fmt.Errorf("cannot set result of webhook delivery %d: %w", delivery.ID, err)
+	}
+	return nil
+}
+
+// Deliveries returns the delivery log of the webhook, newest first.
+func (w Webhooks) Deliveries(ctx context.Context, webhookID, limit, offset int) ([]*models.WebhookDelivery, error) {
+	deliveries, err := w.store.SearchWebhookDeliveries(ctx, webhookID, limit, offset)
+	if err != nil {
+		w.logger.Error(fmt.Sprintf(`cannot search deliveries of webhook %d: %s`, webhookID, err))
+		return nil, fmt.Errorf("cannot search deliveries of webhook %d: %w", webhookID, err)
+	}
+	return deliveries, nil
+}
+
+// PurgeDeliveries deletes finished deliveries created before the given time.
+func (w Webhooks) PurgeDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	count, err := w.store.PurgeWebhookDeliveries(ctx, before)
+	if err != nil {
+		w.logger.Error(fmt.Sprintf(`cannot purge webhook deliveries: %s`, err))
+		return 0, fmt.Errorf("cannot purge webhook deliveries: %w", err)
+	}
+	return count, nil
+}
+
+// NormalizeWebhook checks the URL and the secret of the webhook and sorts its events removing duplicates.
+func NormalizeWebhook(webhook *models.Webhook) error {
+	webhook.URL = strings.TrimSpace(webhook.URL)
+	if u, err := url.Parse(webhook.URL); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("%w: url must be an http(s) URL", ErrBadWebhook)
+	}
+	if webhook.Secret != "" && len(webhook.Secret) < MinWebhookSecretLength {
+		return fmt.Errorf("%w: secret must be at least %d characters long", ErrBadWebhook, MinWebhookSecretLength)
+	}
+	seen := make(map[string]bool, len(webhook.Events))
+	events := make([]string, 0, len(webhook.Events))
+	for _, event := range webhook.Events {
+		event = strings.ToLower(strings.TrimSpace(event))
+		if !models.ValidWebhookEvent(event) {
+			return fmt.Errorf("%w: unknown event %q", ErrBadWebhook, event)
+		}
+		if !seen[event] {
+			seen[event] = true
+			events = append(events, event)
+		}
+	}
+	if len(events) == 0 {
+		return fmt.Errorf("%w: at least one event is required", ErrBadWebhook)
+	}
+	sort.Strings(events)
+	webhook.Events = events
+	return nil
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return webhookSecretPrefix + hex.EncodeToString(b), nil
+}
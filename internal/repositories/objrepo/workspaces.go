@@ -0,0 +1,188 @@
+package objrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/ptsypyshev/shortlink/internal/audit"
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const WorkspaceNameMaxLength = 100
+
+var (
+	ErrWorkspaceInUse    = errors.New("workspace is personal or still has links")
+	ErrPersonalWorkspace = errors.New("members of a personal workspace cannot be changed")
+	ErrLastOwner         = errors.New("workspace must have at least one owner")
+	ErrBadWorkspaceRole  = errors.New("workspace role must be owner, editor or viewer")
+	ErrBadWorkspaceName  = errors.New("workspace name must not be empty or too long")
+)
+
+type WorkspaceStorage interface {
+	CreateWorkspace(ctx context.Context, workspace *models.Workspace, ownerID int) (int, error)
+	ReadWorkspace(ctx context.Context, id, userID int) (*models.Workspace, error)
+	SearchWorkspaces(ctx context.Context, userID int) ([]*models.Workspace, error)
+	PersonalWorkspace(ctx context.Context, userID int) (int, error)
+	UpdateWorkspace(ctx context.Context, workspace *models.Workspace) error
+	DeleteWorkspace(ctx context.Context, id int) error
+	WorkspaceRole(ctx context.Context, id, userID int) (string, error)
+	WorkspaceMembers(ctx context.Context, id int) ([]*models.WorkspaceMember, error)
+	SetWorkspaceMember(ctx context.Context, member *models.WorkspaceMember) error
+	DeleteWorkspaceMember(ctx context.Context, id, userID int) error
+}
+
+type Workspaces struct {
+	store  WorkspaceStorage
+	audit  Audit
+	logger *zap.Logger
+}
+
+func WorkspacesNew(s WorkspaceStorage, as AuditStorage, l *zap.Logger) *Workspaces {
+	return &Workspaces{
+		store:  s,
+		audit:  *AuditNew(as, l),
+		logger: l,
+	}
+}
+
+func (w Workspaces) Create(ctx context.Context, workspace *models.Workspace, ownerID int) (*models.Workspace, error) {
+	if err := normalizeWorkspace(workspace); err != nil {
+		return nil, fmt.Errorf("cannot create workspace: %w", err)
+	}
+	id, err := w.store.CreateWorkspace(ctx, workspace, ownerID)
+	if err != nil {
+		w.logger.Error(fmt.Sprintf(`cannot create workspace: %s`, err))
+		return nil, fmt.Errorf("cannot create workspace: %w", err)
+	}
+	w.audit.Record(ctx, audit.ActionCreate, models.WorkspaceType, id, nil, workspace.Get())
+	return w.store.ReadWorkspace(ctx, id, ownerID)
+}
+
+// Read returns the workspace with the role of the user, it fails if the user is not a member.
+func (w Workspaces) Read(ctx context.Context, id, userID int) (*models.Workspace, error) {
+	workspace, err := w.store.ReadWorkspace(ctx, id, userID)
+	if err != nil {
+		w.logger.Error(fmt.Sprintf(`cannot read workspace: %s`, err))
+		return nil, fmt.Errorf("cannot read workspace: %w", err)
+	}
+	return workspace, nil
+}
+
+func (w Workspaces) Search(ctx context.Context, userID int) ([]*models.Workspace, error) {
+	workspaces, err := w.store.SearchWorkspaces(ctx, userID)
+	if err != nil {
+		w.logger.Error(fmt.Sprintf(`cannot search workspaces: %s`, err))
+		return nil, fmt.Errorf("cannot search workspaces: %w", err)
+	}
+	return workspaces, nil
+}
+
+// Personal returns the id of the personal workspace of the user.
+func (w Workspaces) Personal(ctx context.Context, userID int) (int, error) {
+	id, err := w.store.PersonalWorkspace(ctx, userID)
+	if err != nil {
+		w.logger.Error(fmt.Sprintf(`cannot find personal workspace of user %d: %s`, userID, err))
+		return 0, fmt.Errorf("cannot find personal workspace of user %d: %w", userID, err)
+	}
+	return id, nil
+}
+
+// Role returns the role of the user in the workspace, empty if the user is not a member.
+func (w Workspaces) Role(ctx context.Context, id, userID int) (string, error) {
+	role, err := w.store.WorkspaceRole(ctx, id, userID)
+	if err != nil {
+		w.logger.Error(fmt.Sprintf(`cannot read workspace role: %s`, err))
+		return "", fmt.Errorf("cannot read workspace role: %w", err)
+	}
+	return role, nil
+}
+
+func (w Workspaces) Update(ctx context.Context, workspace *models.Workspace, userID int) (*models.Workspace, error) {
+	if err := normalizeWorkspace(workspace); err != nil {
+		return nil, fmt.Errorf("cannot update workspace: %w", err)
+	}
+	before, err := w.store.ReadWorkspace(ctx, workspace.ID, userID)
+	if err != nil {
+		w.logger.Error(fmt.Sprintf(`cannot update workspace: %s`, err))
+		return nil, fmt.Errorf("cannot update workspace: %w", err)
+	}
+	if err := w.store.UpdateWorkspace(ctx, workspace); err != nil {
+		w.logger.Error(fmt.Sprintf(`cannot update workspace: %s`, err))
+		return nil, fmt.Errorf("cannot update workspace: %w", err)
+	}
+	w.audit.Record(ctx, audit.ActionUpdate, models.WorkspaceType, workspace.ID,
+		map[string]string{"name": before.Name}, map[string]string{"name": workspace.Name})
+	return w.store.ReadWorkspace(ctx, workspace.ID, userID)
+}
+
+// Delete removes a shared workspace without links, personal workspaces are removed together with their users.
+func (w Workspaces) Delete(ctx context.Context, id, userID int) (*models.Workspace, error) {
+	workspace, err := w.store.ReadWorkspace(ctx, id, userID)
+	if err != nil {
+		w.logger.Error(fmt.Sprintf(`cannot delete workspace: %s`, err))
+		return nil, fmt.Errorf("cannot delete workspace: %w", err)
+	}
+	if err := w.store.DeleteWorkspace(ctx, id); err != nil {
+		w.logger.Error(fmt.Sprintf(`cannot delete workspace: %s`, err))
+		return nil, fmt.Errorf("cannot delete workspace: %w", err)
+	}
+	w.audit.Record(ctx, audit.ActionDelete, models.WorkspaceType, id, workspace.Get(), nil)
+	return workspace, nil
+}
+
+func (w Workspaces) Members(ctx context.Context, id int) ([]*models.WorkspaceMember, error) {
+	members, err := w.store.WorkspaceMembers(ctx, id)
+	if err != nil {
+		w.logger.Error(fmt.Sprintf(`cannot read workspace members: %s`, err))
+		return nil, fmt.Errorf("cannot read workspace members: %w", err)
+	}
+	return members, nil
+}
+
+// SetMember adds the user to the workspace or changes the role of the member.
+func (w Workspaces) SetMember(ctx context.Context, member *models.WorkspaceMember) error {
+	if !models.ValidWorkspaceRole(member.Role) {
+		return fmt.Errorf("cannot set workspace member: %w", ErrBadWorkspaceRole)
+	}
+	before, err := w.store.WorkspaceRole(ctx, member.WorkspaceID, member.UserID)
+	if err != nil {
+		w.logger.Error(fmt.Sprintf(`cannot set workspace member: %s`, err))
+		return fmt.Errorf("cannot set workspace member: %w", err)
+	}
+	if err := w.store.SetWorkspaceMember(ctx, member); err != nil {
+		w.logger.Error(fmt.Sprintf(`cannot set workspace member: %s`, err))
+		return fmt.Errorf("cannot set workspace member: %w", err)
+	}
+	key := fmt.Sprintf("member_%d", member.UserID)
+	w.audit.Record(ctx, audit.ActionUpdate, models.WorkspaceType, member.WorkspaceID,
+		map[string]string{key: before}, map[string]string{key: member.Role})
+	return nil
+}
+
+func (w Workspaces) RemoveMember(ctx context.Context, id, userID int) error {
+	before, err := w.store.WorkspaceRole(ctx, id, userID)
+	if err != nil {
+		w.logger.Error(fmt.Sprintf(`cannot remove workspace member: %s`, err))
+		return fmt.Errorf("cannot remove workspace member: %w", err)
+	}
+	if err := w.store.DeleteWorkspaceMember(ctx, id, userID); err != nil {
+		w.logger.Error(fmt.Sprintf(`cannot remove workspace member: %s`, err))
+		return fmt.Errorf("cannot remove workspace member: %w", err)
+	}
+	key := fmt.Sprintf("member_%d", userID)
+	w.audit.Record(ctx, audit.ActionUpdate, models.WorkspaceType, id,
+		map[string]string{key: before}, map[string]string{key: ""})
+	return nil
+}
+
+func normalizeWorkspace(workspace *models.Workspace) error {
+	workspace.Name = strings.TrimSpace(workspace.Name)
+	if workspace.Name == "" || len(workspace.Name) > WorkspaceNameMaxLength {
+		return ErrBadWorkspaceName
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+// Package sessionstore keeps gin sessions in the database: the cookie carries only a random session token,
+// the data and the metadata (user, IP, user agent, times) are stored server-side under the token hash.
+package sessionstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	ginsessions "github.com/gin-contrib/sessions"
+	"github.com/gorilla/sessions"
+
+	"github.com/ptsypyshev/shortlink/internal/auth"
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+// ownerKey keeps the user the session was saved for, the token is rotated when it changes (login)
+const ownerKey = "_owner"
+
+type clientIPKey struct{}
+
+// WithClientIP sets the client address saved with sessions, the remote address of the connection is used without it.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+type Storage interface {
+	LoadSession(ctx context.Context, tokenHash string) ([]byte, error)
+	SaveSession(ctx context.Context, tokenHash, username string, data []byte, ip, userAgent string, expiresAt time.Time) error
+	GetSession(ctx context.Context, tokenHash string) (*models.Session, error)
+	TouchSession(ctx context.Context, tokenHash, ip, userAgent string) error
+	DeleteSession(ctx context.Context, tokenHash string) error
+	DeleteExpiredSessions(ctx context.Context) (int64, error)
+}
+
+// Store implements sessions.Store of gin-contrib/sessions.
+type Store struct {
+	storage Storage
+	options *sessions.Options
+	// userKey is the session value holding the username the session belongs to
+	userKey string
+	// lifetime is the absolute session timeout
+	lifetime time.Duration
+}
+
+func New(storage Storage, userKey string, lifetime time.Duration, options ginsessions.Options) *Store {
+	return &Store{
+		storage:  storage,
+		options:  options.ToGorillaOptions(),
+		userKey:  userKey,
+		lifetime: lifetime,
+	}
+}
+
+func (s *Store) Options(options ginsessions.Options) {
+	s.options = options.ToGorillaOptions()
+}
+
+func (s *Store) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New loads the session by the cookie token, an unknown or expired token gives a new empty session.
+func (s *Store) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	options := *s.options
+	session.Options = &options
+	session.IsNew = true
+	cookie, err := r.Cookie(name)
+	if err != nil || cookie.Value == "" {
+		return session, nil
+	}
+	data, err := s.storage.LoadSession(r.Context(), auth.HashToken(cookie.Value))
+	if err != nil {
+		return session, fmt.Errorf("cannot load session: %w", err)
+	}
+	if data == nil {
+		return session, nil
+	}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&session.Values); err != nil {
+		return session, fmt.Errorf("cannot decode session: %w", err)
+	}
+	session.ID = cookie.Value
+	session.IsNew = false
+	return session, nil
+}
+
+// Save stores the session and sets the cookie, MaxAge < 0 deletes the session.
+func (s *Store) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if err := s.storage.DeleteSession(r.Context(), auth.HashToken(session.ID)); err != nil {
+				return fmt.Errorf("cannot delete session: %w", err)
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	username, _ := session.Values[s.userKey].(string)
+	owner, _ := session.Values[ownerKey].(string)
+	if session.ID != "" && owner != username {
+		// A new token on login and logout prevents session fixation
+		if err := s.storage.DeleteSession(r.Context(), auth.HashToken(session.ID)); err != nil {
+			return fmt.Errorf("cannot delete session: %w", err)
+		}
+		session.ID = ""
+	}
+	if session.ID == "" {
+		token, _, err := auth.NewRandomToken()
+		if err != nil {
+			return fmt.Errorf("cannot generate session token: %w", err)
+		}
+		session.ID = token
+	}
+	session.Values[ownerKey] = username
+
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(session.Values); err != nil {
+		return fmt.Errorf("cannot encode session: %w", err)
+	}
+	err := s.storage.SaveSession(r.Context(), auth.HashToken(session.ID), username, data.Bytes(),
+		clientIP(r), r.UserAgent(), time.Now().Add(s.lifetime))
+	if err != nil {
+		return fmt.Errorf("cannot save session: %w", err)
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), session.ID, session.Options))
+	return nil
+}
+
+// Lookup returns the metadata of the session by its token.
+func (s *Store) Lookup(ctx context.Context, token string) (*models.Session, error) {
+	return s.storage.GetSession(ctx, auth.HashToken(token))
+}
+
+// Touch updates the last seen time and the client of the session.
+func (s *Store) Touch(ctx context.Context, token, ip, userAgent string) error {
+	return s.storage.TouchSession(ctx, auth.HashToken(token), ip, userAgent)
+}
+
+func (s *Store) Delete(ctx context.Context, token string) error {
+	return s.storage.DeleteSession(ctx, auth.HashToken(token))
+}
+
+// StartCleanup periodically removes expired sessions until ctx is done.
+func (s *Store) StartCleanup(ctx context.Context, interval time.Duration, onError func(error)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := s.storage.DeleteExpiredSessions(ctx); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+}
+
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok && ip != "" {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,43 @@
+package targeting
+
+import (
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// MaxMindResolver resolves countries by a local GeoIP2 or GeoLite2 Country (or City) database file.
+type MaxMindResolver struct {
+	db *maxminddb.Reader
+}
+
+func OpenMaxMind(path string) (*MaxMindResolver, error) {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &MaxMindResolver{db: db}, nil
+}
+
+func (r *MaxMindResolver) Country(ip net.IP) (string, error) {
+	var record struct {
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+		// Anonymous proxies and some networks only have the country of registration
+		RegisteredCountry struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"registered_country"`
+	}
+	if err := r.db.Lookup(ip, &record); err != nil {
+		return "", err
+	}
+	if record.Country.ISOCode != "" {
+		return record.Country.ISOCode, nil
+	}
+	return record.RegisteredCountry.ISOCode, nil
+}
+
+func (r *MaxMindResolver) Close() error {
+	return r.db.Close()
+}
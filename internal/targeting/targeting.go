@@ -0,0 +1,153 @@
+// Package targeting chooses the destination of a click by the country of the client,
+// its preferred languages and the device class.
+package targeting
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+// Request describes a click as seen by targeting rules.
+type Request struct {
+	Country   string   `json:"country"`
+	Languages []string `json:"languages"`
+	Device    string   `json:"device"`
+}
+
+// GeoResolver returns the ISO 3166 country code of the IP address, empty if the country is unknown.
+type GeoResolver interface {
+	Country(ip net.IP) (string, error)
+}
+
+// NewRequest describes the click by its headers, the country is resolved by geo if it is set.
+func NewRequest(geo GeoResolver, ip net.IP, userAgent, acceptLanguage string) (Request, error) {
+	req := Request{
+		Languages: Languages(acceptLanguage),
+		Device:    Device(userAgent),
+	}
+	if geo != nil && ip != nil {
+		country, err := geo.Country(ip)
+		if err != nil {
+			return req, err
+		}
+		req.Country = strings.ToUpper(country)
+	}
+	return req, nil
+}
+
+// Device returns the device class of the User-Agent, everything except iOS and Android is desktop.
+func Device(userAgent string) string {
+	switch {
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"),
+		strings.Contains(userAgent, "iPod"):
+		return models.DeviceIOS
+	// Android tablets and phones, including Android-based TVs and watches
+	case strings.Contains(userAgent, "Android"):
+		return models.DeviceAndroid
+	}
+	return models.DeviceDesktop
+}
+
+// Languages returns lower-case language tags of the Accept-Language header ordered by preference.
+// The wildcard and languages with zero quality are dropped.
+func Languages(acceptLanguage string) []string {
+	type weighted struct {
+		tag     string
+		quality float64
+	}
+	var accepted []weighted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || strings.TrimSpace(name) != "q" {
+				continue
+			}
+			q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				q = 0
+			}
+			quality = q
+		}
+		if quality <= 0 {
+			continue
+		}
+		accepted = append(accepted, weighted{tag: tag, quality: quality})
+	}
+	// Languages of the same quality keep the order of the header
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return accepted[i].quality > accepted[j].quality
+	})
+	languages := make([]string, 0, len(accepted))
+	for _, language := range accepted {
+		languages = append(languages, language.tag)
+	}
+	return languages
+}
+
+// Match returns the index of the first rule matching the request or -1 if no rule matches.
+func Match(rules []models.TargetRule, req Request) int {
+	for i, rule := range rules {
+		if matchCountry(rule.Countries, req.Country) && matchLanguage(rule.Languages, req.Languages) &&
+			matchDevice(rule.Devices, req.Device) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Destination returns the destination of the first matching rule or the long link of the link.
+func Destination(link *models.Link, req Request) (string, int) {
+	if i := Match(link.Targeting, req); i >= 0 {
+		return link.Targeting[i].Destination, i
+	}
+	return link.LongLink, -1
+}
+
+func matchCountry(countries []string, country string) bool {
+	if len(countries) == 0 {
+		return true
+	}
+	for _, c := range countries {
+		if strings.EqualFold(c, country) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchLanguage(ruleLanguages, languages []string) bool {
+	if len(ruleLanguages) == 0 {
+		return true
+	}
+	for _, language := range languages {
+		for _, ruleLanguage := range ruleLanguages {
+			ruleLanguage = strings.ToLower(ruleLanguage)
+			if language == ruleLanguage || strings.HasPrefix(language, ruleLanguage+"-") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchDevice(devices []string, device string) bool {
+	if len(devices) == 0 {
+		return true
+	}
+	for _, d := range devices {
+		if strings.EqualFold(d, device) {
+			return true
+		}
+	}
+	return false
+}
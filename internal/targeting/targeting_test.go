@@ -0,0 +1,111 @@
+package targeting
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+func TestLanguages(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{"", []string{}},
+		{"en-US", []string{"en-us"}},
+		{"fr;q=0.5, de-DE, en;q=0.8", []string{"de-de", "en", "fr"}},
+		{"ru, uk, be;q=0.9", []string{"ru", "uk", "be"}},
+		{"*, en;q=0, es;q=bad, it;q=0.1", []string{"it"}},
+		{" PT-br ; q=0.7 ,", []string{"pt-br"}},
+	}
+	for _, tt := range tests {
+		if got := Languages(tt.header); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Languages(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestDevice(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      string
+	}{
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)", models.DeviceIOS},
+		{"Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X)", models.DeviceIOS},
+		{"Mozilla/5.0 (Linux; Android 14; Pixel 8)", models.DeviceAndroid},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64)", models.DeviceDesktop},
+		{"", models.DeviceDesktop},
+	}
+	for _, tt := range tests {
+		if got := Device(tt.userAgent); got != tt.want {
+			t.Errorf("Device(%q) = %q, want %q", tt.userAgent, got, tt.want)
+		}
+	}
+}
+
+func TestDestination(t *testing.T) {
+	link := &models.Link{
+		LongLink: "https://example.com/",
+		Targeting: []models.TargetRule{
+			{Countries: []string{"de", "AT"}, Languages: []string{"de"}, Destination: "https://example.de/"},
+			{Devices: []string{models.DeviceIOS}, Destination: "https://apps.apple.com/"},
+			{Languages: []string{"pt"}, Destination: "https://example.com/pt/"},
+		},
+	}
+	tests := []struct {
+		name string
+		req  Request
+		want string
+		rule int
+	}{
+		{"all conditions of a rule", Request{Country: "AT", Languages: []string{"de-at"}}, "https://example.de/", 0},
+		{"country without language", Request{Country: "DE", Languages: []string{"en"}}, "https://example.com/", -1},
+		{"device", Request{Country: "DE", Device: models.DeviceIOS}, "https://apps.apple.com/", 1},
+		{"first matching rule wins", Request{Country: "DE", Languages: []string{"de"}, Device: models.DeviceIOS},
+			"https://example.de/", 0},
+		{"language prefix", Request{Languages: []string{"en", "pt-br"}}, "https://example.com/pt/", 2},
+		{"prefix is a whole subtag", Request{Languages: []string{"pto"}}, "https://example.com/", -1},
+		{"no match", Request{Device: models.DeviceDesktop}, "https://example.com/", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rule := Destination(link, tt.req)
+			if got != tt.want || rule != tt.rule {
+				t.Errorf("Destination = %q, %d, want %q, %d", got, rule, tt.want, tt.rule)
+			}
+		})
+	}
+}
+
+type countryResolver struct {
+	country string
+	err     error
+}
+
+func (r countryResolver) Country(net.IP) (string, error) {
+	return r.country, r.err
+}
+
+func TestNewRequest(t *testing.T) {
+	ip := net.ParseIP("192.0.2.1")
+	req, err := NewRequest(countryResolver{country: "fr"}, ip, "Android", "fr-FR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Request{Country: "FR", Languages: []string{"fr-fr"}, Device: models.DeviceAndroid}
+	if !reflect.DeepEqual(req, want) {
+		t.Errorf("NewRequest = %+v, want %+v", req, want)
+	}
+
+	// The request is still described by headers when the country is unknown
+	req, err = NewRequest(countryResolver{err: errors.New("no database")}, ip, "iPhone", "")
+	if err == nil || req.Device != models.DeviceIOS || req.Country != "" {
+		t.Errorf("NewRequest = %+v, %v", req, err)
+	}
+	if req, err := NewRequest(nil, ip, "", "en"); err != nil || req.Country != "" {
+		t.Errorf("NewRequest without resolver = %+v, %v", req, err)
+	}
+}
@@ -0,0 +1,273 @@
+// Package webhook delivers link events to subscribed URLs in background. Payloads are signed
+// with HMAC-SHA256 of the webhook secret, failed deliveries are retried with exponential backoff.
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+const (
+	DefaultTimeout     = 10 * time.Second
+	DefaultWorkers     = 4
+	DefaultMaxAttempts = 8
+	DefaultBackoff     = 30 * time.Second
+	DefaultMaxBackoff  = time.Hour
+	DefaultRetention   = 30 * 24 * time.Hour
+	DefaultQueueSize   = 1000
+
+	pollInterval  = 5 * time.Second
+	purgeInterval = time.Hour
+)
+
+type Store interface {
+	Enqueue(ctx context.Context, event, payload string, workspaceID, ownerID int) (int64, error)
+	AddDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error)
+	SetDeliveryResult(ctx context.Context, delivery *models.WebhookDelivery) error
+	PurgeDeliveries(ctx context.Context, before time.Time) (int64, error)
+}
+
+type Options struct {
+	// Workers bounds concurrent deliveries, each attempt is limited by Timeout
+	Workers int
+	Timeout time.Duration
+	// Failed deliveries are retried after Backoff doubled on every attempt up to MaxBackoff,
+	// a delivery fails finally after MaxAttempts attempts
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	// Finished deliveries are kept in the log for Retention
+	Retention time.Duration
+}
+
+// Payload is the JSON body of a delivery. ID identifies the event, it is the same in retries
+// and in deliveries of the event to several webhooks.
+type Payload struct {
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      Data      `json:"data"`
+}
+
+type Data struct {
+	Link    *models.Link    `json:"link,omitempty"`
+	Click   *Click          `json:"click,omitempty"`
+	Webhook *models.Webhook `json:"webhook,omitempty"`
+}
+
+// Click describes a followed short link.
+type Click struct {
+	ShortURL    string `json:"short_url"`
+	Destination string `json:"destination"`
+	Referer     string `json:"referer,omitempty"`
+	UserAgent   string `json:"user_agent,omitempty"`
+	Country     string `json:"country,omitempty"`
+	Device      string `json:"device,omitempty"`
+	Variant     string `json:"variant,omitempty"`
+}
+
+type event struct {
+	name        string
+	payload     string
+	workspaceID int
+	ownerID     int
+}
+
+type Dispatcher struct {
+	sender Sender
+	store  Store
+	logger *zap.Logger
+	opts   Options
+	queue  chan event
+	wake   chan struct{}
+}
+
+func DispatcherNew(s Sender, st Store, l *zap.Logger, opts Options) *Dispatcher {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	if opts.MaxAttempts < 1 {
+		opts.MaxAttempts = 1
+	}
+	return &Dispatcher{
+		sender: s,
+		store:  st,
+		logger: l,
+		opts:   opts,
+		queue:  make(chan event, DefaultQueueSize),
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Start stores emitted events as deliveries and sends due deliveries until ctx is done.
+func (d *Dispatcher) Start(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e := <-d.queue:
+				count, err := d.store.Enqueue(ctx, e.name, e.payload, e.workspaceID, e.ownerID)
+				if err == nil && count > 0 {
+					d.notify()
+				}
+			}
+		}
+	}()
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		var purgedAt time.Time
+		for {
+			d.sendDue(ctx)
+			if d.opts.Retention > 0 && time.Since(purgedAt) >= purgeInterval {
+				purgedAt = time.Now()
+				_, _ = d.store.PurgeDeliveries(ctx, purgedAt.Add(-d.opts.Retention))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-d.wake:
+			}
+		}
+	}()
+}
+
+// Emit queues the event of the link for webhooks of its workspace and owner. It never blocks:
+// when the queue is full the event is dropped.
+func (d *Dispatcher) Emit(name string, link *models.Link, click *Click) {
+	if d == nil {
+		return
+	}
+	payload, err := NewPayload(name, Data{Link: link, Click: click})
+	if err != nil {
+		d.logger.Error(fmt.Sprintf(`cannot build %s payload of link %d: %s`, name, link.ID, err))
+		return
+	}
+	select {
+	case d.queue <- event{name: name, payload: payload, workspaceID: link.WorkspaceID, ownerID: link.OwnerID}:
+	default:
+		d.logger.Warn(fmt.Sprintf(`webhook queue is full, skip %s of link %d`, name, link.ID))
+	}
+}
+
+// Test sends a test event to the webhook once without retries and adds it to the delivery log.
+func (d *Dispatcher) Test(ctx context.Context, webhook *models.Webhook) (*models.WebhookDelivery, error) {
+	data := *webhook
+	data.Secret = ""
+	payload, err := NewPayload(models.EventWebhookTest, Data{Webhook: &data})
+	if err != nil {
+		return nil, err
+	}
+	delivery := &models.WebhookDelivery{
+		WebhookID: webhook.ID,
+		Event:     models.EventWebhookTest,
+		Payload:   json.RawMessage(payload),
+		URL:       webhook.URL,
+		Secret:    webhook.Secret,
+	}
+	d.attempt(ctx, delivery, false)
+	return delivery, d.store.AddDelivery(ctx, delivery)
+}
+
+// NewPayload returns the JSON body of a new event.
+func NewPayload(name string, data Data) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(Payload{
+		ID:        hex.EncodeToString(b),
+		Event:     name,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	return string(payload), err
+}
+
+// Backoff returns the delay before the next attempt after the given number of failed attempts.
+func Backoff(base, maxDelay time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// sendDue sends due deliveries by batches of Workers until none is left.
+func (d *Dispatcher) sendDue(ctx context.Context) {
+	// A claimed delivery is sent again if its result is not stored within the lease
+	lease := 2*d.opts.Timeout + time.Minute
+	for ctx.Err() == nil {
+		deliveries, err := d.store.ClaimDeliveries(ctx, d.opts.Workers, lease)
+		if err != nil {
+			return
+		}
+		var wg sync.WaitGroup
+		for _, delivery := range deliveries {
+			wg.Add(1)
+			go func(delivery *models.WebhookDelivery) {
+				defer wg.Done()
+				d.attempt(ctx, delivery, true)
+				_ = d.store.SetDeliveryResult(ctx, delivery)
+			}(delivery)
+		}
+		wg.Wait()
+		if len(deliveries) < d.opts.Workers {
+			return
+		}
+	}
+}
+
+// attempt sends the delivery and sets its status: delivered on a 2xx response, pending with the time of
+// the next attempt if it may be retried, failed otherwise.
+func (d *Dispatcher) attempt(ctx context.Context, delivery *models.WebhookDelivery, retry bool) {
+	sendCtx, cancel := context.WithTimeout(ctx, d.opts.Timeout)
+	status, err := d.sender.Send(sendCtx, delivery.URL, Header(delivery), delivery.Payload)
+	cancel()
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.StatusCode = status
+	delivery.LastAttemptAt = &now
+	delivery.NextAttemptAt = nil
+	delivery.Error = ""
+	if err != nil {
+		delivery.Error = err.Error()
+	} else if status < http.StatusOK || status >= http.StatusMultipleChoices {
+		delivery.Error = fmt.Sprintf("status %d", status)
+	}
+	switch {
+	case delivery.Error == "":
+		delivery.Status = models.DeliveryDelivered
+	case !retry || delivery.Attempts >= d.opts.MaxAttempts:
+		delivery.Status = models.DeliveryFailed
+		d.logger.Info(fmt.Sprintf(`webhook delivery %d to %s failed: %s`, delivery.ID, delivery.URL, delivery.Error))
+	default:
+		delivery.Status = models.DeliveryPending
+		next := now.Add(Backoff(d.opts.Backoff, d.opts.MaxBackoff, delivery.Attempts))
+		delivery.NextAttemptAt = &next
+	}
+}
@@ -0,0 +1,29 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Minute},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{5, 16 * time.Minute},
+		{6, 30 * time.Minute},
+		{100, 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := Backoff(time.Minute, 30*time.Minute, tt.attempts); got != tt.want {
+			t.Errorf("Backoff after %d attempts = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+	if got := Backoff(time.Hour, 30*time.Minute, 1); got != 30*time.Minute {
+		t.Errorf("Backoff with base above max = %s, want %s", got, 30*time.Minute)
+	}
+}
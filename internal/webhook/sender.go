@@ -0,0 +1,84 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+	"github.com/ptsypyshev/shortlink/internal/netguard"
+)
+
+const (
+	// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the request body keyed by the webhook secret
+	SignatureHeader = "X-Shortlink-Signature"
+	EventHeader     = "X-Shortlink-Event"
+	DeliveryHeader  = "X-Shortlink-Delivery"
+	UserAgent       = "ShortlinkWebhooks/1.0"
+	signaturePrefix = "sha256="
+	// Responses are only read to let the connection be reused
+	maxDrainSize = 64 << 10
+)
+
+// Sender posts a signed payload to a webhook URL and reports the response status,
+// a non-2xx status or an error makes the dispatcher retry the delivery.
+type Sender interface {
+	Send(ctx context.Context, rawURL string, header http.Header, body []byte) (int, error)
+}
+
+type HTTPSender struct {
+	Client *http.Client
+}
+
+// NewHTTPSender returns a sender which refuses private network URLs and does not follow redirects.
+func NewHTTPSender(timeout time.Duration) *HTTPSender {
+	return &HTTPSender{Client: netguard.NewClient(timeout, 0)}
+}
+
+// Send posts the body and returns the status code of the response.
+func (s *HTTPSender) Send(ctx context.Context, rawURL string, header http.Header, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header = header
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainSize))
+	return resp.StatusCode, nil
+}
+
+// Sign returns the signature header value of the body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether the signature header value matches the body, receivers in Go may use it as is.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// Header returns request headers of the delivery.
+func Header(delivery *models.WebhookDelivery) http.Header {
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json")
+	header.Set("User-Agent", UserAgent)
+	header.Set(EventHeader, delivery.Event)
+	// Test deliveries are stored after sending
+	if delivery.ID != 0 {
+		header.Set(DeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	}
+	header.Set(SignatureHeader, Sign(delivery.Secret, delivery.Payload))
+	return header
+}
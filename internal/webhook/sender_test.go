@@ -0,0 +1,59 @@
+package webhook
+
+import (
+	"testing"
+
+	"github.com/ptsypyshev/shortlink/internal/models"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte("The quick brown fox jumps over the lazy dog")
+	// HMAC-SHA256 of the body keyed by "key"
+	want := "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"
+	if got := Sign("key", body); got != want {
+		t.Fatalf("Sign = %s, want %s", got, want)
+	}
+	tests := []struct {
+		name      string
+		secret    string
+		body      string
+		signature string
+		ok        bool
+	}{
+		{"valid", "key", string(body), want, true},
+		{"other secret", "other", string(body), want, false},
+		{"other body", "key", "The quick brown fox", want, false},
+		{"without prefix", "key", string(body), want[len(signaturePrefix):], false},
+		{"empty", "key", string(body), "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.secret, []byte(tt.body), tt.signature); got != tt.ok {
+				t.Errorf("Verify = %t, want %t", got, tt.ok)
+			}
+		})
+	}
+}
+
+func TestHeader(t *testing.T) {
+	delivery := &models.WebhookDelivery{ID: 42, Event: "link.created", Payload: []byte(`{"id":"1"}`), Secret: "key"}
+	header := Header(delivery)
+	want := map[string]string{
+		"Content-Type":  "application/json",
+		"User-Agent":    UserAgent,
+		EventHeader:     "link.created",
+		DeliveryHeader:  "42",
+		SignatureHeader: Sign("key", delivery.Payload),
+	}
+	for name, value := range want {
+		if got := header.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+
+	// Test deliveries have no id yet
+	delivery.ID = 0
+	if _, ok := Header(delivery)[DeliveryHeader]; ok {
+		t.Errorf("%s is set for a delivery without id", DeliveryHeader)
+	}
+}
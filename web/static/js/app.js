@@ -1,10 +1,31 @@
+// csrfToken returns the token required by the server for state-changing requests
+function csrfToken() {
+    return document.querySelector('meta[name="csrf-token"]').content;
+}
+
+// loadCSRFToken requests the token for anonymous pages which are rendered without it
+function loadCSRFToken() {
+    const meta = document.querySelector('meta[name="csrf-token"]');
+    if (meta.content) {
+        return Promise.resolve(meta.content);
+    }
+    return fetch('/api/csrf', {method: 'GET'})
+        .then(response => response.json())
+        .then(data => {
+            meta.content = data.result;
+            return data.result;
+        });
+}
+
 Vue.createApp({
     delimiters: ['{%', '%}'],
     data: () => ({
         shortlink: {
             longLink: "",
             shortURL: "",
+            domain: "",
         },
+        domains: [],
         showShortLink: false,
         isURLValid: false,
         user: "",
@@ -21,8 +42,32 @@ Vue.createApp({
             user_status: ""
         },
         links: [],
+        tags: [],
+        workspaces: [],
+        workspaceID: 0,
+        tagFilter: "",
+        searchText: "",
         showLinks: false,
         showUserEditForm: false,
+        offboard: {
+            user: null,
+            deleting: false,
+            linksAction: "transfer",
+            newOwnerID: "",
+            links: [],
+            linkIDs: [],
+            error: "",
+        },
+        sessions: [],
+        twofa: {
+            enabled: false,
+            recoveryCodesLeft: 0,
+            secret: "",
+            qr: "",
+            code: "",
+            recoveryCodes: [],
+            error: "",
+        },
     }),
     watch: {
         showShortLink() {
@@ -35,12 +80,12 @@ Vue.createApp({
             this.isURLValid = validator.isURL(this.shortlink.longLink, {require_protocol: true});
         },
         shortenLink() {
-            const requestOptions = {
-                method: 'POST',
-                headers: {'Content-Type': 'application/json'},
-                body: JSON.stringify({"long_link": this.shortlink.longLink, "is_active": true})
-            };
-            fetch('/api/links/', requestOptions)
+            loadCSRFToken()
+                .then(token => fetch('/api/links/', {
+                    method: 'POST',
+                    headers: {'Content-Type': 'application/json', 'X-CSRF-Token': token},
+                    body: JSON.stringify({"long_link": this.shortlink.longLink, "is_active": true, "workspace_id": this.workspaceID, "domain": this.shortlink.domain})
+                }))
                 .then(async response => {
                     const data = await response.json();
                     // check for error response
@@ -49,7 +94,7 @@ Vue.createApp({
                         const error = (data && data.message) || response.status;
                         return Promise.reject(error);
                     }
-                    this.shortlink.shortURL = window.location.protocol + "//" + window.location.host + "/" + data.created;
+                    this.shortlink.shortURL = data.created;
                 })
                 .catch(error => {
                     this.errorMessage = error;
@@ -62,7 +107,19 @@ Vue.createApp({
                 method: 'GET'
             };
             let id = document.querySelector('meta[name="userid"]').content;
-            fetch('/api/users/' + id + '/links/', requestOptions)
+            let params = new URLSearchParams();
+            if (this.tagFilter) {
+                params.set('tag', this.tagFilter);
+            }
+            if (this.searchText) {
+                params.set('q', this.searchText);
+            }
+            let query = params.toString() ? '?' + params.toString() : '';
+            let url = '/api/users/' + id + '/links/';
+            if (this.workspaceID) {
+                url = '/api/workspaces/' + this.workspaceID + '/links';
+            }
+            fetch(url + query, requestOptions)
                 .then(async response => {
                     const data = await response.json();
                     // check for error response
@@ -71,12 +128,7 @@ Vue.createApp({
                         const error = (data && data.message) || response.status;
                         return Promise.reject(error);
                     }
-                    let links = data.found;
-                    let linksLen = links.length;
-                    for (let i = 0; i < linksLen; i++) {
-                        links[i].short_link = window.location.protocol + "//" + window.location.host + "/" + links[i].short_link;
-                    }
-                    this.links = links;
+                    this.links = data.found;
                 })
                 .catch(error => {
                     this.errorMessage = error;
@@ -84,6 +136,65 @@ Vue.createApp({
                 });
             this.showLinks = true;
         },
+        getTags() {
+            fetch('/api/tags/', {method: 'GET'})
+                .then(async response => {
+                    const data = await response.json();
+                    // check for error response
+                    if (!response.ok) {
+                        // get error message from body or default to response status
+                        const error = (data && data.message) || response.status;
+                        return Promise.reject(error);
+                    }
+                    this.tags = data.found;
+                })
+                .catch(error => {
+                    this.errorMessage = error;
+                    console.error('There was an error!', error);
+                });
+        },
+        getWorkspaces() {
+            fetch('/api/workspaces/', {method: 'GET'})
+                .then(async response => {
+                    const data = await response.json();
+                    // check for error response
+                    if (!response.ok) {
+                        // get error message from body or default to response status
+                        const error = (data && data.message) || response.status;
+                        return Promise.reject(error);
+                    }
+                    this.workspaces = data.found;
+                })
+                .catch(error => {
+                    this.errorMessage = error;
+                    console.error('There was an error!', error);
+                });
+        },
+        getDomains() {
+            fetch('/api/domains/', {method: 'GET'})
+                .then(async response => {
+                    const data = await response.json();
+                    // check for error response
+                    if (!response.ok) {
+                        // get error message from body or default to response status
+                        const error = (data && data.message) || response.status;
+                        return Promise.reject(error);
+                    }
+                    this.domains = data.found;
+                })
+                .catch(error => {
+                    this.errorMessage = error;
+                    console.error('There was an error!', error);
+                });
+        },
+        switchWorkspace() {
+            this.tagFilter = "";
+            this.getLinks();
+        },
+        filterByTag(tag) {
+            this.tagFilter = tag;
+            this.getLinks();
+        },
         getUsers() {
             const requestOptions = {
                 method: 'GET'
@@ -114,7 +225,7 @@ Vue.createApp({
             })
             const requestOptions = {
                 method: 'POST',
-                headers: {'Content-Type': 'application/json'},
+                headers: {'Content-Type': 'application/json', 'X-CSRF-Token': csrfToken()},
                 body: JSON.stringify(json_string)
             };
             fetch('/api/users/', requestOptions)
@@ -164,7 +275,7 @@ Vue.createApp({
             if (answer) {
                 const requestOptions = {
                     method: 'PUT',
-                    headers: {'Content-Type': 'application/json'},
+                    headers: {'Content-Type': 'application/json', 'X-CSRF-Token': csrfToken()},
                     body: JSON.stringify(json_string)
                 };
                 fetch('/api/users/', requestOptions)
@@ -201,20 +312,121 @@ Vue.createApp({
             this.showUserEditForm = !this.showUserEditForm;
             // this.getObjectsForTemplate();
         },
-        deleteUser(user_id) {
-            let msg = "Do you really want to delete this user?"
-            let answer = confirm(msg);
+        deleteUser(user) {
+            this.offboardShowForm(user, true);
+        },
+        transferLinksShowForm(user) {
+            this.offboardShowForm(user, false);
+            fetch('/api/users/' + user.id + '/links', {method: 'GET'})
+                .then(async response => {
+                    const data = await response.json();
+                    if (!response.ok) {
+                        const error = (data && data.error) || response.status;
+                        return Promise.reject(error);
+                    }
+                    this.offboard.links = data.found;
+                    this.offboard.linkIDs = data.found.map(link => link.id);
+                })
+                .catch(error => {
+                    this.offboard.error = error;
+                    console.error('There was an error!', error);
+                });
+        },
+        offboardShowForm(user, deleting) {
+            this.offboard.user = user;
+            this.offboard.deleting = deleting;
+            this.offboard.linksAction = "transfer";
+            this.offboard.newOwnerID = "";
+            this.offboard.links = [];
+            this.offboard.linkIDs = [];
+            this.offboard.error = "";
+        },
+        // offboardSave deletes the user or transfers the selected links, links of a deleted user
+        // are transferred, deactivated or deleted as chosen in the form
+        offboardSave() {
+            let path = '/api/users/' + this.offboard.user.id;
+            const requestOptions = {
+                method: 'DELETE',
+                headers: {'Content-Type': 'application/json', 'X-CSRF-Token': csrfToken()},
+            };
+            if (this.offboard.deleting) {
+                let params = new URLSearchParams({"links": this.offboard.linksAction});
+                if (this.offboard.linksAction === "transfer") {
+                    params.set("new_owner_id", this.offboard.newOwnerID);
+                }
+                path += '?' + params.toString();
+            } else {
+                path += '/links/transfer';
+                requestOptions.method = 'POST';
+                requestOptions.body = JSON.stringify({
+                    "new_owner_id": Number(this.offboard.newOwnerID),
+                    "link_ids": this.offboard.linkIDs,
+                });
+            }
+            fetch(path, requestOptions)
+                .then(async response => {
+                    const data = await response.json();
+                    if (!response.ok) {
+                        const error = (data && data.error) || response.status;
+                        return Promise.reject(error);
+                    }
+                    this.offboard.user = null;
+                    this.getObjectsForTemplate();
+                })
+                .catch(error => {
+                    this.offboard.error = error;
+                    console.error('There was an error!', error);
+                });
+        },
+        getSessions() {
+            fetch('/api/sessions/', {method: 'GET'})
+                .then(async response => {
+                    const data = await response.json();
+                    if (!response.ok) {
+                        const error = (data && data.error) || response.status;
+                        return Promise.reject(error);
+                    }
+                    this.sessions = data.found;
+                })
+                .catch(error => {
+                    this.errorMessage = error;
+                    console.error('There was an error!', error);
+                });
+        },
+        deleteSessions(path, msg) {
+            if (confirm(msg)) {
+                fetch(path, {method: 'DELETE', headers: {'X-CSRF-Token': csrfToken()}})
+                    .then(async response => {
+                        const data = await response.json();
+                        if (!response.ok) {
+                            const error = (data && data.error) || response.status;
+                            return Promise.reject(error);
+                        }
+                        this.getObjectsForTemplate();
+                    })
+                    .catch(error => {
+                        this.errorMessage = error;
+                        console.error('There was an error!', error);
+                    });
+            }
+        },
+        revokeSession(id) {
+            this.deleteSessions('/api/sessions/' + id, "Do you really want to revoke this session?");
+        },
+        revokeOtherSessions() {
+            this.deleteSessions('/api/sessions/', "Do you really want to sign out all other sessions?");
+        },
+        revokeUserSessions(user_id) {
+            this.deleteSessions('/api/users/' + user_id + '/sessions', "Do you really want to sign this user out of all sessions?");
+        },
+        reset2FA(user_id) {
+            let answer = confirm("Do you really want to reset two-factor authentication of this user?");
             if (answer) {
-                const requestOptions = {
-                    method: 'DELETE'
-                };
-                fetch('/api/users/' + user_id, requestOptions)
+                fetch('/api/users/' + user_id + '/2fa', {method: 'DELETE', headers: {'X-CSRF-Token': csrfToken()}})
                     .then(async response => {
                         const data = await response.json();
-                        // check for error response
                         if (!response.ok) {
-                            // get error message from body or default to response status
-                            const error = (data && data.message) || response.status;
+                            const error = (data && data.error) || response.status;
                             return Promise.reject(error);
                         }
                         this.getObjectsForTemplate();
@@ -225,19 +437,85 @@ Vue.createApp({
                     });
             }
         },
+        request2FA(path, body) {
+            const requestOptions = {
+                method: path === '/api/2fa/' ? 'GET' : 'POST',
+                headers: {'Content-Type': 'application/json', 'X-CSRF-Token': csrfToken()},
+            };
+            if (body) {
+                requestOptions.body = JSON.stringify(body);
+            }
+            this.twofa.error = "";
+            return fetch(path, requestOptions)
+                .then(async response => {
+                    const data = await response.json();
+                    if (!response.ok) {
+                        const error = (data && data.error) || response.status;
+                        return Promise.reject(error);
+                    }
+                    return data;
+                })
+                .catch(error => {
+                    this.twofa.error = error;
+                    console.error('There was an error!', error);
+                    return Promise.reject(error);
+                });
+        },
+        get2FA() {
+            this.request2FA('/api/2fa/').then(data => {
+                this.twofa.enabled = data.result.enabled;
+                this.twofa.recoveryCodesLeft = data.result.recovery_codes_left;
+            });
+        },
+        setup2FA() {
+            this.request2FA('/api/2fa/setup').then(data => {
+                this.twofa.secret = data.result.secret;
+                this.twofa.qr = data.result.qr;
+            });
+        },
+        enable2FA() {
+            this.request2FA('/api/2fa/enable', {"code": this.twofa.code}).then(data => {
+                this.twofa.recoveryCodes = data.result.recovery_codes;
+                this.twofa.qr = "";
+                this.twofa.secret = "";
+                this.twofa.code = "";
+                this.get2FA();
+            });
+        },
+        verify2FA() {
+            this.request2FA('/api/2fa/verify', {"code": this.twofa.code}).then(() => {
+                this.twofa.code = "";
+                this.get2FA();
+            });
+        },
+        newRecoveryCodes() {
+            this.request2FA('/api/2fa/recovery-codes').then(data => {
+                this.twofa.recoveryCodes = data.result.recovery_codes;
+                this.get2FA();
+            });
+        },
+        disable2FA() {
+            if (confirm("Do you really want to disable two-factor authentication?")) {
+                this.request2FA('/api/2fa/disable').then(() => {
+                    this.twofa.recoveryCodes = [];
+                    this.get2FA();
+                });
+            }
+        },
         initDB() {
-            this.getRequest('/dbinit/', "Do you really want to Init DB? All data will be lost...");
+            this.postRequest('/dbinit/', "Do you really want to Init DB? All data will be lost...");
             this.getObjectsForTemplate();
         },
         addDemoData() {
-            this.getRequest('/demodb/', "Do you really want add demo data?");
+            this.postRequest('/demodb/', "Do you really want add demo data?");
             this.getObjectsForTemplate();
         },
-        getRequest(path, msg) {
+        postRequest(path, msg) {
             let answer = confirm(msg);
             if (answer) {
                 const requestOptions = {
-                    method: 'GET'
+                    method: 'POST',
+                    headers: {'X-CSRF-Token': csrfToken()},
                 };
                 fetch(path, requestOptions)
                     .then(async response => {
@@ -262,14 +540,21 @@ Vue.createApp({
             switch (page_template) {
                 case "dashboard":
                     this.getLinks();
+                    this.getTags();
+                    this.getWorkspaces();
                     break;
                 case "users":
                     this.getUsers();
                     break;
+                case "security":
+                    this.get2FA();
+                    this.getSessions();
+                    break;
             }
         }
     },
     beforeMount(){
         this.getObjectsForTemplate();
+        this.getDomains();
     },
 }).mount('.vueapp');
\ No newline at end of file